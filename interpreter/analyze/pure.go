@@ -0,0 +1,285 @@
+package analyze
+
+import (
+	"github.com/connorjbarry/monkey/interpreter/ast"
+	"github.com/connorjbarry/monkey/interpreter/evaluator"
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+// IsPure reports whether calling fn can do nothing but compute its result
+// from its arguments: it prints nothing, mutates nothing it didn't create,
+// and reads no variable from outside itself, since a later assignment could
+// change what that variable holds. Such a function may safely be memoized
+// or have its calls reordered.
+//
+// env is the scope fn is defined in. A name fn doesn't bind itself may only
+// be a builtin there marked pure, or marked as calling back into a function
+// argument that is pure; a variable or host-registered builtin of the same
+// name makes the call impure, whatever it does.
+//
+// The analysis is conservative. Anything it can't prove pure, such as a call
+// to a function passed in as an argument or defined outside fn, makes fn
+// impure, even when it would in fact be harmless. One assumption is made:
+// operators are taken to be pure, though on hashes they may call __add__ or
+// __eq__ methods, which the analysis can't see.
+func IsPure(fn *ast.FunctionLiteral, env *object.Env) bool {
+	c := newChecker(nil, fn.Params)
+	c.env = env
+	c.block(fn.Body)
+
+	return c.pure
+}
+
+// checker walks one function body. Names it binds are locals, which it may
+// read and reassign; the locals of enclosing functions may only be read,
+// since a closure that changes them carries state between calls.
+type checker struct {
+	outer  *checker
+	env    *object.Env
+	locals map[string]bool
+	funcs  map[string]bool // locals known to hold a pure function
+	pure   bool
+}
+
+func newChecker(outer *checker, params []*ast.Identifier) *checker {
+	c := &checker{outer: outer, locals: map[string]bool{}, funcs: map[string]bool{}, pure: true}
+	if outer != nil {
+		c.env = outer.env
+	}
+	for _, p := range params {
+		c.locals[p.Value] = true
+	}
+	return c
+}
+
+// lookup finds the checker that binds name, or nil if no enclosing function
+// does.
+func (c *checker) lookup(name string) *checker {
+	for s := c; s != nil; s = s.outer {
+		if s.locals[name] {
+			return s
+		}
+	}
+	return nil
+}
+
+func (c *checker) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		c.node(stmt)
+	}
+}
+
+func (c *checker) node(node ast.Node) {
+	if !c.pure {
+		return
+	}
+
+	switch node := node.(type) {
+	case nil:
+	case *ast.LetStatement:
+		c.node(node.Value)
+		c.locals[node.Name.Value] = true
+		_, isFn := node.Value.(*ast.FunctionLiteral)
+		c.funcs[node.Name.Value] = isFn
+	case *ast.AssignStatement:
+		c.node(node.Value)
+		c.assign(node.Name.Value)
+		// A call through this name may already have been checked, and in a
+		// loop may run again after the assignment, so it has to stay pure.
+		if _, isFn := node.Value.(*ast.FunctionLiteral); c.funcs[node.Name.Value] && !isFn {
+			c.pure = false
+		}
+	case *ast.IncDecStatement:
+		c.assign(node.Name.Value)
+	case *ast.ReturnStatement:
+		c.node(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		c.node(node.Expression)
+	case *ast.WhileStatement:
+		c.node(node.Condition)
+		c.block(node.Body)
+	case *ast.ForInStatement:
+		c.node(node.Iterable)
+		c.forInBody(node)
+	case *ast.BreakStatement, *ast.ContinueStatement:
+	case *ast.BlockStatement:
+		c.block(node)
+	case *ast.Identifier:
+		if c.lookup(node.Value) == nil && !c.pureBuiltin(node.Value) {
+			c.pure = false
+		}
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+	case *ast.PrefixExpression:
+		c.node(node.Right)
+	case *ast.InfixExpression:
+		c.node(node.Left)
+		c.node(node.Right)
+	case *ast.IfExpression:
+		c.node(node.Condition)
+		c.block(node.Consequence)
+		c.block(node.Alternative)
+	case *ast.TernaryExpression:
+		c.node(node.Condition)
+		c.node(node.Consequence)
+		c.node(node.Alternative)
+	case *ast.FunctionLiteral:
+		inner := newChecker(c, node.Params)
+		inner.block(node.Body)
+		c.pure = inner.pure
+	case *ast.CallExpression:
+		c.call(node)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			c.node(el)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			c.node(part)
+		}
+	case *ast.IndexExpression:
+		c.node(node.Left)
+		c.node(node.Index)
+	case *ast.SliceExpression:
+		c.node(node.Left)
+		c.node(node.Low)
+		c.node(node.High)
+	case *ast.HashLiteral:
+		for key, val := range node.Pairs {
+			c.node(key)
+			c.node(val)
+		}
+	case *ast.MatchExpression:
+		c.node(node.Subject)
+		for _, arm := range node.Arms {
+			c.matchArm(arm)
+		}
+	default:
+		c.pure = false
+	}
+}
+
+// assign allows reassigning only the function's own locals.
+func (c *checker) assign(name string) {
+	if !c.locals[name] {
+		c.pure = false
+	}
+}
+
+// matchArm checks an arm with its pattern's bindings in scope, restoring the
+// enclosing bindings afterwards since arms evaluate in their own scope.
+func (c *checker) matchArm(arm *ast.MatchArm) {
+	locals, funcs := c.locals, c.funcs
+	c.locals, c.funcs = copySet(locals), copySet(funcs)
+
+	c.bindPattern(arm.Pattern)
+	c.node(arm.Guard)
+	c.node(arm.Body)
+
+	c.locals, c.funcs = locals, funcs
+}
+
+// forInBody checks a for...in body with the loop variable bound, restoring
+// the enclosing bindings afterwards since every pass runs in its own scope.
+func (c *checker) forInBody(node *ast.ForInStatement) {
+	locals, funcs := c.locals, c.funcs
+	c.locals, c.funcs = copySet(locals), copySet(funcs)
+
+	c.locals[node.Name.Value] = true
+	c.funcs[node.Name.Value] = false
+	c.block(node.Body)
+
+	c.locals, c.funcs = locals, funcs
+}
+
+func copySet(set map[string]bool) map[string]bool {
+	out := make(map[string]bool, len(set))
+	for k, v := range set {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *checker) bindPattern(pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.locals[pattern.Value] = true
+			c.funcs[pattern.Value] = false
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range pattern.Elements {
+			c.bindPattern(el)
+		}
+	}
+}
+
+func (c *checker) call(call *ast.CallExpression) {
+	for _, arg := range call.Args {
+		c.node(arg)
+	}
+
+	switch callee := call.Func.(type) {
+	case *ast.FunctionLiteral:
+		c.node(callee)
+
+	case *ast.Identifier:
+		switch {
+		case c.lookup(callee.Value) != nil:
+			if !c.isPureFunc(callee) {
+				c.pure = false
+			}
+		default:
+			b := c.builtin(callee.Value)
+			switch {
+			case b == nil:
+				c.pure = false
+			case b.Pure:
+			case b.Callback && b.CallbackArg < len(call.Args) && c.isPureFunc(call.Args[b.CallbackArg]):
+			default:
+				c.pure = false
+			}
+		}
+
+	default:
+		c.pure = false
+	}
+}
+
+// isPureFunc reports whether exp is known to be a pure function: a literal,
+// whose body node has already checked, a local bound to one, or a pure
+// builtin.
+func (c *checker) isPureFunc(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.FunctionLiteral:
+		return true
+	case *ast.Identifier:
+		if s := c.lookup(exp.Value); s != nil {
+			return s.funcs[exp.Value]
+		}
+		return c.pureBuiltin(exp.Value)
+	}
+	return false
+}
+
+// builtin returns the standard builtin a name no enclosing function binds
+// refers to, or nil if there is none or a variable or host-registered
+// builtin takes the name.
+func (c *checker) builtin(name string) *object.BuiltIn {
+	if _, ok := c.env.Get(name); ok {
+		return nil
+	}
+	if _, ok := c.env.Builtin(name); ok {
+		return nil
+	}
+
+	b, _ := evaluator.Builtin(name, c.env)
+	return b
+}
+
+func (c *checker) pureBuiltin(name string) bool {
+	b := c.builtin(name)
+	return b != nil && b.Pure
+}
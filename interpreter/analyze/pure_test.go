@@ -0,0 +1,91 @@
+package analyze
+
+import (
+	"testing"
+
+	"github.com/connorjbarry/monkey/interpreter/ast"
+	"github.com/connorjbarry/monkey/interpreter/evaluator"
+	"github.com/connorjbarry/monkey/interpreter/lexer"
+	"github.com/connorjbarry/monkey/interpreter/object"
+	"github.com/connorjbarry/monkey/interpreter/parser"
+)
+
+func TestIsPure(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`fn(a, b) { a * a + b * b }`, true},
+		{`fn(x) { if (x < 0) { -x } else { x } }`, true},
+		{`fn(n) { let acc = 1; let i = 1; while (i < n + 1) { acc = acc * i; i++ }; acc }`, true},
+		{`fn(xs) { let sq = fn(x) { x * x }; map(xs, sq) }`, true},
+		{`fn(xs) { filter(xs, fn(x) { x > len(xs) }) }`, true},
+		{`fn(xs) { map(xs, len) }`, true},
+		{`fn(xs) { reduce(xs, 0, fn(acc, x) { acc + x }) }`, true},
+		{`fn(p) { match (p) { [a, b] => a + b; _ => 0 } }`, true},
+		{`fn(x) { fn(y) { x + y } }`, true},
+		{`fn(s) { "${s}!" }`, true},
+		{`fn(x) { let r = try(fn() { 10 / x }); if (is_error(r)) { cause(r) } else { r } }`, true},
+		{`fn(xs) { let total = 0; for (x in xs) { total = total + x }; total }`, true},
+
+		{`fn(x) { puts(x); x }`, false},
+		{`fn(x) { let p = puts; x }`, false},
+		{`fn() { time_now() }`, false},
+		{`fn(h) { set(h, "k", 1) }`, false},
+		{`fn(x) { x * factor }`, false},
+		{`fn(x) { helper(x) }`, false},
+		{`fn(f, x) { f(x) }`, false},
+		{`fn(xs, f) { map(xs, f) }`, false},
+		{`fn(xs) { reduce(xs, 0, fn(acc, x) { puts(x); acc }) }`, false},
+		{`fn(xs) { map(xs, fn(x) { puts(x) }) }`, false},
+		{`fn() { counter = counter + 1 }`, false},
+		{`fn() { counter++ }`, false},
+		{`fn() { let n = 0; fn() { n++ } }`, false},
+		{`fn(x) { let g = fn() { 1 }; while (x > 0) { g(); g = x; x-- } }`, false},
+		{`fn(x) { let len = fn(y) { puts(y) }; len(x) }`, false},
+		{`fn(x) { x()() }`, false},
+		{`fn(p) { match (p) { y => 1 }; y }`, false},
+		{`fn(xs) { for (x in xs) { puts(x) } }`, false},
+		{`fn(xs) { for (x in xs) { }; x = 1 }`, false},
+		{`fn() { try(fn() { puts(1) }) }`, false},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if got := IsPure(fn, object.NewEnvironment()); got != tt.expected {
+			t.Errorf("IsPure(%s) = %t, expected %t", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestIsPureShadowedBuiltins(t *testing.T) {
+	env := object.NewEnvironment()
+	env.RegisterBuiltin("upper", func(args ...object.Object) object.Object { return args[0] })
+	program := parser.New(lexer.New(`let len = fn(x) { puts(x) }; let map = fn(xs, f) { xs };`)).ParseProgram()
+	evaluator.Eval(program, env)
+
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`fn(xs) { first(xs) }`, true},
+		{`fn(xs) { len(xs) }`, false},
+		{`fn(xs) { filter(xs, len) }`, false},
+		{`fn(xs) { map(xs, fn(x) { x }) }`, false},
+		{`fn(s) { upper(s) }`, false},
+		{`fn(xs) { filter(xs, upper) }`, false},
+	}
+
+	for _, tt := range tests {
+		fn := parser.New(lexer.New(tt.input)).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if got := IsPure(fn, env); got != tt.expected {
+			t.Errorf("IsPure(%s) = %t, expected %t", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"cmp"
+	"slices"
 	"strings"
 
 	"github.com/connorjbarry/monkey/interpreter/token"
@@ -48,6 +50,7 @@ type LetStatement struct {
 	Token token.Token // The token.LET token.
 	Name  *Identifier
 	Value Expression
+	Doc   string // comment lines directly preceding the statement
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -68,6 +71,42 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// AssignStatement rebinds a variable already declared with let: `x = 5;`.
+type AssignStatement struct {
+	Token token.Token // the identifier token
+	Name  *Identifier
+	Value Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Name.String())
+	out.WriteString(" = ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// IncDecStatement is a postfix `x++` or `x--`, which steps an integer
+// variable by one in place.
+type IncDecStatement struct {
+	Token    token.Token // the '++' or '--' token
+	Name     *Identifier
+	Operator string
+}
+
+func (is *IncDecStatement) statementNode()       {}
+func (is *IncDecStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *IncDecStatement) String() string       { return is.Name.String() + is.Operator + ";" }
+
 type Identifier struct {
 	Token token.Token // The token.IDENT token.
 	Value string
@@ -98,6 +137,65 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+type WhileStatement struct {
+	Token     token.Token // 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForInStatement is `for (name in iterable) { ... }`, which runs the body
+// once for each value iterable holds, bound to name.
+type ForInStatement struct {
+	Token    token.Token // 'for' token
+	Name     *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Name.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+type ContinueStatement struct {
+	Token token.Token // 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -122,6 +220,15 @@ func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 type PrefixExpression struct {
 	Token    token.Token // prefix token, e.g. '!'
 	Operator string
@@ -196,6 +303,30 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// TernaryExpression is `cond ? a : b`, a compact if/else.
+type TernaryExpression struct {
+	Token       token.Token // the '?' token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (te *TernaryExpression) expressionNode()      {}
+func (te *TernaryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TernaryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(te.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(te.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(te.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -217,6 +348,7 @@ type FunctionLiteral struct {
 	Token  token.Token
 	Params []*Identifier
 	Body   *BlockStatement
+	Doc    string // doc comment of the let statement binding the function
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -271,6 +403,31 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
+// InterpolatedString is a string literal with embedded ${...} expressions.
+// Parts alternates between *StringLiteral text and the embedded expressions.
+type InterpolatedString struct {
+	Token token.Token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if _, ok := part.(*StringLiteral); ok {
+			out.WriteString(part.String())
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -313,6 +470,35 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is `left[low:high]`. Either bound may be omitted, leaving
+// Low or High nil.
+type SliceExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
@@ -334,3 +520,148 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// HashPair is one `key: value` pair of a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// SortedPairs returns the literal's pairs in the order their keys appear in
+// the source. Keys without positions, as in hand-built trees, are ordered by
+// their String forms.
+func (hl *HashLiteral) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(hl.Pairs))
+	for k, v := range hl.Pairs {
+		pairs = append(pairs, HashPair{Key: k, Value: v})
+	}
+
+	slices.SortFunc(pairs, func(a, b HashPair) int {
+		at, bt := tokenOf(a.Key), tokenOf(b.Key)
+		return cmp.Or(
+			cmp.Compare(at.Line, bt.Line),
+			cmp.Compare(at.Column, bt.Column),
+			cmp.Compare(a.Key.String(), b.Key.String()),
+		)
+	})
+
+	return pairs
+}
+
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, "; "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// MatchArm is a single `pattern if guard => body` clause of a match
+// expression, where the guard is optional. The pattern reuses expression
+// nodes: array literals destructure, identifiers bind (with `_` as the
+// wildcard) and literals compare by value.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression
+	Body    Expression
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+// tokenOf returns the token a node was parsed from, which for a program is
+// that of its first statement.
+func tokenOf(node Node) token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return tokenOf(node.Statements[0])
+		}
+	case *LetStatement:
+		return node.Token
+	case *AssignStatement:
+		return node.Token
+	case *IncDecStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *WhileStatement:
+		return node.Token
+	case *ForInStatement:
+		return node.Token
+	case *BreakStatement:
+		return node.Token
+	case *ContinueStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *FloatLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *InterpolatedString:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *InfixExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *TernaryExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *CallExpression:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *IndexExpression:
+		return node.Token
+	case *SliceExpression:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *MatchExpression:
+		return node.Token
+	}
+
+	return token.Token{}
+}
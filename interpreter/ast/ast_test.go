@@ -27,3 +27,53 @@ func TestString(t *testing.T) {
 		t.Errorf("Expected 'let myVar = anotherVar;', got '%s'", program.String())
 	}
 }
+
+func TestToJSON(t *testing.T) {
+	ident := func(name string, col int) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENTIFER, Literal: name, Line: 1, Column: col}, Value: name}
+	}
+
+	// if (x) { {"a": 1, "b": y} }
+	node := &IfExpression{
+		Token:     token.Token{Type: token.IF, Literal: "if", Line: 1, Column: 1},
+		Condition: ident("x", 5),
+		Consequence: &BlockStatement{
+			Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 8},
+			Statements: []Statement{
+				&ExpressionStatement{
+					Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 10},
+					Expression: &HashLiteral{
+						Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 10},
+						Pairs: map[Expression]Expression{
+							&StringLiteral{Token: token.Token{Type: token.STRING, Literal: "b", Line: 1, Column: 19}, Value: "b"}: ident("y", 24),
+							&StringLiteral{Token: token.Token{Type: token.STRING, Literal: "a", Line: 1, Column: 11}, Value: "a"}: &IntegerLiteral{
+								Token: token.Token{Type: token.INT, Literal: "1"},
+								Value: 1,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected := `{"alternative":null,` +
+		`"column":1,` +
+		`"condition":{"column":5,"line":1,"token":"x","type":"Identifier","value":"x"},` +
+		`"consequence":{"column":8,"line":1,"statements":[` +
+		`{"column":10,"expression":{"column":10,"line":1,"pairs":[` +
+		`{"key":{"column":11,"line":1,"token":"a","type":"StringLiteral","value":"a"},"value":{"token":"1","type":"IntegerLiteral","value":1}},` +
+		`{"key":{"column":19,"line":1,"token":"b","type":"StringLiteral","value":"b"},"value":{"column":24,"line":1,"token":"y","type":"Identifier","value":"y"}}` +
+		`],"token":"{","type":"HashLiteral"},"line":1,"token":"{","type":"ExpressionStatement"}` +
+		`],"token":"{","type":"BlockStatement"},` +
+		`"line":1,"token":"if","type":"IfExpression"}`
+
+	got, err := ToJSON(node)
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+
+	if string(got) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=     %s", expected, got)
+	}
+}
@@ -0,0 +1,386 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Operator precedences, mirroring the parser's, so Format can tell where
+// parentheses are needed. Expressions that can't be split apart, such as
+// literals and calls, bind tightest.
+const (
+	precTernary = iota + 1
+	precOr
+	precAnd
+	precEquals
+	precCompare
+	precSum
+	precProduct
+	precPrefix
+	precPower
+	precPostfix
+	precAtom
+)
+
+var infixPrecedences = map[string]int{
+	"||": precOr,
+	"&&": precAnd,
+	"==": precEquals, "!=": precEquals, "in": precEquals,
+	"<": precCompare, ">": precCompare, "<=": precCompare, ">=": precCompare,
+	"+": precSum, "-": precSum, "|": precSum, "^": precSum,
+	"*": precProduct, "/": precProduct, "%": precProduct, "&": precProduct, "<<": precProduct, ">>": precProduct,
+	"**": precPower,
+}
+
+// maxInlinePairs is how many pairs a hash literal may have and still be
+// written on one line.
+const maxInlinePairs = 3
+
+// Format renders node as canonical Monkey source: statements one to a line
+// and ended with semicolons, blocks indented with tabs, single spaces
+// around binary operators and after commas, and parentheses only where
+// precedence needs them. A program's top-level statements that span several
+// lines are set apart by blank lines.
+//
+// A hash literal stays on one line when it has at most three pairs and none
+// of them spans lines; otherwise each pair gets a line of its own, in
+// source order. Doc comments on let statements are kept, but other
+// comments aren't part of the tree and are lost.
+//
+// Parsing the output gives back the same tree.
+func Format(node Node) string {
+	f := &formatter{}
+
+	switch node := node.(type) {
+	case *Program:
+		return f.program(node)
+	case *BlockStatement:
+		return f.block(node)
+	case Statement:
+		return f.statement(node)
+	case Expression:
+		return f.expr(node)
+	}
+
+	return ""
+}
+
+type formatter struct {
+	depth int
+}
+
+func (f *formatter) indent() string {
+	return strings.Repeat("\t", f.depth)
+}
+
+func (f *formatter) program(program *Program) string {
+	var out strings.Builder
+
+	prevMultiline := false
+	for i, text := range f.statements(program.Statements) {
+		multiline := strings.Contains(text, "\n")
+		if i > 0 && (multiline || prevMultiline) {
+			out.WriteString("\n")
+		}
+		out.WriteString(text)
+		out.WriteString("\n")
+		prevMultiline = multiline
+	}
+
+	return out.String()
+}
+
+func (f *formatter) block(block *BlockStatement) string {
+	if block == nil || len(block.Statements) == 0 {
+		return "{}"
+	}
+
+	var out strings.Builder
+	out.WriteString("{\n")
+
+	f.depth++
+	for _, text := range f.statements(block.Statements) {
+		out.WriteString(f.indent())
+		out.WriteString(text)
+		out.WriteString("\n")
+	}
+	f.depth--
+
+	out.WriteString(f.indent())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// statements formats a statement list. An if or match statement ends in a
+// brace and needs no semicolon, unless the next statement starts with
+// something the parser would take as continuing the expression.
+func (f *formatter) statements(stmts []Statement) []string {
+	texts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		texts[i] = f.statement(stmt)
+	}
+
+	for i, stmt := range stmts {
+		es, ok := stmt.(*ExpressionStatement)
+		if !ok {
+			continue
+		}
+		switch es.Expression.(type) {
+		case *IfExpression, *MatchExpression:
+			if i+1 < len(texts) && texts[i+1] != "" && strings.IndexByte("-([", texts[i+1][0]) >= 0 {
+				texts[i] += ";"
+			}
+		default:
+			texts[i] += ";"
+		}
+	}
+
+	return texts
+}
+
+// statement formats stmt; an expression statement's semicolon is left to
+// statements.
+func (f *formatter) statement(stmt Statement) string {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		var out strings.Builder
+		if stmt.Doc != "" {
+			for _, line := range strings.Split(stmt.Doc, "\n") {
+				out.WriteString(strings.TrimRight("// "+line, " "))
+				out.WriteString("\n")
+				out.WriteString(f.indent())
+			}
+		}
+		out.WriteString("let " + stmt.Name.Value + " = " + f.expr(stmt.Value) + ";")
+		return out.String()
+
+	case *AssignStatement:
+		return stmt.Name.Value + " = " + f.expr(stmt.Value) + ";"
+
+	case *IncDecStatement:
+		return stmt.Name.Value + stmt.Operator + ";"
+
+	case *ReturnStatement:
+		if stmt.ReturnValue == nil {
+			return "return;"
+		}
+		return "return " + f.expr(stmt.ReturnValue) + ";"
+
+	case *WhileStatement:
+		return "while (" + f.expr(stmt.Condition) + ") " + f.block(stmt.Body)
+
+	case *ForInStatement:
+		return "for (" + stmt.Name.Value + " in " + f.expr(stmt.Iterable) + ") " + f.block(stmt.Body)
+
+	case *BreakStatement:
+		return "break;"
+
+	case *ContinueStatement:
+		return "continue;"
+
+	case *ExpressionStatement:
+		return f.expr(stmt.Expression)
+
+	case *BlockStatement:
+		return f.block(stmt)
+	}
+
+	return ""
+}
+
+func (f *formatter) expr(exp Expression) string {
+	switch exp := exp.(type) {
+	case nil:
+		return ""
+
+	case *Identifier:
+		return exp.Value
+
+	case *IntegerLiteral:
+		if exp.Token.Literal != "" {
+			return exp.Token.Literal
+		}
+		return strconv.FormatInt(exp.Value, 10)
+
+	case *FloatLiteral:
+		if exp.Token.Literal != "" {
+			return exp.Token.Literal
+		}
+		return strconv.FormatFloat(exp.Value, 'f', -1, 64)
+
+	case *Boolean:
+		return strconv.FormatBool(exp.Value)
+
+	case *StringLiteral:
+		return `"` + escapeString(exp.Value) + `"`
+
+	case *InterpolatedString:
+		var out strings.Builder
+		out.WriteString(`"`)
+		for _, part := range exp.Parts {
+			if text, ok := part.(*StringLiteral); ok {
+				out.WriteString(escapeString(text.Value))
+			} else {
+				out.WriteString("${" + f.expr(part) + "}")
+			}
+		}
+		out.WriteString(`"`)
+		return out.String()
+
+	case *PrefixExpression:
+		right := f.operand(exp.Right, precPrefix)
+		// -(-x) must keep its parentheses, as -- is the decrement operator.
+		if exp.Operator == "-" && strings.HasPrefix(right, "-") {
+			right = "(" + right + ")"
+		}
+		return exp.Operator + right
+
+	case *InfixExpression:
+		prec := infixPrecedences[exp.Operator]
+		// Operators group to the left, apart from **, which groups to the
+		// right; an operand on the other side at the same precedence needs
+		// parentheses.
+		left, right := prec, prec+1
+		if exp.Operator == "**" {
+			left, right = prec+1, prec
+		}
+		return f.operand(exp.Left, left) + " " + exp.Operator + " " + f.operand(exp.Right, right)
+
+	case *TernaryExpression:
+		return f.operand(exp.Condition, precTernary+1) + " ? " + f.expr(exp.Consequence) + " : " + f.expr(exp.Alternative)
+
+	case *IfExpression:
+		out := "if (" + f.expr(exp.Condition) + ") " + f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			out += " else " + f.block(exp.Alternative)
+		}
+		return out
+
+	case *FunctionLiteral:
+		params := make([]string, len(exp.Params))
+		for i, p := range exp.Params {
+			params[i] = p.Value
+		}
+		return "fn(" + strings.Join(params, ", ") + ") " + f.block(exp.Body)
+
+	case *CallExpression:
+		return f.operand(exp.Func, precPostfix) + "(" + f.list(exp.Args) + ")"
+
+	case *ArrayLiteral:
+		return "[" + f.list(exp.Elements) + "]"
+
+	case *IndexExpression:
+		return f.operand(exp.Left, precPostfix) + "[" + f.expr(exp.Index) + "]"
+
+	case *SliceExpression:
+		return f.operand(exp.Left, precPostfix) + "[" + f.expr(exp.Low) + ":" + f.expr(exp.High) + "]"
+
+	case *HashLiteral:
+		return f.hash(exp)
+
+	case *MatchExpression:
+		return f.match(exp)
+	}
+
+	return ""
+}
+
+// operand formats exp, parenthesized if it binds more loosely than min.
+func (f *formatter) operand(exp Expression, min int) string {
+	text := f.expr(exp)
+	if precedence(exp) < min {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func precedence(exp Expression) int {
+	switch exp := exp.(type) {
+	case *InfixExpression:
+		return infixPrecedences[exp.Operator]
+	case *TernaryExpression:
+		return precTernary
+	case *PrefixExpression:
+		return precPrefix
+	case *CallExpression, *IndexExpression, *SliceExpression:
+		return precPostfix
+	}
+	return precAtom
+}
+
+func (f *formatter) list(exps []Expression) string {
+	texts := make([]string, len(exps))
+	for i, exp := range exps {
+		texts[i] = f.expr(exp)
+	}
+	return strings.Join(texts, ", ")
+}
+
+func (f *formatter) hash(hash *HashLiteral) string {
+	pairs := hash.SortedPairs()
+	if len(pairs) == 0 {
+		return "{}"
+	}
+
+	if len(pairs) <= maxInlinePairs {
+		texts := make([]string, len(pairs))
+		for i, pair := range pairs {
+			texts[i] = f.expr(pair.Key) + ": " + f.expr(pair.Value)
+		}
+		if inline := strings.Join(texts, ", "); !strings.Contains(inline, "\n") {
+			return "{" + inline + "}"
+		}
+	}
+
+	var out strings.Builder
+	out.WriteString("{\n")
+
+	f.depth++
+	for _, pair := range pairs {
+		out.WriteString(f.indent())
+		out.WriteString(f.expr(pair.Key) + ": " + f.expr(pair.Value) + ",\n")
+	}
+	f.depth--
+
+	out.WriteString(f.indent())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+func (f *formatter) match(match *MatchExpression) string {
+	var out strings.Builder
+	out.WriteString("match (" + f.expr(match.Subject) + ") {\n")
+
+	f.depth++
+	for _, arm := range match.Arms {
+		out.WriteString(f.indent())
+		out.WriteString(f.expr(arm.Pattern))
+		if arm.Guard != nil {
+			out.WriteString(" if " + f.expr(arm.Guard))
+		}
+		out.WriteString(" => " + f.expr(arm.Body) + ",\n")
+	}
+	f.depth--
+
+	out.WriteString(f.indent())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+var stringEscapes = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\t", `\t`,
+	"\r", `\r`,
+	"${", `\${`,
+)
+
+// escapeString writes s with the escapes a string literal needs to read
+// back as s.
+func escapeString(s string) string {
+	return stringEscapes.Replace(s)
+}
@@ -0,0 +1,196 @@
+package ast
+
+import (
+	"encoding/json"
+
+	"github.com/connorjbarry/monkey/interpreter/token"
+)
+
+// ToJSON encodes node and everything below it as JSON, for tools that work
+// on parsed Monkey outside Go. Each node becomes an object holding its Go
+// type name as "type", its token's literal as "token" and, when the token
+// has a position, its "line" and "column", alongside its fields:
+//
+//	{"column": 1, "line": 1, "operator": "-",
+//	 "right": {"column": 2, "line": 1, "token": "5", "type": "IntegerLiteral", "value": 5},
+//	 "token": "-", "type": "PrefixExpression"}
+//
+// Fields are named as in Go, starting in lower case. Missing children, such
+// as the alternative of an if without an else, are null. A hash literal's
+// pairs become a list of {"key": ..., "value": ...} objects in source order.
+func ToJSON(node Node) ([]byte, error) {
+	return json.Marshal(jsonNode(node))
+}
+
+func jsonNode(node Node) any {
+	var (
+		kind   string
+		tok    token.Token
+		fields = map[string]any{}
+	)
+
+	switch node := node.(type) {
+	case nil:
+		return nil
+	case *Program:
+		return map[string]any{"type": "Program", "statements": jsonStatements(node.Statements)}
+	case *LetStatement:
+		kind, tok = "LetStatement", node.Token
+		fields["name"] = jsonNode(node.Name)
+		fields["value"] = jsonNode(node.Value)
+		fields["doc"] = node.Doc
+	case *AssignStatement:
+		kind, tok = "AssignStatement", node.Token
+		fields["name"] = jsonNode(node.Name)
+		fields["value"] = jsonNode(node.Value)
+	case *IncDecStatement:
+		kind, tok = "IncDecStatement", node.Token
+		fields["name"] = jsonNode(node.Name)
+		fields["operator"] = node.Operator
+	case *ReturnStatement:
+		kind, tok = "ReturnStatement", node.Token
+		fields["returnValue"] = jsonNode(node.ReturnValue)
+	case *WhileStatement:
+		kind, tok = "WhileStatement", node.Token
+		fields["condition"] = jsonNode(node.Condition)
+		fields["body"] = jsonBlock(node.Body)
+	case *ForInStatement:
+		kind, tok = "ForInStatement", node.Token
+		fields["name"] = jsonNode(node.Name)
+		fields["iterable"] = jsonNode(node.Iterable)
+		fields["body"] = jsonBlock(node.Body)
+	case *BreakStatement:
+		kind, tok = "BreakStatement", node.Token
+	case *ContinueStatement:
+		kind, tok = "ContinueStatement", node.Token
+	case *ExpressionStatement:
+		kind, tok = "ExpressionStatement", node.Token
+		fields["expression"] = jsonNode(node.Expression)
+	case *BlockStatement:
+		kind, tok = "BlockStatement", node.Token
+		fields["statements"] = jsonStatements(node.Statements)
+	case *Identifier:
+		kind, tok = "Identifier", node.Token
+		fields["value"] = node.Value
+	case *IntegerLiteral:
+		kind, tok = "IntegerLiteral", node.Token
+		fields["value"] = node.Value
+	case *FloatLiteral:
+		kind, tok = "FloatLiteral", node.Token
+		fields["value"] = node.Value
+	case *StringLiteral:
+		kind, tok = "StringLiteral", node.Token
+		fields["value"] = node.Value
+	case *Boolean:
+		kind, tok = "Boolean", node.Token
+		fields["value"] = node.Value
+	case *InterpolatedString:
+		kind, tok = "InterpolatedString", node.Token
+		fields["parts"] = jsonExpressions(node.Parts)
+	case *PrefixExpression:
+		kind, tok = "PrefixExpression", node.Token
+		fields["operator"] = node.Operator
+		fields["right"] = jsonNode(node.Right)
+	case *InfixExpression:
+		kind, tok = "InfixExpression", node.Token
+		fields["left"] = jsonNode(node.Left)
+		fields["operator"] = node.Operator
+		fields["right"] = jsonNode(node.Right)
+	case *IfExpression:
+		kind, tok = "IfExpression", node.Token
+		fields["condition"] = jsonNode(node.Condition)
+		fields["consequence"] = jsonBlock(node.Consequence)
+		fields["alternative"] = jsonBlock(node.Alternative)
+	case *TernaryExpression:
+		kind, tok = "TernaryExpression", node.Token
+		fields["condition"] = jsonNode(node.Condition)
+		fields["consequence"] = jsonNode(node.Consequence)
+		fields["alternative"] = jsonNode(node.Alternative)
+	case *FunctionLiteral:
+		kind, tok = "FunctionLiteral", node.Token
+		params := make([]any, len(node.Params))
+		for i, p := range node.Params {
+			params[i] = jsonNode(p)
+		}
+		fields["params"] = params
+		fields["body"] = jsonBlock(node.Body)
+		fields["doc"] = node.Doc
+	case *CallExpression:
+		kind, tok = "CallExpression", node.Token
+		fields["func"] = jsonNode(node.Func)
+		fields["args"] = jsonExpressions(node.Args)
+	case *ArrayLiteral:
+		kind, tok = "ArrayLiteral", node.Token
+		fields["elements"] = jsonExpressions(node.Elements)
+	case *IndexExpression:
+		kind, tok = "IndexExpression", node.Token
+		fields["left"] = jsonNode(node.Left)
+		fields["index"] = jsonNode(node.Index)
+	case *SliceExpression:
+		kind, tok = "SliceExpression", node.Token
+		fields["left"] = jsonNode(node.Left)
+		fields["low"] = jsonNode(node.Low)
+		fields["high"] = jsonNode(node.High)
+	case *HashLiteral:
+		kind, tok = "HashLiteral", node.Token
+		fields["pairs"] = jsonPairs(node)
+	case *MatchExpression:
+		kind, tok = "MatchExpression", node.Token
+		fields["subject"] = jsonNode(node.Subject)
+		arms := make([]any, len(node.Arms))
+		for i, arm := range node.Arms {
+			arms[i] = map[string]any{
+				"type":    "MatchArm",
+				"pattern": jsonNode(arm.Pattern),
+				"guard":   jsonNode(arm.Guard),
+				"body":    jsonNode(arm.Body),
+			}
+		}
+		fields["arms"] = arms
+	default:
+		return nil
+	}
+
+	fields["type"] = kind
+	fields["token"] = tok.Literal
+	if tok.Line > 0 {
+		fields["line"] = tok.Line
+		fields["column"] = tok.Column
+	}
+
+	return fields
+}
+
+// jsonBlock keeps a nil block null rather than letting it become a non-nil
+// Node holding a nil pointer.
+func jsonBlock(block *BlockStatement) any {
+	if block == nil {
+		return nil
+	}
+	return jsonNode(block)
+}
+
+func jsonStatements(stmts []Statement) []any {
+	out := make([]any, len(stmts))
+	for i, stmt := range stmts {
+		out[i] = jsonNode(stmt)
+	}
+	return out
+}
+
+func jsonExpressions(exprs []Expression) []any {
+	out := make([]any, len(exprs))
+	for i, expr := range exprs {
+		out[i] = jsonNode(expr)
+	}
+	return out
+}
+
+func jsonPairs(hash *HashLiteral) []any {
+	pairs := hash.SortedPairs()
+	out := make([]any, len(pairs))
+	for i, p := range pairs {
+		out[i] = map[string]any{"key": jsonNode(p.Key), "value": jsonNode(p.Value)}
+	}
+	return out
+}
@@ -0,0 +1,74 @@
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders msg together with the offending line of source and a caret
+// under the given column, in the style of gcc and rustc:
+//
+//	2:9: unexpected token
+//	  2 | let x = ;
+//	    |         ^
+//
+// Lines and columns are 1-based; a column counts bytes from the start of the
+// line, matching token positions. If line is outside the source only the
+// position and message are returned.
+func Format(source string, line, col int, msg string) string {
+	out := fmt.Sprintf("%d:%d: %s", line, col, msg)
+
+	if context := Context(source, line, col); context != "" {
+		out += "\n" + context
+	}
+
+	return out
+}
+
+// Context returns just the part of Format's output after the message: the
+// line of source and the caret beneath it, or "" if line is outside the
+// source. It is for pointing at a position whose message is printed
+// separately, such as the call a stack trace started from.
+func Context(source string, line, col int) string {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	text := strings.TrimRight(lines[line-1], "\r")
+	gutter := fmt.Sprintf("%3d | ", line)
+
+	var out strings.Builder
+	out.WriteString(gutter)
+	out.WriteString(text)
+	out.WriteString("\n")
+	out.WriteString(strings.Repeat(" ", len(gutter)-2))
+	out.WriteString("| ")
+	out.WriteString(caretPadding(text, col))
+	out.WriteString("^")
+
+	return out.String()
+}
+
+// caretPadding returns the whitespace that lines a caret up under the byte at
+// col, reusing tabs from the source line so the alignment survives any tab
+// width and counting multi-byte characters as a single column.
+func caretPadding(text string, col int) string {
+	if col > len(text)+1 {
+		col = len(text) + 1
+	}
+	if col < 1 {
+		col = 1
+	}
+
+	var pad strings.Builder
+	for _, r := range text[:col-1] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+
+	return pad.String()
+}
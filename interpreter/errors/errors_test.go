@@ -0,0 +1,70 @@
+package errors
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	source := "let x = 5;\nlet y = x +;\nlet z = 1;"
+
+	tests := []struct {
+		line     int
+		col      int
+		msg      string
+		expected string
+	}{
+		{
+			2, 12, "no prefix parse function found for ;",
+			"2:12: no prefix parse function found for ;\n" +
+				"  2 | let y = x +;\n" +
+				"    |            ^",
+		},
+		{
+			1, 1, "start",
+			"1:1: start\n" +
+				"  1 | let x = 5;\n" +
+				"    | ^",
+		},
+		{
+			3, 11, "end of line",
+			"3:11: end of line\n" +
+				"  3 | let z = 1;\n" +
+				"    |           ^",
+		},
+		{
+			4, 1, "past the end",
+			"4:1: past the end",
+		},
+	}
+
+	for _, tt := range tests {
+		got := Format(source, tt.line, tt.col, tt.msg)
+		if got != tt.expected {
+			t.Errorf("wrong output for %d:%d.\nexpected:\n%s\ngot:\n%s", tt.line, tt.col, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatTabsAndUnicode(t *testing.T) {
+	source := "\tlet s = \"héllo\" + ;"
+
+	got := Format(source, 1, 21, "bad")
+	expected := "1:21: bad\n" +
+		"  1 | \tlet s = \"héllo\" + ;\n" +
+		"    | \t                  ^"
+
+	if got != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestContext(t *testing.T) {
+	source := "let x = 5;\nf(x);"
+
+	expected := "  2 | f(x);\n    |  ^"
+	if got := Context(source, 2, 2); got != expected {
+		t.Errorf("wrong context.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	if got := Context(source, 3, 1); got != "" {
+		t.Errorf("context past the end should be empty. got=%q", got)
+	}
+}
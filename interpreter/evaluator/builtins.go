@@ -1,20 +1,194 @@
 package evaluator
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/connorjbarry/monkey/interpreter/object"
 )
 
+// builtins are the standard builtins. Each one marked Pure or Callback is
+// trusted as such by analyze.IsPure, so mark one only if it prints nothing,
+// reads no outside state and mutates none of its arguments.
 var builtins = map[string]*object.BuiltIn{
-	"len":   {Fn: lenFunc},
-	"first": {Fn: firstFunc},
-	"last":  {Fn: lastFunc},
-	"rest":  {Fn: restFunc},
-	"push":  {Fn: pushFunc},
-	"puts":  {Fn: putsFunc},
+	"len":   {Fn: lenFunc, Pure: true},
+	"first": {Fn: firstFunc, Pure: true},
+	"last":  {Fn: lastFunc, Pure: true},
+	"rest":  {Fn: restFunc, Pure: true},
+	"push":  {Fn: pushFunc, Pure: true},
+
+	"is_null": {Fn: isNullFunc, Pure: true},
+	"default": {Fn: defaultFunc, Pure: true},
+	"type":    {Fn: typeFunc, Pure: true},
+
+	"wrap_error": {Fn: wrapErrorFunc},
+	"is_error":   {Fn: isErrorFunc, Pure: true},
+	"cause":      {Fn: causeFunc, Pure: true},
+
+	"time_format": {Fn: timeFormatFunc},
+	"year":        {Fn: timeFieldFunc("year", func(t time.Time) int { return t.Year() }), Pure: true},
+	"month":       {Fn: timeFieldFunc("month", func(t time.Time) int { return int(t.Month()) }), Pure: true},
+	"day":         {Fn: timeFieldFunc("day", func(t time.Time) int { return t.Day() }), Pure: true},
+	"hour":        {Fn: timeFieldFunc("hour", func(t time.Time) int { return t.Hour() }), Pure: true},
+	"minute":      {Fn: timeFieldFunc("minute", func(t time.Time) int { return t.Minute() }), Pure: true},
+	"second":      {Fn: timeFieldFunc("second", func(t time.Time) int { return t.Second() }), Pure: true},
+	"weekday":     {Fn: timeFieldFunc("weekday", func(t time.Time) int { return int(t.Weekday()) }), Pure: true},
+
+	"get":          {Fn: getFunc, Pure: true},
+	"set":          {Fn: setFunc},
+	"delete":       {Fn: deleteFunc, Pure: true},
+	"merge":        {Fn: mergeFunc, Pure: true},
+	"entries":      {Fn: entriesFunc, Pure: true},
+	"keys":         {Fn: hashPartFunc("keys", func(pair object.HashPair) object.Object { return pair.Key }), Pure: true},
+	"values":       {Fn: hashPartFunc("values", func(pair object.HashPair) object.Object { return pair.Value }), Pure: true},
+	"from_entries": {Fn: fromEntriesFunc, Pure: true},
+	"frequencies":  {Fn: frequenciesFunc, Pure: true},
+	"invert":       {Fn: invertFunc, Pure: true},
+
+	"lower":              {Fn: stringCaseFunc("lower", strings.ToLower), Pure: true},
+	"upper":              {Fn: stringCaseFunc("upper", strings.ToUpper), Pure: true},
+	"equals_ignore_case": {Fn: equalsIgnoreCaseFunc, Pure: true},
+	"split":              {Fn: splitFunc, Pure: true},
+	"join":               {Fn: joinFunc, Pure: true},
+	"lines":              {Fn: stringSplitterFunc("lines", splitLines), Pure: true},
+	"words":              {Fn: stringSplitterFunc("words", strings.Fields), Pure: true},
+
+	"int":     {Fn: intFunc, Pure: true},
+	"to_int":  {Fn: toIntFunc, Pure: true},
+	"idivmod": {Fn: idivmodFunc, Pure: true},
+	"sat_add": {Fn: saturatingFunc("sat_add", (*big.Int).Add), Pure: true},
+	"sat_sub": {Fn: saturatingFunc("sat_sub", (*big.Int).Sub), Pure: true},
+	"sat_mul": {Fn: saturatingFunc("sat_mul", (*big.Int).Mul), Pure: true},
+
+	"slice":   {Fn: sliceFunc, Pure: true},
+	"rotate":  {Fn: rotateFunc, Pure: true},
+	"bsearch": {Fn: bsearchFunc, Pure: true},
+	"fill":    {Fn: fillFunc, Pure: true},
+	"range":   {Fn: rangeFunc, Pure: true},
+
+	"transpose": {Fn: transposeFunc, Pure: true},
+
+	"to_json": {Fn: toJSONFunc, Pure: true},
+
+	"serialize":   {Fn: serializeFunc, Pure: true},
+	"deserialize": {Fn: deserializeFunc, Pure: true},
+}
+
+// scopedBuiltins are builtins that need the scope they are called from,
+// because what they do depends on its modes: filter keeps what the scope's
+// truthiness counts as true, sum adds as the scope's + does, puts prints
+// floats with the scope's precision and time_now reads the scope's clock.
+// Modes belong to the global scope, so lookupBuiltin binds each one to the
+// caller's global scope, once, and hands out that same builtin after.
+var scopedBuiltins = map[string]scopedBuiltin{
+	"puts":          {fn: putsFunc},
+	"str":           {fn: strFunc, pure: true},
+	"format":        {fn: formatFunc, pure: true},
+	"template":      {fn: templateFunc, pure: true},
+	"set_precision": {fn: setPrecisionFunc},
+	"time_now":      {fn: timeNowFunc},
+}
+
+// scopedBuiltin is a builtin before it is bound to a scope, with the flags
+// the bound object.BuiltIn is given.
+type scopedBuiltin struct {
+	fn          func(env *object.Env, args ...object.Object) object.Object
+	pure        bool
+	callback    bool
+	callbackArg int
+}
+
+// Builtins that call back into user functions go through applyFunction,
+// which reaches the builtins map via Eval; registering them here rather than
+// in the literal above avoids an initialization cycle. The vector builtins
+// and contains are here too, since infix operators can call overloads
+// defined in Monkey.
+func init() {
+	builtins["sort_by"] = &object.BuiltIn{Fn: sortByFunc, Callback: true, CallbackArg: 1}
+	builtins["bsearch_by"] = &object.BuiltIn{Fn: bsearchByFunc, Callback: true, CallbackArg: 2}
+	builtins["map"] = &object.BuiltIn{Fn: mapFunc, Callback: true, CallbackArg: 1}
+	scopedBuiltins["filter"] = scopedBuiltin{fn: filterFunc, callback: true, callbackArg: 1}
+	builtins["reduce"] = &object.BuiltIn{Fn: reduceFunc, Callback: true, CallbackArg: 2}
+	scopedBuiltins["partition"] = scopedBuiltin{fn: partitionFunc, callback: true, callbackArg: 1}
+	scopedBuiltins["take_while"] = scopedBuiltin{fn: takeWhileFunc, callback: true, callbackArg: 1}
+	scopedBuiltins["drop_while"] = scopedBuiltin{fn: dropWhileFunc, callback: true, callbackArg: 1}
+	builtins["flat_map"] = &object.BuiltIn{Fn: flatMapFunc, Callback: true, CallbackArg: 1}
+	builtins["fill_with"] = &object.BuiltIn{Fn: fillWithFunc, Callback: true, CallbackArg: 1}
+	builtins["get_or_else"] = &object.BuiltIn{Fn: getOrElseFunc, Callback: true, CallbackArg: 2}
+	builtins["new"] = &object.BuiltIn{Fn: newFunc}
+	builtins["try"] = &object.BuiltIn{Fn: tryFunc, Callback: true, CallbackArg: 0}
+
+	scopedBuiltins["vec_add"] = scopedBuiltin{fn: vecAddFunc, pure: true}
+	scopedBuiltins["vec_scale"] = scopedBuiltin{fn: vecScaleFunc, pure: true}
+	scopedBuiltins["dot"] = scopedBuiltin{fn: dotFunc, pure: true}
+	scopedBuiltins["matmul"] = scopedBuiltin{fn: matmulFunc, pure: true}
+	scopedBuiltins["sum"] = scopedBuiltin{fn: sumFunc, pure: true}
+	scopedBuiltins["product"] = scopedBuiltin{fn: productFunc, pure: true}
+	scopedBuiltins["average"] = scopedBuiltin{fn: averageFunc, pure: true}
+	scopedBuiltins["contains"] = scopedBuiltin{fn: containsFunc, pure: true}
+}
+
+// SetClock makes `time_now` read the time from now in programs evaluated in
+// env or any scope sharing its global scope, so tests and embedders can
+// make time-dependent programs deterministic. It returns the previous time
+// source so callers can restore it; nil means the system clock.
+func SetClock(env *object.Env, now func() time.Time) func() time.Time {
+	modes := env.Modes()
+	prev := modes.Clock
+	modes.Clock = now
+	return prev
+}
+
+// SetOutput redirects `puts` to w in programs evaluated in env or any scope
+// sharing its global scope, so embedders and tests can capture what a
+// program prints. It returns the previous writer so callers can restore it;
+// nil means standard output.
+func SetOutput(env *object.Env, w io.Writer) io.Writer {
+	modes := env.Modes()
+	prev := modes.Output
+	modes.Output = w
+	return prev
+}
+
+// output returns where puts writes in env.
+func output(env *object.Env) io.Writer {
+	if w := env.Modes().Output; w != nil {
+		return w
+	}
+	return os.Stdout
+}
+
+// setPrecisionFunc sets how many decimal places floats print with in the
+// calling program, or goes back to the shortest form when given a negative
+// number, and returns the previous setting.
+func setPrecisionFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	n, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument to `set_precision` must be INTEGER, got %s", args[0].Type())
+	}
+	if n.Value > maxFloatPrecision {
+		return newError("precision passed to `set_precision` is too large: %d > %d", n.Value, maxFloatPrecision)
+	}
+
+	return &object.Integer{Value: int64(SetFloatPrecision(env, int(max(n.Value, -1))))}
 }
 
+// maxFloatPrecision bounds set_precision, beyond which a float64 has no
+// more digits to show.
+const maxFloatPrecision = 100
+
 func lenFunc(args ...object.Object) object.Object {
 	if len(args) != 1 {
 		return newError("wrong number of arguments. got=%d, want=1", len(args))
@@ -108,9 +282,1536 @@ func pushFunc(args ...object.Object) object.Object {
 
 }
 
-func putsFunc(args ...object.Object) object.Object {
+func isNullFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return nativeBoolToBooleanObject(args[0] == NULL)
+}
+
+// typeFunc returns the name of its argument's type, as in type([]) == "ARRAY".
+// An ERROR never reaches it from Monkey code, since evaluating the argument
+// stops at the error, but Go callers may pass one and get "ERROR".
+func typeFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	return &object.String{Value: string(args[0].Type())}
+}
+
+// wrapErrorFunc implements `wrap_error(msg, cause)`, returning an error
+// that wraps cause with msg as context. cause is an error caught by try, or
+// a STRING, which becomes an error of its own; Go callers can also pass an
+// ERROR directly.
+func wrapErrorFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	msg, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `wrap_error` must be STRING, got %s", args[0].Type())
+	}
+
+	switch cause := args[1].(type) {
+	case *object.Error:
+		return object.WrapError(msg.Value, cause)
+	case *object.Caught:
+		return object.WrapError(msg.Value, cause.Err)
+	case *object.String:
+		return object.WrapError(msg.Value, &object.Error{Message: cause.Value})
+	default:
+		return newError("second argument to `wrap_error` must be CAUGHT_ERROR or STRING, got %s", args[1].Type())
+	}
+}
+
+// tryFunc implements `try(fn, args...)`, calling fn with args. If the call
+// fails, the error is returned as a CAUGHT_ERROR value instead of stopping
+// the program, so it can be checked with is_error and unwrapped with cause:
+//
+//	let res = try(fn() { wrap_error("loading config", "file missing") });
+//	if (is_error(res)) { puts(cause(res)) }
+func tryFunc(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	if !isCallable(args[0]) {
+		return newError("first argument to `try` must be FUNCTION, got %s", args[0].Type())
+	}
+
+	res := applyFunction(args[0], args[1:])
+	if err, ok := res.(*object.Error); ok {
+		return &object.Caught{Err: err}
+	}
+
+	return res
+}
+
+// isErrorFunc reports whether its argument is an error caught by try.
+func isErrorFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	_, ok := args[0].(*object.Caught)
+	return nativeBoolToBooleanObject(ok)
+}
+
+// causeFunc implements `cause(err)`, returning the error a caught error
+// wraps, itself as a caught error, or NULL if it wraps none.
+func causeFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	caught, ok := args[0].(*object.Caught)
+	if !ok {
+		return newError("argument to `cause` must be CAUGHT_ERROR, got %s", args[0].Type())
+	}
+
+	if caught.Err.Cause == nil {
+		return NULL
+	}
+
+	return &object.Caught{Err: caught.Err.Cause}
+}
+
+// defaultFunc returns its second argument when the first is NULL, so a miss
+// like default(h["k"], 0) can be given a fallback in one expression.
+func defaultFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	if args[0] == NULL {
+		return args[1]
+	}
+
+	return args[0]
+}
+
+// getFunc implements `get(hash, key, default)`, which is hash[key] when key
+// is present and default when it isn't. Unlike default(hash[key], x), it
+// tells a missing key from one holding NULL.
+func getFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	val, ok, err := lookupKey("get", args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return args[2]
+	}
+
+	return val
+}
+
+// getOrElseFunc implements `get_or_else(hash, key, fn)`. It is get with a
+// default computed by calling fn with no arguments, which happens only when
+// key is missing.
+func getOrElseFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	if !isCallable(args[2]) {
+		return newError("third argument to `get_or_else` must be FUNCTION, got %s", args[2].Type())
+	}
+
+	val, ok, err := lookupKey("get_or_else", args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return applyFunction(args[2], nil)
+	}
+
+	return val
+}
+
+// lookupKey finds key in hash for the builtin called name.
+func lookupKey(name string, hash, key object.Object) (object.Object, bool, *object.Error) {
+	h, ok := hash.(*object.Hash)
+	if !ok {
+		return nil, false, newError("first argument to `%s` must be HASH, got %s", name, hash.Type())
+	}
+
+	hk, ok := object.AsHashKey(key)
+	if !ok {
+		return nil, false, unusableKeyError(key)
+	}
+
+	pair, ok := h.Pairs[hk]
+	return pair.Value, ok, nil
+}
+
+// setFunc stores value under key in hash, changing the hash in place, and
+// returns value. It is the one builtin that mutates its argument: every
+// reference to the hash sees the change, which is what lets methods bound
+// by `new` update their object's fields. A value holding the hash itself,
+// directly or inside arrays and hashes, is rejected: the hash would contain
+// itself, and printing or copying it would never end.
+func setFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("first argument to `set` must be HASH, got %s", args[0].Type())
+	}
+
+	key, ok := object.AsHashKey(args[1])
+	if !ok {
+		return unusableKeyError(args[1])
+	}
+
+	if holds(args[2], hash) {
+		return newError("value passed to `set` contains the hash it is stored in")
+	}
+
+	hash.Pairs[key] = object.HashPair{Key: args[1], Value: args[2]}
+
+	return args[2]
+}
+
+// holds reports whether obj is target or has it among the elements of its
+// arrays and the values of its hashes, at any depth.
+func holds(obj object.Object, target *object.Hash) bool {
+	switch obj := obj.(type) {
+	case *object.Hash:
+		if obj == target {
+			return true
+		}
+		for _, pair := range obj.Pairs {
+			if holds(pair.Value, target) {
+				return true
+			}
+		}
+	case *object.Array:
+		for _, el := range obj.Elements {
+			if holds(el, target) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// deleteFunc implements `delete(coll, key)`. Like push it leaves its argument
+// alone and returns a new collection: for a hash, a copy without key; for an
+// array, a copy without the element at index key, where a negative index
+// counts from the end. A key or index that isn't there gives an unchanged
+// copy.
+func deleteFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	switch coll := args[0].(type) {
+	case *object.Hash:
+		key, ok := object.AsHashKey(args[1])
+		if !ok {
+			return unusableKeyError(args[1])
+		}
+
+		pairs := make(map[object.HashKey]object.HashPair, len(coll.Pairs))
+		for hk, pair := range coll.Pairs {
+			if hk != key {
+				pairs[hk] = pair
+			}
+		}
+		return &object.Hash{Pairs: pairs}
+
+	case *object.Array:
+		index, ok := args[1].(*object.Integer)
+		if !ok {
+			return newError("index to `delete` must be INTEGER, got %s", args[1].Type())
+		}
+
+		idx := fromEnd(index.Value, len(coll.Elements))
+		if idx < 0 || idx >= int64(len(coll.Elements)) {
+			return &object.Array{Elements: sliceElements(coll.Elements, 0, int64(len(coll.Elements)))}
+		}
+
+		newEls := make([]object.Object, 0, len(coll.Elements)-1)
+		newEls = append(newEls, coll.Elements[:idx]...)
+		newEls = append(newEls, coll.Elements[idx+1:]...)
+		return &object.Array{Elements: newEls}
+
+	default:
+		return newError("first argument to `delete` must be HASH or ARRAY, got %s", args[0].Type())
+	}
+}
+
+// newFunc builds an object by calling a constructor that returns a hash of
+// fields and methods. Each function in the hash becomes a method: a copy of
+// it whose environment binds `self` to the hash, so methods can read fields
+// with self["field"] and update them with set(self, "field", value).
+//
+//	let Counter = fn(n) { {"n": n, "inc": fn() { set(self, "n", self["n"] + 1) }} };
+//	let c = new(Counter, 0);
+//	c["inc"]();
+func newFunc(args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	obj := applyFunction(args[0], args[1:])
+	if isError(obj) {
+		return obj
+	}
+
+	self, ok := obj.(*object.Hash)
+	if !ok {
+		return newError("constructor passed to `new` must return HASH, got %s", obj.Type())
+	}
+
+	for hk, pair := range self.Pairs {
+		fn, ok := pair.Value.(*object.Function)
+		if !ok {
+			continue
+		}
+
+		env := object.NewClosedEnv(fn.Env)
+		env.Set("self", self)
+		method := &object.Function{Params: fn.Params, Body: fn.Body, Env: env, Reassigns: fn.Reassigns}
+		self.Pairs[hk] = object.HashPair{Key: pair.Key, Value: method}
+	}
+
+	return self
+}
+
+func mergeFunc(args ...object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, arg := range args {
+		hash, ok := arg.(*object.Hash)
+		if !ok {
+			return newError("argument %d to `merge` must be HASH, got %s", i+1, arg.Type())
+		}
+
+		for key, pair := range hash.Pairs {
+			pairs[key] = pair
+		}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+func entriesFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if args[0].Type() != object.HASH_OBJ {
+		return newError("argument to `entries` must be HASH, got %s", args[0].Type())
+	}
+
+	pairs := args[0].(*object.Hash).SortedPairs()
+	els := make([]object.Object, len(pairs))
+
+	for i, pair := range pairs {
+		els[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+	}
+
+	return &object.Array{Elements: els}
+}
+
+// invertFunc implements `invert(hash)`, returning a new hash mapping each
+// value to its key. Every value must be usable as a key. When values repeat,
+// the key that comes last in the hash's sorted order wins, as it would had
+// the pairs been set one by one in that order.
+func invertFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return newError("argument to `invert` must be HASH, got %s", args[0].Type())
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair, len(hash.Pairs))
+	for _, pair := range hash.SortedPairs() {
+		key, ok := object.AsHashKey(pair.Value)
+		if !ok {
+			return unusableKeyError(pair.Value)
+		}
+		pairs[key] = object.HashPair{Key: pair.Value, Value: pair.Key}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// hashPartFunc builds `keys` and `values`, which return one part of each of
+// a hash's pairs as an array, in the hash's sorted key order. The two agree
+// with each other and with `entries`, so keys(h)[i] maps to values(h)[i].
+func hashPartFunc(name string, part func(object.HashPair) object.Object) object.BuiltInFns {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != object.HASH_OBJ {
+			return newError("argument to `%s` must be HASH, got %s", name, args[0].Type())
+		}
+
+		pairs := args[0].(*object.Hash).SortedPairs()
+		els := make([]object.Object, len(pairs))
+
+		for i, pair := range pairs {
+			els[i] = part(pair)
+		}
+
+		return &object.Array{Elements: els}
+	}
+}
+
+func fromEntriesFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError("argument to `from_entries` must be ARRAY, got %s", args[0].Type())
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i, el := range args[0].(*object.Array).Elements {
+		entry, ok := el.(*object.Array)
+		if !ok || len(entry.Elements) != 2 {
+			return newError("entry %d to `from_entries` must be a [key, value] ARRAY, got %s", i, el.Inspect())
+		}
+
+		key, ok := object.AsHashKey(entry.Elements[0])
+		if !ok {
+			return unusableKeyError(entry.Elements[0])
+		}
+
+		pairs[key] = object.HashPair{Key: entry.Elements[0], Value: entry.Elements[1]}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+// containsFunc implements `contains(collection, item)`, the builtin form
+// of `item in collection`.
+func containsFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	return evalInExpression(args[1], args[0], env)
+}
+
+// frequenciesFunc counts the occurrences of each distinct element of an
+// array, returning a hash from element to count. Like every hash, the result
+// iterates in sorted key order, not the order elements were first seen.
+func frequenciesFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError("argument to `frequencies` must be ARRAY, got %s", args[0].Type())
+	}
+
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, el := range args[0].(*object.Array).Elements {
+		hk, ok := object.AsHashKey(el)
+		if !ok {
+			return unusableKeyError(el)
+		}
+
+		count := int64(1)
+		if pair, ok := pairs[hk]; ok {
+			count += pair.Value.(*object.Integer).Value
+		}
+		pairs[hk] = object.HashPair{Key: el, Value: &object.Integer{Value: count}}
+	}
+
+	return &object.Hash{Pairs: pairs}
+}
+
+func stringCaseFunc(name string, convert func(string) string) object.BuiltInFns {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != object.STRING_OBJ {
+			return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+
+		return &object.String{Value: convert(args[0].(*object.String).Value)}
+	}
+}
+
+// equalsIgnoreCaseFunc compares two strings under Unicode case folding, so
+// e.g. "ß" does not match "ss" but "Σ" matches both "σ" and "ς".
+func equalsIgnoreCaseFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
 	for _, arg := range args {
-		fmt.Println(arg.Inspect())
+		if arg.Type() != object.STRING_OBJ {
+			return newError("arguments to `equals_ignore_case` must be STRING, got %s", arg.Type())
+		}
+	}
+
+	a := args[0].(*object.String).Value
+	b := args[1].(*object.String).Value
+
+	return nativeBoolToBooleanObject(strings.EqualFold(a, b))
+}
+
+// splitFunc implements `split(s, sep)`, returning the substrings of s
+// between each occurrence of sep. An empty sep splits s into its
+// characters.
+func splitFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	for _, arg := range args {
+		if arg.Type() != object.STRING_OBJ {
+			return newError("arguments to `split` must be STRING, got %s", arg.Type())
+		}
+	}
+
+	parts := strings.Split(args[0].(*object.String).Value, args[1].(*object.String).Value)
+
+	els := make([]object.Object, len(parts))
+	for i, part := range parts {
+		els[i] = &object.String{Value: part}
+	}
+
+	return &object.Array{Elements: els}
+}
+
+// stringSplitterFunc makes a builtin taking one STRING and returning the
+// pieces split returns as an array of strings.
+func stringSplitterFunc(name string, split func(string) []string) object.BuiltInFns {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != object.STRING_OBJ {
+			return newError("argument to `%s` must be STRING, got %s", name, args[0].Type())
+		}
+
+		parts := split(args[0].(*object.String).Value)
+
+		els := make([]object.Object, len(parts))
+		for i, part := range parts {
+			els[i] = &object.String{Value: part}
+		}
+
+		return &object.Array{Elements: els}
+	}
+}
+
+// splitLines splits s into lines ending in "\n" or "\r\n", without their
+// endings. A final line ending doesn't start another line, so "a\n" is
+// one line and "" is none.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines
+}
+
+// joinFunc implements `join(arr, sep)`, the inverse of split: the elements
+// of arr, which must all be strings, concatenated with sep between them.
+func joinFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `join` must be ARRAY, got %s", args[0].Type())
+	}
+
+	sep, ok := args[1].(*object.String)
+	if !ok {
+		return newError("second argument to `join` must be STRING, got %s", args[1].Type())
+	}
+
+	parts := make([]string, len(arr.Elements))
+	for i, el := range arr.Elements {
+		str, ok := el.(*object.String)
+		if !ok {
+			return newError("element %d to `join` must be STRING, got %s", i, el.Type())
+		}
+		parts[i] = str.Value
+	}
+
+	return &object.String{Value: strings.Join(parts, sep.Value)}
+}
+
+// intFunc converts its argument to an INTEGER. Integers pass through,
+// strings are parsed as by parseIntString and floats are truncated toward
+// zero, so int(-2.7) is -2.
+func intFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg
+
+	case *object.Float:
+		val := math.Trunc(arg.Value)
+		if math.IsNaN(val) || val < math.MinInt64 || val >= math.MaxInt64 {
+			return newError("float %s out of range for integer", arg.Inspect())
+		}
+		return &object.Integer{Value: int64(val)}
+
+	case *object.String:
+		val, ok := parseIntString(arg.Value)
+		if !ok {
+			return newError("could not parse %q as integer", arg.Value)
+		}
+		return &object.Integer{Value: val}
+
+	default:
+		return newError("argument to `int` not supported, got %s", arg.Type())
+	}
+}
+
+// toIntFunc is int extended to booleans: to_int(true) is 1 and
+// to_int(false) is 0. Arithmetic never converts a boolean on its own, so
+// counting with one has to go through here.
+func toIntFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Boolean:
+		if arg.Value {
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: 0}
+
+	case *object.Integer, *object.Float, *object.String:
+		return intFunc(arg)
+
+	default:
+		return newError("argument to `to_int` not supported, got %s", arg.Type())
+	}
+}
+
+// strFunc returns any value as puts would print it, as a STRING, so
+// str(12) + "px" is "12px". A string comes back unchanged.
+func strFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if str, ok := args[0].(*object.String); ok {
+		return str
+	}
+
+	return &object.String{Value: displayString(args[0], env)}
+}
+
+// parseIntString parses s with the same rules the lexer applies to integer
+// literals, additionally allowing surrounding whitespace and a leading sign.
+// The base is detected from the prefix ("0x", "0b", "0o" or a bare leading
+// "0" for octal) and underscores may only separate digits.
+func parseIntString(s string) (int64, bool) {
+	val, err := strconv.ParseInt(strings.TrimSpace(s), 0, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return val, true
+}
+
+// idivmodFunc implements `idivmod(a, b)`, returning [a / b, a % b] from a
+// single call. Both follow the `/` and `%` operators: the quotient truncates
+// toward zero and the remainder takes the sign of a, so q * b + r == a.
+func idivmodFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	a, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("first argument to `idivmod` must be INTEGER, got %s", args[0].Type())
+	}
+
+	b, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("second argument to `idivmod` must be INTEGER, got %s", args[1].Type())
+	}
+
+	if b.Value == 0 {
+		return newError("division by zero")
+	}
+
+	q, r := a.Value/b.Value, a.Value%b.Value
+
+	return &object.Array{Elements: []object.Object{&object.Integer{Value: q}, &object.Integer{Value: r}}}
+}
+
+// saturatingFunc makes a builtin `name(a, b, lo, hi)` that applies op to the
+// integers a and b and clamps the exact result to [lo, hi], so that rather
+// than wrapping around like the operators, a result out of range sticks at
+// the nearer bound.
+func saturatingFunc(name string, op func(z, x, y *big.Int) *big.Int) object.BuiltInFns {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 4 {
+			return newError("wrong number of arguments. got=%d, want=4", len(args))
+		}
+
+		vals := make([]int64, len(args))
+		for i, arg := range args {
+			n, ok := arg.(*object.Integer)
+			if !ok {
+				return newError("arguments to `%s` must be INTEGER, got %s", name, arg.Type())
+			}
+			vals[i] = n.Value
+		}
+
+		lo, hi := vals[2], vals[3]
+		if lo > hi {
+			return newError("bounds passed to `%s` are reversed: %d > %d", name, lo, hi)
+		}
+
+		res := op(new(big.Int), big.NewInt(vals[0]), big.NewInt(vals[1]))
+		switch {
+		case res.Cmp(big.NewInt(lo)) < 0:
+			return &object.Integer{Value: lo}
+		case res.Cmp(big.NewInt(hi)) > 0:
+			return &object.Integer{Value: hi}
+		}
+
+		return &object.Integer{Value: res.Int64()}
+	}
+}
+
+// rotateFunc implements `rotate(arr, n)`, returning a copy of arr rotated
+// left by n places, or right by -n when n is negative. n is taken modulo the
+// length, so rotating by any multiple of it gives an unchanged copy.
+func rotateFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `rotate` must be ARRAY, got %s", args[0].Type())
+	}
+
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return newError("second argument to `rotate` must be INTEGER, got %s", args[1].Type())
+	}
+
+	length := int64(len(arr.Elements))
+	if length == 0 {
+		return &object.Array{Elements: []object.Object{}}
+	}
+
+	shift := (n.Value%length + length) % length
+	els := make([]object.Object, 0, length)
+	els = append(els, arr.Elements[shift:]...)
+	els = append(els, arr.Elements[:shift]...)
+
+	return &object.Array{Elements: els}
+}
+
+func sliceFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError("first argument to `slice` must be ARRAY, got %s", args[0].Type())
+	}
+
+	if args[1].Type() != object.INTEGER_OBJ || args[2].Type() != object.INTEGER_OBJ {
+		return newError("bounds to `slice` must be INTEGER, got %s and %s", args[1].Type(), args[2].Type())
+	}
+
+	arr := args[0].(*object.Array)
+	low := args[1].(*object.Integer).Value
+	high := args[2].(*object.Integer).Value
+
+	return &object.Array{Elements: sliceElements(arr.Elements, low, high)}
+}
+
+// sliceElements returns a copy of els[low:high] with both bounds clamped to
+// the slice. Sub-arrays never share a backing array with their source, so
+// mutating one can't be observed through the other.
+func sliceElements(els []object.Object, low, high int64) []object.Object {
+	length := int64(len(els))
+
+	low = max(0, min(low, length))
+	high = max(low, min(high, length))
+
+	newEls := make([]object.Object, high-low)
+	copy(newEls, els[low:high])
+
+	return newEls
+}
+
+// fillFunc returns an array of n copies of value. Arrays and hashes are
+// deep-copied, so the elements never share structure with each other or
+// with value.
+func fillFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	n, err := fillCount("fill", args[0])
+	if err != nil {
+		return err
+	}
+
+	els := make([]object.Object, n)
+	for i := range els {
+		els[i] = deepCopy(args[1])
+	}
+
+	return &object.Array{Elements: els}
+}
+
+// fillWithFunc returns an array of n elements where element i is fn(i).
+func fillWithFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	n, err := fillCount("fill_with", args[0])
+	if err != nil {
+		return err
+	}
+
+	els := make([]object.Object, n)
+	for i := range els {
+		el := applyFunction(args[1], []object.Object{&object.Integer{Value: int64(i)}})
+		if isError(el) {
+			return el
+		}
+		els[i] = el
+	}
+
+	return &object.Array{Elements: els}
+}
+
+// rangeFunc implements `range(end)`, `range(start, end)` and
+// `range(start, end, step)`, returning the integers from start, which
+// defaults to 0, up to but not including end. A negative step counts down,
+// so range(3, 0, -1) is [3, 2, 1]; a range that never reaches end is empty.
+func rangeFunc(args ...object.Object) object.Object {
+	start, step, n, err := rangeSpan(args)
+	if err != nil {
+		return err
+	}
+
+	if n > maxArrayLength {
+		return newError("range is too long: %d elements > %d", n, maxArrayLength)
+	}
+
+	els := make([]object.Object, n)
+	for i := range els {
+		els[i] = &object.Integer{Value: start + int64(i)*step}
+	}
+
+	return &object.Array{Elements: els}
+}
+
+// rangeSpan checks the arguments to range and returns the first integer of
+// the range, its step and how many integers it holds. A for...in loop over
+// range uses it to walk the range without building it.
+func rangeSpan(args []object.Object) (start, step int64, n uint64, err *object.Error) {
+	if len(args) < 1 || len(args) > 3 {
+		return 0, 0, 0, newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+	}
+
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		bound, ok := arg.(*object.Integer)
+		if !ok {
+			return 0, 0, 0, newError("arguments to `range` must be INTEGER, got %s", arg.Type())
+		}
+		bounds[i] = bound.Value
+	}
+
+	end := bounds[0]
+	step = 1
+	if len(bounds) > 1 {
+		start, end = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+
+	if step == 0 {
+		return 0, 0, 0, newError("step for `range` must not be zero")
+	}
+
+	// The distance and step are taken as unsigned so that ranges spanning
+	// most of the int64 line don't overflow.
+	var dist, stride uint64
+	switch {
+	case step > 0 && start < end:
+		dist, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		dist, stride = uint64(start)-uint64(end), uint64(-step)
+	default:
+		return start, step, 0, nil
+	}
+
+	return start, step, (dist-1)/stride + 1, nil
+}
+
+func fillCount(name string, arg object.Object) (int64, *object.Error) {
+	n, ok := arg.(*object.Integer)
+	if !ok {
+		return 0, newError("first argument to `%s` must be INTEGER, got %s", name, arg.Type())
+	}
+
+	if n.Value < 0 {
+		return 0, newError("count for `%s` must not be negative, got %d", name, n.Value)
+	}
+	if n.Value > maxArrayLength {
+		return 0, newError("count for `%s` is too large: %d > %d", name, n.Value, maxArrayLength)
+	}
+
+	return n.Value, nil
+}
+
+// maxArrayLength bounds the arrays builtins build from a count a script
+// gives, so that a huge count is an error rather than a crash of the whole
+// program running the interpreter.
+const maxArrayLength = 1 << 24
+
+// deepCopy copies arrays and hashes recursively. Other values are immutable
+// and are returned as-is.
+func deepCopy(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.Array:
+		els := make([]object.Object, len(obj.Elements))
+		for i, el := range obj.Elements {
+			els[i] = deepCopy(el)
+		}
+		return &object.Array{Elements: els}
+
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair, len(obj.Pairs))
+		for hk, pair := range obj.Pairs {
+			pairs[hk] = object.HashPair{Key: pair.Key, Value: deepCopy(pair.Value)}
+		}
+		return &object.Hash{Pairs: pairs}
+
+	default:
+		return obj
+	}
+}
+
+// toJSONFunc implements `to_json(value)`, encoding integers, floats,
+// booleans, null, strings, arrays and hashes as JSON.
+//
+// JSON object keys are always strings, so hash keys follow one convention:
+// a string key is written as it is, and an integer, boolean or null key as
+// the text puts would print for it, so {1: "a", true: "b"} is
+// {"1":"a","true":"b"}, and whatever reads the JSON sees string keys. Two keys
+// that come out the same, such as 1 and "1", are an error rather than a
+// JSON object with a repeated key, which most readers would silently cut
+// down to one of the values.
+func toJSONFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	var out strings.Builder
+	if err := writeJSON(&out, args[0]); err != nil {
+		return err
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// writeJSON encodes obj as JSON, writing hash keys as toJSONFunc describes
+// in the hash's sorted order so the output is stable.
+func writeJSON(out *strings.Builder, obj object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return newError("cannot convert %s to JSON", obj.Inspect())
+		}
+		out.WriteString(strconv.FormatFloat(obj.Value, 'f', -1, 64))
+
+	case *object.Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+
+	case *object.Null:
+		out.WriteString("null")
+
+	case *object.String:
+		writeJSONString(out, obj.Value)
+
+	case *object.Array:
+		out.WriteString("[")
+		for i, el := range obj.Elements {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			if err := writeJSON(out, el); err != nil {
+				return err
+			}
+		}
+		out.WriteString("]")
+
+	case *object.Hash:
+		out.WriteString("{")
+		written := make(map[string]object.Object, len(obj.Pairs))
+		for i, pair := range obj.SortedPairs() {
+			key := pair.Key.Inspect()
+			if prev, ok := written[key]; ok {
+				return newError("hash keys %s and %s are both %q in JSON", describeKey(prev), describeKey(pair.Key), key)
+			}
+			written[key] = pair.Key
+
+			if i > 0 {
+				out.WriteString(",")
+			}
+			writeJSONString(out, key)
+			out.WriteString(":")
+			if err := writeJSON(out, pair.Value); err != nil {
+				return err
+			}
+		}
+		out.WriteString("}")
+
+	default:
+		return newError("cannot convert %s to JSON", obj.Type())
+	}
+
+	return nil
+}
+
+// describeKey names a hash key with its type, as `INTEGER 1`, so that keys
+// printing the same can be told apart in an error.
+func describeKey(key object.Object) string {
+	return fmt.Sprintf("%s %s", key.Type(), key.Inspect())
+}
+
+func writeJSONString(out *strings.Builder, s string) {
+	encoded, _ := json.Marshal(s)
+	out.Write(encoded)
+}
+
+// serializeFunc encodes a value with object.Serialize. The result is a
+// STRING holding the raw bytes, which deserialize turns back into a value.
+func serializeFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	data, err := object.Serialize(args[0])
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return &object.String{Value: string(data)}
+}
+
+func deserializeFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	if args[0].Type() != object.STRING_OBJ {
+		return newError("argument to `deserialize` must be STRING, got %s", args[0].Type())
+	}
+
+	obj, err := object.Deserialize([]byte(args[0].(*object.String).Value))
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return obj
+}
+
+// sortByFunc stably sorts a copy of an array by the key fn returns for each
+// element. Keys are computed once per element and must all be integers or
+// all be strings.
+func sortByFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError("first argument to `sort_by` must be ARRAY, got %s", args[0].Type())
+	}
+
+	els := args[0].(*object.Array).Elements
+	keys := make([]object.Object, len(els))
+
+	for i, el := range els {
+		key := applyFunction(args[1], []object.Object{el})
+		if isError(key) {
+			return key
+		}
+
+		if key.Type() != object.INTEGER_OBJ && key.Type() != object.STRING_OBJ {
+			return newError("keys for `sort_by` must be INTEGER or STRING, got %s", key.Type())
+		}
+
+		if i > 0 && key.Type() != keys[0].Type() {
+			return newError("keys for `sort_by` must all have the same type, got %s and %s", keys[0].Type(), key.Type())
+		}
+
+		keys[i] = key
+	}
+
+	order := make([]int, len(els))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		switch a := keys[order[i]].(type) {
+		case *object.Integer:
+			return a.Value < keys[order[j]].(*object.Integer).Value
+		default:
+			return a.(*object.String).Value < keys[order[j]].(*object.String).Value
+		}
+	})
+
+	sorted := make([]object.Object, len(els))
+	for i, idx := range order {
+		sorted[i] = els[idx]
+	}
+
+	return &object.Array{Elements: sorted}
+}
+
+// bsearchFunc implements `bsearch(arr, target)`, finding target in an array
+// sorted in ascending order by binary search. It returns the index of the
+// first element equal to target, or -1 if there is none. Elements are
+// compared as by < and ==, so mixing types that can't be ordered is an
+// error; on an unsorted array the result is meaningless.
+func bsearchFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `bsearch` must be ARRAY, got %s", args[0].Type())
+	}
+
+	return binarySearch(len(arr.Elements), args[1], func(i int) object.Object {
+		return arr.Elements[i]
+	})
+}
+
+// bsearchByFunc implements `bsearch_by(arr, target, fn)`, which is bsearch
+// on an array sorted by fn(el), comparing target against those keys.
+func bsearchByFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `bsearch_by` must be ARRAY, got %s", args[0].Type())
+	}
+
+	return binarySearch(len(arr.Elements), args[1], func(i int) object.Object {
+		return applyFunction(args[2], []object.Object{arr.Elements[i]})
+	})
+}
+
+// binarySearch looks for target among n sorted keys, where key(i) gives the
+// i'th and may return an error.
+func binarySearch(n int, target object.Object, key func(int) object.Object) object.Object {
+	compare := func(i int) (int, object.Object) {
+		k := key(i)
+		if isError(k) {
+			return 0, k
+		}
+		c, err := compareObjects("<", k, target)
+		if err != nil {
+			return 0, err
+		}
+		return c, nil
+	}
+
+	lo, hi := 0, n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		c, err := compare(mid)
+		if err != nil {
+			return err
+		}
+		if c < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	if lo < n {
+		c, err := compare(lo)
+		if err != nil {
+			return err
+		}
+		if c == 0 {
+			return &object.Integer{Value: int64(lo)}
+		}
+	}
+
+	return &object.Integer{Value: -1}
+}
+
+// mapFunc applies fn to each element of an array, or to each key and value
+// of a hash, returning a new collection. For a hash fn(key, value) gives the
+// new value for key; pairs are visited in the hash's sorted key order.
+func mapFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	switch coll := args[0].(type) {
+	case *object.Array:
+		mapped := make([]object.Object, len(coll.Elements))
+		for i, el := range coll.Elements {
+			val := applyFunction(args[1], []object.Object{el})
+			if isError(val) {
+				return val
+			}
+			mapped[i] = val
+		}
+		return &object.Array{Elements: mapped}
+
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair, len(coll.Pairs))
+		for _, pair := range coll.SortedPairs() {
+			val := applyFunction(args[1], []object.Object{pair.Key, pair.Value})
+			if isError(val) {
+				return val
+			}
+			pairs[pair.Key.(object.Hashable).HashKey()] = object.HashPair{Key: pair.Key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}
+
+	default:
+		return newError("first argument to `map` must be ARRAY or HASH, got %s", args[0].Type())
+	}
+}
+
+// filterFunc keeps the elements of an array, or the pairs of a hash, for
+// which fn returns a truthy value. For a hash fn is called as fn(key, value).
+func filterFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	switch coll := args[0].(type) {
+	case *object.Array:
+		kept := []object.Object{}
+		for _, el := range coll.Elements {
+			keep := applyFunction(args[1], []object.Object{el})
+			if isError(keep) {
+				return keep
+			}
+			if isTruthy(keep, env) {
+				kept = append(kept, el)
+			}
+		}
+		return &object.Array{Elements: kept}
+
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair)
+		for _, pair := range coll.SortedPairs() {
+			keep := applyFunction(args[1], []object.Object{pair.Key, pair.Value})
+			if isError(keep) {
+				return keep
+			}
+			if isTruthy(keep, env) {
+				pairs[pair.Key.(object.Hashable).HashKey()] = pair
+			}
+		}
+		return &object.Hash{Pairs: pairs}
+
+	default:
+		return newError("first argument to `filter` must be ARRAY or HASH, got %s", args[0].Type())
+	}
+}
+
+// reduceFunc implements `reduce(arr, initial, fn)`, folding the array from
+// the left: the accumulator starts as initial and becomes fn(acc, el) for
+// each element in turn. An empty array gives back initial.
+func reduceFunc(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("wrong number of arguments. got=%d, want=3", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `reduce` must be ARRAY, got %s", args[0].Type())
+	}
+
+	if !isCallable(args[2]) {
+		return newError("third argument to `reduce` must be FUNCTION, got %s", args[2].Type())
+	}
+
+	acc := args[1]
+	for _, el := range arr.Elements {
+		acc = applyFunction(args[2], []object.Object{acc, el})
+		if isError(acc) {
+			return acc
+		}
+	}
+
+	return acc
+}
+
+// takeWhileFunc implements `take_while(arr, fn)`, returning the elements
+// before the first one fn rejects.
+func takeWhileFunc(env *object.Env, args ...object.Object) object.Object {
+	arr, n, err := leadingRun("take_while", args, env)
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: append([]object.Object{}, arr.Elements[:n]...)}
+}
+
+// dropWhileFunc implements `drop_while(arr, fn)`, returning the elements
+// from the first one fn rejects onwards.
+func dropWhileFunc(env *object.Env, args ...object.Object) object.Object {
+	arr, n, err := leadingRun("drop_while", args, env)
+	if err != nil {
+		return err
+	}
+
+	return &object.Array{Elements: append([]object.Object{}, arr.Elements[n:]...)}
+}
+
+// leadingRun counts the elements at the start of an array that satisfy a
+// predicate, calling it on nothing past the first element that fails.
+func leadingRun(name string, args []object.Object, env *object.Env) (*object.Array, int, object.Object) {
+	if len(args) != 2 {
+		return nil, 0, newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, 0, newError("first argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return nil, 0, newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+
+	for i, el := range arr.Elements {
+		keep := applyFunction(args[1], []object.Object{el})
+		if isError(keep) {
+			return nil, 0, keep
+		}
+		if !isTruthy(keep, env) {
+			return arr, i, nil
+		}
+	}
+
+	return arr, len(arr.Elements), nil
+}
+
+// partitionFunc splits an array by a predicate in one pass, returning
+// [matching, rest] with each group keeping the original order.
+func partitionFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `partition` must be ARRAY, got %s", args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return newError("second argument to `partition` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	matching, rest := []object.Object{}, []object.Object{}
+	for _, el := range arr.Elements {
+		keep := applyFunction(args[1], []object.Object{el})
+		if isError(keep) {
+			return keep
+		}
+		if isTruthy(keep, env) {
+			matching = append(matching, el)
+		} else {
+			rest = append(rest, el)
+		}
+	}
+
+	return &object.Array{Elements: []object.Object{
+		&object.Array{Elements: matching},
+		&object.Array{Elements: rest},
+	}}
+}
+
+// flatMapFunc maps each element of an array to an array and concatenates
+// the results, so flat_map([1, 2], fn(x) { [x, x] }) is [1, 1, 2, 2]. Only
+// one level is flattened, and fn returning anything but an ARRAY is an
+// error rather than being wrapped.
+func flatMapFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("first argument to `flat_map` must be ARRAY, got %s", args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return newError("second argument to `flat_map` must be FUNCTION, got %s", args[1].Type())
+	}
+
+	flat := []object.Object{}
+	for _, el := range arr.Elements {
+		val := applyFunction(args[1], []object.Object{el})
+		if isError(val) {
+			return val
+		}
+
+		part, ok := val.(*object.Array)
+		if !ok {
+			return newError("function passed to `flat_map` must return ARRAY, got %s", val.Type())
+		}
+		flat = append(flat, part.Elements...)
+	}
+
+	return &object.Array{Elements: flat}
+}
+
+// isCallable reports whether obj can be passed to applyFunction.
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.BuiltIn:
+		return true
+	default:
+		return false
+	}
+}
+
+func putsFunc(env *object.Env, args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Fprintln(output(env), displayString(arg, env))
+	}
+	return NULL
+}
+
+// timeDirectives maps the layout directives accepted by `time_format` onto
+// the Go reference-time layout each is formatted with. Longer directives
+// come first so that e.g. "YYYY" is not read as two "YY"s.
+var timeDirectives = []struct{ directive, layout string }{
+	{"YYYY", "2006"},
+	{"YY", "06"},
+	{"MM", "01"},
+	{"DD", "02"},
+	{"hh", "15"},
+	{"mm", "04"},
+	{"ss", "05"},
+}
+
+// formatTime writes t according to layout. Only the directives are
+// formatted; everything else is copied as it is, so text that happens to
+// look like part of Go's reference time, such as "Mon" or "1", stays put.
+func formatTime(t time.Time, layout string) string {
+	var out strings.Builder
+
+next:
+	for i := 0; i < len(layout); {
+		for _, d := range timeDirectives {
+			if strings.HasPrefix(layout[i:], d.directive) {
+				out.WriteString(t.Format(d.layout))
+				i += len(d.directive)
+				continue next
+			}
+		}
+		out.WriteByte(layout[i])
+		i++
+	}
+
+	return out.String()
+}
+
+func timeNowFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 0 {
+		return newError("wrong number of arguments. got=%d, want=0", len(args))
+	}
+
+	now := time.Now
+	if clock := env.Modes().Clock; clock != nil {
+		now = clock
+	}
+
+	return &object.Time{Value: now().Unix()}
+}
+
+func timeFormatFunc(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	if args[0].Type() != object.TIME_OBJ {
+		return newError("first argument to `time_format` must be TIME, got %s", args[0].Type())
+	}
+
+	if args[1].Type() != object.STRING_OBJ {
+		return newError("second argument to `time_format` must be STRING, got %s", args[1].Type())
+	}
+
+	t := time.Unix(args[0].(*object.Time).Value, 0).UTC()
+
+	return &object.String{Value: formatTime(t, args[1].(*object.String).Value)}
+}
+
+func timeFieldFunc(name string, field func(time.Time) int) object.BuiltInFns {
+	return func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+
+		if args[0].Type() != object.TIME_OBJ {
+			return newError("argument to `%s` must be TIME, got %s", name, args[0].Type())
+		}
+
+		t := time.Unix(args[0].(*object.Time).Value, 0).UTC()
+		return &object.Integer{Value: int64(field(t))}
 	}
-	return NULL
 }
@@ -0,0 +1,226 @@
+package evaluator
+
+import (
+	"github.com/connorjbarry/monkey/interpreter/ast"
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+// captureEnv builds the environment a function literal closes over. Rather
+// than holding on to the whole defining scope, which would keep every local
+// of the enclosing call alive, the closure gets a compact scope holding only
+// its free variables, copied by value, with the global scope as its parent.
+// Free variables that are builtins, or that hold the same value as the
+// global of that name, aren't copied: the global scope resolves them.
+//
+// The full defining environment is kept instead when:
+//   - it is the global scope, so there is nothing to leave out;
+//   - it is shared, as the scope of a call that reassigns is, since a copy
+//     would miss later reassignments;
+//   - a free variable can't be resolved yet, such as a forward reference to
+//     a function defined later in the same call;
+//   - the body contains a node the scanner doesn't know, which can only be
+//     a node type added to the AST without a case here.
+//
+// It also reports whether the literal's body reassigns any variable. A let
+// that rebinds a name the body has already bound or read counts, as does a
+// let inside a loop, which rebinds its name on every pass after the first:
+// a closure made earlier must see the new binding, as it would at top level.
+func captureEnv(fn *ast.FunctionLiteral, env *object.Env) (*object.Env, bool) {
+	s := newFreeVarScanner(fn.Params)
+	s.block(fn.Body)
+
+	global := env.Global()
+	if env == global || !s.ok || env.Shared() {
+		return env, s.reassigns
+	}
+
+	captured := object.NewClosedEnv(global)
+
+	for _, name := range s.free {
+		val, ok := env.Get(name)
+		if !ok {
+			if _, isBuiltin := lookupBuiltin(name, env); isBuiltin || s.bound[name] {
+				continue
+			}
+			return env, s.reassigns
+		}
+
+		if globalVal, ok := global.Get(name); ok && globalVal == val {
+			continue
+		}
+
+		captured.Set(name, val)
+	}
+
+	return captured, s.reassigns
+}
+
+// freeVarScanner walks a function body in evaluation order, recording each
+// identifier that is read before the function binds it.
+type freeVarScanner struct {
+	bound     map[string]bool
+	seen      map[string]bool
+	free      []string
+	ok        bool
+	reassigns bool
+	loops     int // how many loops enclose the node being scanned
+}
+
+func newFreeVarScanner(params []*ast.Identifier) *freeVarScanner {
+	s := &freeVarScanner{bound: map[string]bool{}, seen: map[string]bool{}, ok: true}
+	for _, p := range params {
+		s.bound[p.Value] = true
+	}
+	return s
+}
+
+func (s *freeVarScanner) ref(name string) {
+	if s.bound[name] || s.seen[name] {
+		return
+	}
+	s.seen[name] = true
+	s.free = append(s.free, name)
+}
+
+func (s *freeVarScanner) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		s.node(stmt)
+	}
+}
+
+func (s *freeVarScanner) node(node ast.Node) {
+	switch node := node.(type) {
+	case nil:
+	case *ast.LetStatement:
+		s.node(node.Value)
+		if s.bound[node.Name.Value] || s.seen[node.Name.Value] || s.loops > 0 {
+			s.reassigns = true
+		}
+		s.bound[node.Name.Value] = true
+	case *ast.AssignStatement:
+		s.node(node.Value)
+		s.ref(node.Name.Value)
+		s.reassigns = true
+	case *ast.IncDecStatement:
+		s.ref(node.Name.Value)
+		s.reassigns = true
+	case *ast.ReturnStatement:
+		s.node(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		s.node(node.Expression)
+	case *ast.WhileStatement:
+		s.loops++
+		s.node(node.Condition)
+		s.block(node.Body)
+		s.loops--
+	case *ast.ForInStatement:
+		s.node(node.Iterable)
+		s.loops++
+		s.forInBody(node)
+		s.loops--
+	case *ast.BreakStatement, *ast.ContinueStatement:
+	case *ast.BlockStatement:
+		s.block(node)
+	case *ast.Identifier:
+		s.ref(node.Value)
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+	case *ast.PrefixExpression:
+		s.node(node.Right)
+	case *ast.InfixExpression:
+		s.node(node.Left)
+		s.node(node.Right)
+	case *ast.IfExpression:
+		s.node(node.Condition)
+		s.block(node.Consequence)
+		s.block(node.Alternative)
+	case *ast.TernaryExpression:
+		s.node(node.Condition)
+		s.node(node.Consequence)
+		s.node(node.Alternative)
+	case *ast.FunctionLiteral:
+		inner := newFreeVarScanner(node.Params)
+		inner.block(node.Body)
+		s.ok = s.ok && inner.ok
+		s.reassigns = s.reassigns || inner.reassigns
+		for _, name := range inner.free {
+			s.ref(name)
+		}
+	case *ast.CallExpression:
+		s.node(node.Func)
+		for _, arg := range node.Args {
+			s.node(arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			s.node(el)
+		}
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			s.node(part)
+		}
+	case *ast.IndexExpression:
+		s.node(node.Left)
+		s.node(node.Index)
+	case *ast.SliceExpression:
+		s.node(node.Left)
+		s.node(node.Low)
+		s.node(node.High)
+	case *ast.HashLiteral:
+		for key, val := range node.Pairs {
+			s.node(key)
+			s.node(val)
+		}
+	case *ast.MatchExpression:
+		s.node(node.Subject)
+		for _, arm := range node.Arms {
+			s.matchArm(arm)
+		}
+	default:
+		s.ok = false
+	}
+}
+
+// matchArm scans an arm with its pattern's bindings in scope, restoring the
+// enclosing bindings afterwards since arms evaluate in their own scope.
+func (s *freeVarScanner) matchArm(arm *ast.MatchArm) {
+	outer := make(map[string]bool, len(s.bound))
+	for name := range s.bound {
+		outer[name] = true
+	}
+
+	s.bindPattern(arm.Pattern)
+	s.node(arm.Guard)
+	s.node(arm.Body)
+
+	s.bound = outer
+}
+
+// forInBody scans a for...in body with the loop variable bound, restoring the
+// enclosing bindings afterwards since every pass runs in its own scope.
+func (s *freeVarScanner) forInBody(node *ast.ForInStatement) {
+	outer := make(map[string]bool, len(s.bound))
+	for name := range s.bound {
+		outer[name] = true
+	}
+
+	s.bound[node.Name.Value] = true
+	s.block(node.Body)
+
+	s.bound = outer
+}
+
+func (s *freeVarScanner) bindPattern(pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			s.bound[pattern.Value] = true
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range pattern.Elements {
+			s.bindPattern(el)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+// SetLooseCoercion switches JavaScript-style conversions between strings and
+// numbers in infix expressions on or off for programs evaluated in env, or
+// any scope sharing its global scope, and returns the previous setting so
+// callers can restore it. It is off by default. In loose mode:
+//
+//   - + with a string on either side concatenates, converting the other
+//     operand as puts would print it: "3" + 4 is "34".
+//   - Other operators, apart from == and !=, read a string holding a number
+//     as that number: "3" * 4 is 12 and "1.5" < 2 is true. Strings that
+//     aren't numbers are left alone, so "a" * 4 is still an error.
+//
+// Equality is never loose: "3" == 3 stays false.
+func SetLooseCoercion(env *object.Env, on bool) bool {
+	modes := env.Modes()
+	prev := modes.LooseCoercion
+	modes.LooseCoercion = on
+	return prev
+}
+
+// coerceOperands applies the loose mode conversions to an infix
+// expression's operands.
+func coerceOperands(op string, left, right object.Object, env *object.Env) (object.Object, object.Object) {
+	switch op {
+	case "==", "!=":
+		return left, right
+
+	case "+":
+		if left.Type() == object.STRING_OBJ || right.Type() == object.STRING_OBJ {
+			return &object.String{Value: displayString(left, env)}, &object.String{Value: displayString(right, env)}
+		}
+		return left, right
+
+	default:
+		return numericString(left), numericString(right)
+	}
+}
+
+// numericString converts a string holding an integer or float literal,
+// optionally signed and surrounded by whitespace, to that number. Anything
+// else, including "NaN" and "Inf", is returned unchanged.
+func numericString(obj object.Object) object.Object {
+	str, ok := obj.(*object.String)
+	if !ok {
+		return obj
+	}
+
+	if val, ok := parseIntString(str.Value); ok {
+		return &object.Integer{Value: val}
+	}
+
+	val, err := strconv.ParseFloat(strings.TrimSpace(str.Value), 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+		return obj
+	}
+
+	return &object.Float{Value: val}
+}
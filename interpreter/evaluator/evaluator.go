@@ -1,16 +1,24 @@
 package evaluator
 
 import (
+	"cmp"
 	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/connorjbarry/monkey/interpreter/ast"
 	"github.com/connorjbarry/monkey/interpreter/object"
+	"github.com/connorjbarry/monkey/interpreter/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func Eval(node ast.Node, env *object.Env) object.Object {
@@ -31,6 +39,12 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
@@ -39,12 +53,31 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 
 		env.Set(node.Name.Value, val)
 
+	case *ast.AssignStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+
+		if !env.Assign(node.Name.Value, val) {
+			return newError("identifier not found: " + node.Name.Value)
+		}
+
+	case *ast.IncDecStatement:
+		return evalIncDecStatement(node, env)
+
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return newInteger(node.Value, env)
+
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
+	case *ast.InterpolatedString:
+		return evalInterpolatedString(node, env)
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -53,9 +86,13 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return locate(evalPrefixExpression(node.Operator, right, env), node.Token)
 
 	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return evalLogicalExpression(node, env)
+		}
+
 		left := Eval(node.Left, env)
 		if isError(left) {
 			return left
@@ -66,18 +103,28 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return locate(evalInfixExpression(node.Operator, left, right, env), node.Token)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TernaryExpression:
+		return evalTernaryExpression(node, env)
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return locate(evalIdentifier(node, env), node.Token)
 
 	case *ast.FunctionLiteral:
 		params := node.Params
 		body := node.Body
-		return &object.Function{Params: params, Body: body, Env: env}
+		captured, reassigns := captureEnv(node, env)
+		return &object.Function{Params: params, Body: body, Env: captured, Reassigns: reassigns}
 
 	case *ast.CallExpression:
 		fn := Eval(node.Func, env)
@@ -90,7 +137,7 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(fn, args)
+		return locateCall(applyFunction(fn, args), node)
 
 	case *ast.ArrayLiteral:
 		els := evalExpressions(node.Elements, env)
@@ -110,11 +157,17 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 			return idx
 		}
 
-		return evalIndexExpression(left, idx)
+		return locate(evalIndexExpression(left, idx), node.Token)
+
+	case *ast.SliceExpression:
+		return locate(evalSliceExpression(node, env), node.Token)
 
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	}
 
 	return nil
@@ -131,89 +184,392 @@ func evalProgram(stmts []ast.Statement, env *object.Env) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return loopControlError(result)
+		}
+	}
+
+	return res
+}
+
+// EvalCalculator evaluates program like Eval, but also writes the value of
+// each top-level expression statement to the `puts` output, the way a
+// calculator shows each result. Statements such as let print nothing, and
+// neither do expressions whose value is null, like a call to puts.
+func EvalCalculator(program *ast.Program, env *object.Env) object.Object {
+	var res object.Object
+
+	for _, stmt := range program.Statements {
+		res = Eval(stmt, env)
+
+		switch result := res.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		case *object.Break, *object.Continue:
+			return loopControlError(result)
+		}
+
+		if _, ok := stmt.(*ast.ExpressionStatement); ok && res != NULL {
+			fmt.Fprintln(output(env), displayString(res, env))
 		}
 	}
 
 	return res
 }
 
-func evalPrefixExpression(op string, right object.Object) object.Object {
+// evalInterpolatedString concatenates the text parts with the values of the
+// embedded expressions. Strings are inserted as-is; anything else is
+// inserted in its Inspect form.
+func evalInterpolatedString(node *ast.InterpolatedString, env *object.Env) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		val := Eval(part, env)
+		if isError(val) {
+			return val
+		}
+
+		out.WriteString(displayString(val, env))
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// displayString is how a value reads when printed or spliced into text: a
+// string's contents, or the Inspect form of anything else with floats
+// printed to env's precision.
+func displayString(obj object.Object, env *object.Env) string {
+	if str, ok := obj.(*object.String); ok {
+		return str.Value
+	}
+
+	return object.InspectPrecision(obj, env.Modes().FloatPrecision)
+}
+
+// SetFloatPrecision makes floats print with n decimal places, rounding as
+// needed, in programs evaluated in env or any scope sharing its global
+// scope, and returns the previous precision so callers can restore it. A
+// negative n goes back to the default shortest form, in which 0.1 + 0.2
+// prints as 0.30000000000000004 but 0.5 as 0.5. Only how puts, str, format,
+// template and string interpolation print values changes: arithmetic,
+// comparisons and to_json still use the full value.
+func SetFloatPrecision(env *object.Env, n int) int {
+	modes := env.Modes()
+	prev := modes.FloatPrecision
+	modes.FloatPrecision = max(n, -1)
+	return prev
+}
+
+func evalPrefixExpression(op string, right object.Object, env *object.Env) object.Object {
 	switch op {
 	case "!":
-		return evalBangOperatorExpression(right)
+		return evalBangOperatorExpression(right, env)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, env)
 	default:
 		return newError("unknown operator: %s%s", op, right.Type())
 	}
 }
 
-func evalInfixExpression(op string, left, right object.Object) object.Object {
+func evalInfixExpression(op string, left, right object.Object, env *object.Env) object.Object {
+	if result, ok := evalOverloadedOperator(op, left, right, env); ok {
+		return result
+	}
+
+	if op == "in" {
+		return evalInExpression(left, right, env)
+	}
+
+	if env.Modes().LooseCoercion {
+		left, right = coerceOperands(op, left, right, env)
+	}
+
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(op, left, right)
+		return evalIntegerInfixExpression(op, left, right, env)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(op, left, right)
+	case left.Type() == object.FUNCTION_OBJ && right.Type() == object.FUNCTION_OBJ:
+		return evalFunctionInfixExpression(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(op, left, right)
 	case op == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case op == "!=":
 		return nativeBoolToBooleanObject(left != right)
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(op, left, right)
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ && comparisons[op] != nil:
+		return evalArrayComparison(op, left, right)
 
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), op, right.Type())
+		return newInfixError("type mismatch", left, op, right)
 
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newInfixError("unknown operator", left, op, right)
 	}
 }
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
+// evalInExpression implements `item in collection`. For an array it asks
+// whether any element == item, for a hash whether item is a key, and for a
+// string whether item is a substring.
+func evalInExpression(item, collection object.Object, env *object.Env) object.Object {
+	switch collection := collection.(type) {
+	case *object.Array:
+		for _, el := range collection.Elements {
+			eq := evalInfixExpression("==", el, item, env)
+			if isError(eq) {
+				return eq
+			}
+			if eq == TRUE {
+				return TRUE
+			}
+		}
 		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
+
+	case *object.Hash:
+		key, ok := object.AsHashKey(item)
+		if !ok {
+			return unusableKeyError(item)
+		}
+		_, ok = collection.Pairs[key]
+		return nativeBoolToBooleanObject(ok)
+
+	case *object.String:
+		sub, ok := item.(*object.String)
+		if !ok {
+			return newInfixError("type mismatch", item, "in", collection)
+		}
+		return nativeBoolToBooleanObject(strings.Contains(collection.Value, sub.Value))
+
 	default:
-		return FALSE
+		return newInfixError("unknown operator", item, "in", collection)
+	}
+}
+
+// overloads maps operators to the hash keys that can overload them.
+var overloads = map[string]string{
+	"+":  "__add__",
+	"==": "__eq__",
+	"!=": "__eq__",
+}
+
+// evalOverloadedOperator lets a hash define an operator for itself. If left
+// is a hash holding a function under the operator's magic key, such as
+// __add__ for +, the result is method(left, right). Equality also checks
+// right, so a value can compare equal to a hash that defines __eq__. The
+// result of __eq__ is reduced to a boolean, and != negates it.
+func evalOverloadedOperator(op string, left, right object.Object, env *object.Env) (object.Object, bool) {
+	name, ok := overloads[op]
+	if !ok {
+		return nil, false
+	}
+
+	self, other := left, right
+	method, ok := magicMethod(self, name)
+	if !ok && name == "__eq__" {
+		self, other = right, left
+		method, ok = magicMethod(self, name)
+	}
+	if !ok {
+		return nil, false
+	}
+
+	result := applyFunction(method, []object.Object{self, other})
+	if isError(result) || name != "__eq__" {
+		return result, true
+	}
+
+	return nativeBoolToBooleanObject(isTruthy(result, env) == (op == "==")), true
+}
+
+func magicMethod(obj object.Object, name string) (object.Object, bool) {
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return nil, false
 	}
+
+	pair, ok := hash.Pairs[(&object.String{Value: name}).HashKey()]
+	return pair.Value, ok
+}
+
+func evalBangOperatorExpression(right object.Object, env *object.Env) object.Object {
+	return nativeBoolToBooleanObject(!isTruthy(right, env))
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+func evalMinusPrefixOperatorExpression(right object.Object, env *object.Env) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return newInteger(right.Value*-1, env)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
+
+// evalLogicalExpression evaluates && and ||, which short-circuit: the right
+// operand is only evaluated when the left doesn't already decide the result.
+// Both operators yield a boolean.
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Env) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	if isTruthy(left, env) == (node.Operator == "||") {
+		return nativeBoolToBooleanObject(isTruthy(left, env))
+	}
 
-	return &object.Integer{
-		Value: right.(*object.Integer).Value * -1,
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return right
 	}
+
+	return nativeBoolToBooleanObject(isTruthy(right, env))
 }
 
-func evalIntegerInfixExpression(op string, left, right object.Object) object.Object {
+func evalIntegerInfixExpression(op string, left, right object.Object, env *object.Env) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
 	switch op {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return newInteger(leftVal+rightVal, env)
+	case "-":
+		return newInteger(leftVal-rightVal, env)
+	case "*":
+		return newInteger(leftVal*rightVal, env)
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return newInteger(leftVal/rightVal, env)
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return newInteger(leftVal%rightVal, env)
+	case "**":
+		if rightVal < 0 {
+			return newError("negative exponent: %d", rightVal)
+		}
+		return newInteger(intPow(leftVal, rightVal), env)
+
+	case "&":
+		return newInteger(leftVal&rightVal, env)
+	case "|":
+		return newInteger(leftVal|rightVal, env)
+	case "^":
+		return newInteger(leftVal^rightVal, env)
+	case "<<", ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if op == "<<" {
+			return newInteger(leftVal<<rightVal, env)
+		}
+		return newInteger(leftVal>>rightVal, env)
+
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	default:
+		return newInfixError("unknown operator", left, op, right)
+	}
+}
+
+// intPow computes base ** exp by repeated squaring. Like the other integer
+// operators it wraps around on overflow.
+func intPow(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+
+	return result
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// floatValue returns a number's value as a float64, promoting integers.
+func floatValue(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+
+	return obj.(*object.Float).Value
+}
+
+// evalFloatInfixExpression handles arithmetic where at least one operand is
+// a float; an integer on the other side is promoted, so 1 + 2.5 is 3.5.
+func evalFloatInfixExpression(op string, left, right object.Object) object.Object {
+	leftVal := floatValue(left)
+	rightVal := floatValue(right)
+
+	switch op {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return &object.Float{Value: leftVal - rightVal}
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return &object.Float{Value: leftVal * rightVal}
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	default:
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+		return newInfixError("unknown operator", left, op, right)
+	}
+}
+
+// evalFunctionInfixExpression compares functions by identity: a function
+// equals itself, but two separately evaluated literals never compare equal,
+// even if their source is identical.
+func evalFunctionInfixExpression(op string, left, right object.Object) object.Object {
+	switch op {
+	case "==":
+		return nativeBoolToBooleanObject(left == right)
+	case "!=":
+		return nativeBoolToBooleanObject(left != right)
+	default:
+		return newInfixError("unknown operator", left, op, right)
 	}
 }
 
@@ -224,13 +580,191 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Env) object.Object {
 		return condition
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+	var result object.Object
+	if isTruthy(condition, env) {
+		result = Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
-	} else {
+		result = Eval(ie.Alternative, env)
+	}
+
+	// A branch that is missing, empty or ends in a let still has to give
+	// the if a value, since it may be bound or passed on.
+	if result == nil {
 		return NULL
 	}
+
+	return result
+}
+
+// evalTernaryExpression evaluates only the branch the condition selects.
+func evalTernaryExpression(te *ast.TernaryExpression, env *object.Env) object.Object {
+	condition := Eval(te.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition, env) {
+		return Eval(te.Consequence, env)
+	}
+
+	return Eval(te.Alternative, env)
+}
+
+// evalIncDecStatement steps an integer variable by one, updating it where
+// it was declared, and evaluates to the new value.
+func evalIncDecStatement(node *ast.IncDecStatement, env *object.Env) object.Object {
+	val, ok := env.Get(node.Name.Value)
+	if !ok {
+		return newError("identifier not found: " + node.Name.Value)
+	}
+
+	integer, ok := val.(*object.Integer)
+	if !ok {
+		return newError("unknown operator: %s%s", val.Type(), node.Operator)
+	}
+
+	step := int64(1)
+	if node.Operator == "--" {
+		step = -1
+	}
+
+	result := newInteger(integer.Value+step, env)
+	env.Assign(node.Name.Value, result)
+
+	return result
+}
+
+// evalWhileStatement runs the body in the current environment for as long
+// as the condition is truthy. The loop itself evaluates to NULL; a return or
+// an error inside the body ends it and is passed up unchanged. break ends
+// the loop early and continue moves on to the next check of the condition.
+func evalWhileStatement(node *ast.WhileStatement, env *object.Env) object.Object {
+	for {
+		cond := Eval(node.Condition, env)
+		if isError(cond) {
+			return cond
+		}
+
+		if !isTruthy(cond, env) {
+			return NULL
+		}
+
+		switch res := Eval(node.Body, env).(type) {
+		case *object.ReturnValue, *object.Error:
+			return res
+		case *object.Break:
+			return NULL
+		}
+	}
+}
+
+// evalForInStatement runs the body once for each element of an array, each
+// character of a string or each key of a hash, in sorted order. Each pass
+// gets its own scope holding the loop variable, so the loop leaves any outer
+// binding of that name alone and a closure made in the body keeps the value
+// of its own pass. Like a while loop it evaluates to NULL, and break and
+// continue work the same way.
+func evalForInStatement(node *ast.ForInStatement, env *object.Env) object.Object {
+	next, err := forInValues(node, env)
+	if err != nil {
+		return err
+	}
+
+	for {
+		val, ok := next()
+		if !ok {
+			return NULL
+		}
+
+		loopEnv := object.NewClosedEnv(env)
+		loopEnv.Set(node.Name.Value, val)
+
+		switch res := Eval(node.Body, loopEnv).(type) {
+		case *object.ReturnValue, *object.Error:
+			return res
+		case *object.Break:
+			return NULL
+		}
+	}
+}
+
+// forInValues returns a function giving the values a for...in loop takes,
+// one per call, and false once there are none left. A loop over a call to
+// range walks the range without building it, so it may be of any length.
+func forInValues(node *ast.ForInStatement, env *object.Env) (func() (object.Object, bool), object.Object) {
+	if call, ok := node.Iterable.(*ast.CallExpression); ok && isRangeCall(call, env) {
+		args := evalExpressions(call.Args, env)
+		if len(args) == 1 && isError(args[0]) {
+			return nil, args[0]
+		}
+
+		start, step, n, err := rangeSpan(args)
+		if err != nil {
+			return nil, locateCall(err, call)
+		}
+
+		var i uint64
+		return func() (object.Object, bool) {
+			if i == n {
+				return nil, false
+			}
+			val := &object.Integer{Value: start + int64(i)*step}
+			i++
+			return val, true
+		}, nil
+	}
+
+	iterable := Eval(node.Iterable, env)
+	if isError(iterable) {
+		return nil, iterable
+	}
+
+	var values []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		values = iterable.Elements
+	case *object.String:
+		for _, r := range iterable.Value {
+			values = append(values, &object.String{Value: string(r)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.SortedPairs() {
+			values = append(values, pair.Key)
+		}
+	default:
+		return nil, locate(newError("cannot iterate over %s", iterable.Type()), node.Token)
+	}
+
+	i := 0
+	return func() (object.Object, bool) {
+		if i == len(values) {
+			return nil, false
+		}
+		i++
+		return values[i-1], true
+	}, nil
+}
+
+// isRangeCall reports whether call calls the standard range builtin rather
+// than a variable or host builtin of the same name.
+func isRangeCall(call *ast.CallExpression, env *object.Env) bool {
+	ident, ok := call.Func.(*ast.Identifier)
+	if !ok || ident.Value != "range" {
+		return false
+	}
+
+	if _, ok := env.Get(ident.Value); ok {
+		return false
+	}
+
+	_, ok = env.Builtin(ident.Value)
+	return !ok
+}
+
+// loopControlError reports a break or continue that escaped to the top of a
+// program or function body without meeting a loop.
+func loopControlError(obj object.Object) *object.Error {
+	return newError("%s outside loop", obj.Inspect())
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Env) object.Object {
@@ -242,7 +776,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Env) object.Objec
 		if result != nil {
 			rt := result.Type()
 
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -255,13 +790,41 @@ func evalIdentifier(node *ast.Identifier, env *object.Env) object.Object {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin, ok := lookupBuiltin(node.Value, env); ok {
 		return builtin
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
+// Builtin returns the builtin a call to name in env would reach if no
+// variable shadowed it: one the host registered on env, or else a standard
+// one. Tools such as analyze use it to read a builtin's flags.
+func Builtin(name string, env *object.Env) (*object.BuiltIn, bool) {
+	return lookupBuiltin(name, env)
+}
+
+// lookupBuiltin finds name among the builtins registered on env by the host
+// program and then among the standard ones.
+func lookupBuiltin(name string, env *object.Env) (*object.BuiltIn, bool) {
+	if builtin, ok := env.Builtin(name); ok {
+		return builtin, true
+	}
+
+	if scoped, ok := scopedBuiltins[name]; ok {
+		return env.CachedBuiltin(name, func() *object.BuiltIn {
+			global := env.Global()
+			fn := func(args ...object.Object) object.Object {
+				return scoped.fn(global, args...)
+			}
+			return &object.BuiltIn{Fn: fn, Pure: scoped.pure, Callback: scoped.callback, CallbackArg: scoped.callbackArg}
+		}), true
+	}
+
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
 func evalExpressions(exprs []ast.Expression, env *object.Env) []object.Object {
 	var res []object.Object
 
@@ -277,20 +840,86 @@ func evalExpressions(exprs []ast.Expression, env *object.Env) []object.Object {
 }
 
 func evalStringInfixExpression(op string, left, right object.Object) object.Object {
-	if op != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
-	}
-
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 
-	return &object.String{Value: leftVal + rightVal}
+	switch op {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	}
+
+	if test, ok := comparisons[op]; ok {
+		return nativeBoolToBooleanObject(test(strings.Compare(leftVal, rightVal)))
+	}
+
+	return newInfixError("unknown operator", left, op, right)
+}
+
+// comparisons turns the result of a three-way comparison into the answer
+// for each ordering operator.
+var comparisons = map[string]func(int) bool{
+	"<":  func(c int) bool { return c < 0 },
+	">":  func(c int) bool { return c > 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+// evalArrayComparison orders two arrays lexicographically: the first pair
+// of elements that differ decides, and if one array is a prefix of the
+// other the shorter is less.
+func evalArrayComparison(op string, left, right object.Object) object.Object {
+	c, err := compareObjects(op, left, right)
+	if err != nil {
+		return err
+	}
+
+	return nativeBoolToBooleanObject(comparisons[op](c))
+}
+
+// compareObjects compares two values for the ordering operator op. Numbers
+// compare by value, strings byte by byte and arrays lexicographically; any
+// other pairing is an error naming op.
+func compareObjects(op string, left, right object.Object) (int, *object.Error) {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return cmp.Compare(left.(*object.Integer).Value, right.(*object.Integer).Value), nil
+
+	case isNumber(left) && isNumber(right):
+		return cmp.Compare(floatValue(left), floatValue(right)), nil
+
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return strings.Compare(left.(*object.String).Value, right.(*object.String).Value), nil
+
+	case left.Type() == object.ARRAY_OBJ && right.Type() == object.ARRAY_OBJ:
+		leftEls := left.(*object.Array).Elements
+		rightEls := right.(*object.Array).Elements
+
+		for i := 0; i < len(leftEls) && i < len(rightEls); i++ {
+			c, err := compareObjects(op, leftEls[i], rightEls[i])
+			if err != nil || c != 0 {
+				return c, err
+			}
+		}
+		return cmp.Compare(len(leftEls), len(rightEls)), nil
+
+	case left.Type() != right.Type():
+		return 0, newInfixError("type mismatch", left, op, right)
+
+	default:
+		return 0, newInfixError("unknown operator", left, op, right)
+	}
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -298,9 +927,12 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+// evalArrayIndexExpression returns the element at index. A negative index
+// counts back from the end, so arr[-1] is the last element; an index still
+// out of range gives NULL.
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arr := array.(*object.Array)
-	idx := index.(*object.Integer).Value
+	idx := fromEnd(index.(*object.Integer).Value, len(arr.Elements))
 
 	max := int64(len(arr.Elements) - 1)
 
@@ -311,6 +943,101 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arr.Elements[idx]
 }
 
+// fromEnd resolves a negative index against a sequence of the given length.
+func fromEnd(idx int64, length int) int64 {
+	if idx < 0 {
+		return idx + int64(length)
+	}
+
+	return idx
+}
+
+// evalStringIndexExpression returns the character at index as a string of
+// its own. Strings are indexed by rune, not byte, so "héllo"[1] is "é"; a
+// byte that isn't valid UTF-8 counts as one character and comes back as
+// U+FFFD. As with arrays, a negative index counts from the end and an index
+// out of range gives NULL.
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	s := str.(*object.String).Value
+	idx := index.(*object.Integer).Value
+
+	if idx < 0 {
+		idx = fromEnd(idx, utf8.RuneCountInString(s))
+	}
+
+	if idx < 0 {
+		return NULL
+	}
+
+	for _, r := range s {
+		if idx == 0 {
+			return &object.String{Value: string(r)}
+		}
+		idx--
+	}
+
+	return NULL
+}
+
+// evalSliceExpression evaluates `left[low:high]` on an array or a string,
+// returning a new value holding the elements, or for strings the runes, from
+// low up to but not including high. An omitted low is 0 and an omitted high
+// is the length. Negative bounds count from the end, as indices do, and
+// bounds out of range are clamped rather than an error.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Env) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	low, err := evalSliceBound(node.Low, 0, env)
+	if err != nil {
+		return err
+	}
+
+	high, err := evalSliceBound(node.High, math.MaxInt64, env)
+	if err != nil {
+		return err
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		low, high = fromEnd(low, len(left.Elements)), fromEnd(high, len(left.Elements))
+		return &object.Array{Elements: sliceElements(left.Elements, low, high)}
+
+	case *object.String:
+		runes := []rune(left.Value)
+		low, high = fromEnd(low, len(runes)), fromEnd(high, len(runes))
+		length := int64(len(runes))
+		low = max(0, min(low, length))
+		high = max(low, min(high, length))
+		return &object.String{Value: string(runes[low:high])}
+
+	default:
+		return newError("slice operator not supported: %s", left.Type())
+	}
+}
+
+// evalSliceBound evaluates one bound of a slice, giving def if it was
+// omitted.
+func evalSliceBound(exp ast.Expression, def int64, env *object.Env) (int64, object.Object) {
+	if exp == nil {
+		return def, nil
+	}
+
+	val := Eval(exp, env)
+	if isError(val) {
+		return 0, val
+	}
+
+	integer, ok := val.(*object.Integer)
+	if !ok {
+		return 0, newError("slice bounds must be INTEGER, got %s", val.Type())
+	}
+
+	return integer.Value, nil
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
@@ -320,9 +1047,9 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.AsHashKey(key)
 		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
+			return unusableKeyError(key)
 		}
 
 		val := Eval(valNode, env)
@@ -330,21 +1057,26 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 			return val
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: val}
+		pairs[hashKey] = object.HashPair{Key: key, Value: val}
 	}
 	return &object.Hash{Pairs: pairs}
 }
 
+// unusableKeyError reports an attempt to use obj, which is not Hashable, as
+// a hash key.
+func unusableKeyError(obj object.Object) *object.Error {
+	return newError("unusable as hash key: %s", obj.Type())
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObj := hash.(*object.Hash)
 
-	key, ok := index.(object.Hashable)
+	key, ok := object.AsHashKey(index)
 	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+		return unusableKeyError(index)
 	}
 
-	pair, ok := hashObj.Pairs[key.HashKey()]
+	pair, ok := hashObj.Pairs[key]
 	if !ok {
 		return NULL
 	}
@@ -352,11 +1084,111 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
+func evalMatchExpression(me *ast.MatchExpression, env *object.Env) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		armEnv := object.NewClosedEnv(env)
+
+		if !matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+
+			if !isTruthy(guard, env) {
+				continue
+			}
+		}
+
+		return Eval(arm.Body, armEnv)
+	}
+
+	return NULL
+}
+
+// matchPattern reports whether val has the shape described by pattern,
+// binding any identifiers in the pattern into env as it goes.
+func matchPattern(pattern ast.Expression, val object.Object, env *object.Env) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(pattern.Value, val)
+		}
+		return true
+
+	case *ast.ArrayLiteral:
+		arr, ok := val.(*object.Array)
+		if !ok || len(arr.Elements) != len(pattern.Elements) {
+			return false
+		}
+
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, arr.Elements[i], env) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		lit := Eval(pattern, env)
+		if lit.Type() != val.Type() {
+			return false
+		}
+
+		return lit.Inspect() == val.Inspect()
+	}
+}
+
+// locate gives an error the position of tok unless it already has one, so
+// errors report the innermost expression that failed.
+func locate(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line, err.Column = tok.Line, tok.Column
+	}
+
+	return obj
+}
+
+// locateCall locates an error returned by a call at the call, or, if it
+// arose somewhere inside the called function, adds the call to its stack.
+func locateCall(obj object.Object, call *ast.CallExpression) object.Object {
+	err, ok := obj.(*object.Error)
+	if !ok || err.Line == 0 {
+		return locate(obj, call.Token)
+	}
+
+	err.Stack = append(err.Stack, object.Frame{Name: callName(call.Func), Line: call.Token.Line, Column: call.Token.Column})
+	return err
+}
+
+// callName names the function a call expression calls, for stack traces.
+func callName(fn ast.Expression) string {
+	if _, ok := fn.(*ast.FunctionLiteral); ok {
+		return "fn"
+	}
+
+	return fn.String()
+}
+
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) < len(fn.Params) {
+			return newError("wrong number of arguments. got=%d, want=%d", len(args), len(fn.Params))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		eval := Eval(fn.Body, extendedEnv)
+		if eval == BREAK || eval == CONTINUE {
+			return loopControlError(eval)
+		}
 		return unwrapReturnValue(eval)
 	case *object.BuiltIn:
 		return fn.Fn(args...)
@@ -367,6 +1199,9 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Env {
 	env := object.NewClosedEnv(fn.Env)
+	if fn.Reassigns {
+		env.Share()
+	}
 
 	for idx, param := range fn.Params {
 		env.Set(param.Value, args[idx])
@@ -390,23 +1225,63 @@ func nativeBoolToBooleanObject(b bool) object.Object {
 	return FALSE
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
+// Truthiness selects which values conditions treat as false.
+type Truthiness int
+
+const (
+	// DefaultTruthiness treats only false and null as false, as
+	// object.Object's Truthy method does.
+	DefaultTruthiness Truthiness = iota
+	// NumericTruthiness additionally treats the numbers 0 and 0.0 as false.
+	// Other values, the empty string included, are still true.
+	NumericTruthiness
+)
+
+// SetTruthiness changes the rules conditions, !, && and || use to decide
+// what is true in programs evaluated in env, or any scope sharing its global
+// scope, and returns the previous rules so callers can restore them. Other
+// environments keep their own rules.
+func SetTruthiness(env *object.Env, t Truthiness) Truthiness {
+	modes := env.Modes()
+	prev := DefaultTruthiness
+	if modes.NumericTruthiness {
+		prev = NumericTruthiness
 	}
+
+	modes.NumericTruthiness = t == NumericTruthiness
+	return prev
 }
 
+func isTruthy(obj object.Object, env *object.Env) bool {
+	if env.Modes().NumericTruthiness {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			return obj.Value != 0
+		case *object.Float:
+			return obj.Value != 0
+		}
+	}
+
+	return obj.Truthy()
+}
+
+// newError builds an error object from a printf-style format. When there
+// are no arguments the format is used verbatim, skipping fmt.Sprintf.
 func newError(format string, a ...interface{}) *object.Error {
+	if len(a) == 0 {
+		return &object.Error{Message: format}
+	}
+
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// newInfixError builds the common "<kind>: LEFT op RIGHT" operator errors by
+// plain concatenation; they are the most frequent runtime errors and don't
+// need the generality of newError.
+func newInfixError(kind string, left object.Object, op string, right object.Object) *object.Error {
+	return &object.Error{Message: kind + ": " + string(left.Type()) + " " + op + " " + string(right.Type())}
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
@@ -1,8 +1,14 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/connorjbarry/monkey/interpreter/ast"
 	"github.com/connorjbarry/monkey/interpreter/object"
 	"github.com/connorjbarry/monkey/interpreter/parser"
 
@@ -29,6 +35,19 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"10 % 5", 0},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"2 + 10 % 4 * 3", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"(2 ** 3) ** 2", 64},
+		{"7 ** 0", 1},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"3 * 2 ** 2", 12},
+		{"2 ** 62 + (2 ** 62 - 1) + 2 ** 62", -(1 << 62) - 1},
 	}
 
 	for _, tt := range tests {
@@ -80,6 +99,9 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{`!""`, false},
+		{"![]", false},
+		{"!if (false) { 1 }", true},
 	}
 
 	for _, tt := range tests {
@@ -114,6 +136,293 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestLooseCoercion(t *testing.T) {
+	tests := []struct {
+		input  string
+		loose  string
+		strict string
+	}{
+		{`"3" * 4`, "12", "type mismatch: STRING * INTEGER"},
+		{`4 * "3"`, "12", "type mismatch: INTEGER * STRING"},
+		{`"3" + 4`, "34", "type mismatch: STRING + INTEGER"},
+		{`4 + "3"`, "43", "type mismatch: INTEGER + STRING"},
+		{`"x" + 1.5`, "x1.5", "type mismatch: STRING + FLOAT"},
+		{`"a" + true`, "atrue", "type mismatch: STRING + BOOLEAN"},
+		{`"10" - "4"`, "6", "unknown operator: STRING - STRING"},
+		{`" 7 " / 2`, "3", "type mismatch: STRING / INTEGER"},
+		{`"1.5" * 2`, "3", "type mismatch: STRING * INTEGER"},
+		{`"0x10" % 7`, "2", "type mismatch: STRING % INTEGER"},
+		{`"1.5" < 2`, "true", "type mismatch: STRING < INTEGER"},
+		{`"3" == 3`, "false", "false"},
+		{`"3" != 3`, "true", "true"},
+		{`"a" * 4`, "type mismatch: STRING * INTEGER", "type mismatch: STRING * INTEGER"},
+		{`"NaN" * 1`, "type mismatch: STRING * INTEGER", "type mismatch: STRING * INTEGER"},
+		{`"3" * 4 == 12`, "true", "type mismatch: STRING * INTEGER"},
+		{`1 + 2`, "3", "3"},
+		{`"a" + "b"`, "ab", "ab"},
+	}
+
+	for _, tt := range tests {
+		for _, loose := range []bool{true, false} {
+			env := object.NewEnvironment()
+			SetLooseCoercion(env, loose)
+			evaluated := testEvalIn(tt.input, env)
+
+			expected := tt.strict
+			if loose {
+				expected = tt.loose
+			}
+
+			got := evaluated.Inspect()
+			if errObj, ok := evaluated.(*object.Error); ok {
+				got = errObj.Message
+			}
+
+			if got != expected {
+				t.Errorf("%q with loose=%t: expected=%q, got=%q", tt.input, loose, expected, got)
+			}
+		}
+	}
+
+	loose := object.NewEnvironment()
+	if prev := SetLooseCoercion(loose, true); prev {
+		t.Errorf("loose coercion was on in a new environment")
+	}
+	testIntegerObject(t, testEvalIn(`"3" * 4`, loose), 12)
+	testErrorObject(t, testEval(`"3" * 4`), "type mismatch: STRING * INTEGER")
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"2 >= 2", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1", false},
+		{"1 >= 0.5", true},
+		{`"a" < "b"`, true},
+		{`"b" <= "a"`, false},
+		{`"abc" > "ab"`, true},
+		{`"a" >= "a"`, true},
+		{`"a" == "a"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"1" == 1`, false},
+		{"[1, 2] < [1, 3]", true},
+		{"[1, 3] < [1, 2]", false},
+		{"[1] < [1, 0]", true},
+		{"[1, 0] > [1]", true},
+		{"[] < [1]", true},
+		{"[1, 2] <= [1, 2]", true},
+		{"[1, 2] >= [1, 2]", true},
+		{"[1, 2] < [1, 2]", false},
+		{"[1, 2.5] < [1, 3]", true},
+		{`[[1, "b"], 0] > [[1, "a"], 5]`, true},
+		{`[1, "a"] < [2, 5]`, true},
+		{`[1, "a"] < [1, 5]`, "type mismatch: STRING < INTEGER"},
+		{`[true] >= [false]`, "unknown operator: BOOLEAN >= BOOLEAN"},
+		{`[1] < 1`, "type mismatch: ARRAY < INTEGER"},
+		{`true <= false`, "unknown operator: BOOLEAN <= BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBoolObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestIntegerWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		w64   int64
+		w32   int64
+	}{
+		{"65536 * 65536", 4294967296, 0},
+		{"100000 * 100000", 10000000000, 1410065408},
+		{"2147483647 + 1", 2147483648, -2147483648},
+		{"-2147483648 - 1", -2147483649, 2147483647},
+		{"let x = -2147483647 - 1; -x", 2147483648, -2147483648},
+		{"4294967295", 4294967295, -1},
+		{"2 ** 31", 2147483648, -2147483648},
+		{"1 << 32", 4294967296, 0},
+		{"let i = 2147483647; i++", 2147483648, -2147483648},
+		{"7 * 6", 42, 42},
+		{"-7 / 2", -3, -3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.w64)
+
+		env := object.NewEnvironment()
+		if prev := SetIntegerWidth(env, Width32); prev != Width64 {
+			t.Errorf("SetIntegerWidth returned wrong previous width. got=%d", prev)
+		}
+		testIntegerObject(t, testEvalIn(tt.input, env), tt.w32)
+	}
+
+	testIntegerObject(t, testEvalIn("sum([2147483647, 1])", object.NewEnvironment()), 2147483648)
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 << 4", 16},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"256 >> 4", 16},
+		{"-16 >> 2", -4},
+		{"-1 & 255", 255},
+		{"1 << 63 >> 63", -1},
+		{"1 << 64", 0},
+		{"5 << 0", 5},
+		{"1 | 2 | 4 & 6", 7},
+		{"(1 << 4 == 16) ? 1 : 0", 1},
+		{"(6 & 3 == 2) ? 1 : 0", 1},
+		{"1 << -1", "negative shift count: -1"},
+		{"8 >> -2", "negative shift count: -2"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"true | false", "unknown operator: BOOLEAN | BOOLEAN"},
+		{`"a" ^ "b"`, "unknown operator: STRING ^ STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"false ? 1 : 2", 2},
+		{"true ? 1 : 2 + 3", 1},
+		{"false ? 1 : 2 + 3", 5},
+		{"1 + (false ? 10 : 20)", 21},
+		{"let n = 0; n > 0 ? 1 : n < 0 ? -1 : 0", 0},
+		{"let n = -4; n > 0 ? 1 : n < 0 ? -1 : 0", -1},
+		{"let abs = fn(x) { x < 0 ? -x : x }; abs(-3) + abs(4)", 7},
+		{"true ? 1 : undefined", 1},
+		{"false ? undefined : 2", 2},
+		{"null_value ? 1 : 2", "identifier not found: null_value"},
+		{"true ? -true : 2", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestTruthiness(t *testing.T) {
+	tests := []struct {
+		input   string
+		def     bool
+		numeric bool
+	}{
+		{`if (0) { true } else { false }`, true, false},
+		{`if (1) { true } else { false }`, true, true},
+		{`if (-1) { true } else { false }`, true, true},
+		{`if (0.0) { true } else { false }`, true, false},
+		{`if (0.5) { true } else { false }`, true, true},
+		{`if ("") { true } else { false }`, true, true},
+		{`if ("0") { true } else { false }`, true, true},
+		{`if (false) { true } else { false }`, false, false},
+		{`if (is_null(1)) { true } else { false }`, false, false},
+		{`!0`, false, true},
+		{`0 || false`, true, false},
+		{`let n = 0; let i = 0; while (n && i < 1) { i++ }; i == 0`, false, true},
+		{`len(filter([0, 1, 2], fn(x) { x })) == 3`, true, false},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range []Truthiness{DefaultTruthiness, NumericTruthiness} {
+			expected := tt.def
+			if mode == NumericTruthiness {
+				expected = tt.numeric
+			}
+
+			env := object.NewEnvironment()
+			SetTruthiness(env, mode)
+			evaluated := testEvalIn(tt.input, env)
+
+			if !testBoolObject(t, evaluated, expected) {
+				t.Errorf("input %q in mode %d", tt.input, mode)
+			}
+		}
+	}
+}
+
+func TestTruthinessIsPerEnvironment(t *testing.T) {
+	numeric := object.NewEnvironment()
+	if prev := SetTruthiness(numeric, NumericTruthiness); prev != DefaultTruthiness {
+		t.Errorf("SetTruthiness returned wrong previous mode. got=%d", prev)
+	}
+
+	testBoolObject(t, testEvalIn(`let f = fn(x) { !x }; f(0)`, numeric), true)
+	testBoolObject(t, testEvalIn(`let f = fn(x) { !x }; f(0)`, object.NewEnvironment()), false)
+
+	if prev := SetTruthiness(numeric, DefaultTruthiness); prev != NumericTruthiness {
+		t.Errorf("SetTruthiness returned wrong previous mode. got=%d", prev)
+	}
+	testBoolObject(t, testEvalIn(`f(0)`, numeric), false)
+}
+
+func TestIfExpressionsAsValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = if (true) { 1 } else { 2 }; x", 1},
+		{"let x = if (false) { 1 } else { 2 }; x", 2},
+		{"let c = 5; let x = if (c > 3) { c * 2 } else { c }; x", 10},
+		{"let x = if (1 > 2) { 1 } else { if (true) { 3 } }; x", 3},
+		{"let x = 0; x = if (x == 0) { 7 } else { 8 }; x", 7},
+		{"let f = fn(n) { if (n > 0) { 1 } else { -1 } }; let x = f(-3); x", -1},
+		{"let x = if (false) { 1 }; x", nil},
+		{"let x = if (true) { }; x", nil},
+		{"let x = if (true) { let y = 1 }; x", nil},
+		{"let x = if (false) { 1 } else { }; x", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -190,6 +499,34 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }]`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`{[1]: 2}`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			`{"a": 1}[1.5]`,
+			"unusable as hash key: FLOAT",
+		},
+		{
+			"10 / 0",
+			"division by zero",
+		},
+		{
+			"10 % (5 - 5)",
+			"division by zero",
+		},
+		{
+			`"a" % "b"`,
+			"unknown operator: STRING % STRING",
+		},
+		{
+			"2 ** -1",
+			"negative exponent: -1",
+		},
+		{
+			"let f = fn(a, b) { a }; f(1)",
+			"wrong number of arguments. got=1, want=2",
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,6 +559,91 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 2; x;", 2},
+		{"let x = 1; x = x + 1; x = x * 10; x", 20},
+		{"let i = 0; while (i < 3) { i = i + 1 }; i", 3},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x", 5},
+		{"let x = 1; let f = fn(x) { x = 5 }; f(0); x", 1},
+		{"let f = fn() { let x = 1; if (true) { x = 2 }; x }; f()", 2},
+		{`let counter = fn() { let n = 0; fn() { n = n + 1; n } };
+		let c = counter(); c(); c(); c()`, 3},
+		{`let counter = fn() { let n = 0; fn() { n = n + 1; n } };
+		let a = counter(); let b = counter(); a(); a(); b()`, 1},
+		{`let pair = fn() {
+			let n = 0;
+			let inc = fn() { n = n + 1 };
+			let get = fn() { n };
+			[inc, get]
+		};
+		let p = pair(); p[0](); p[0](); p[1]()`, 2},
+		{"let f = fn() { let x = 1; let g = fn() { x }; x = 2; g() }; f()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 1", "identifier not found: x"},
+		{"let f = fn() { y = 1 }; f()", "identifier not found: y"},
+		{"let x = 1; x = -true; x", "unknown operator: -BOOLEAN"},
+	}
+
+	for _, tt := range errTests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q", tt.input)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+}
+
+func TestIncDecStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let i = 0; i++; i++; i", 2},
+		{"let i = 0; i--; i", -1},
+		{"let i = 5; i++", 6},
+		{"let i = 5; i--", 4},
+		{"let n = 0; let i = 0; while (i < 5) { n = n + i; i++ }; n", 10},
+		{"let c = fn() { let n = 0; fn() { n++ } }(); c(); c(); c()", 3},
+		{"5--3", 8},
+		{"let x = 4; --x", 4},
+		{"let x = 4; x--2", 6},
+		{"let x = 4; x--\n-1", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"i++", "identifier not found: i"},
+		{`let s = "a"; s++`, "unknown operator: STRING++"},
+		{"let f = 1.5; f--", "unknown operator: FLOAT--"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -269,6 +691,128 @@ func TestClosures(t *testing.T) {
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestClosureCapturesOnlyFreeVariables(t *testing.T) {
+	input := `
+    let make = fn(y) {
+        let big = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10];
+        let unused = "unused";
+        let x = 1;
+        fn(z) { let w = z * 2; x + y + w + len(big) - len(big) };
+    };
+    let f = make(2);
+    `
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	obj, _ := env.Get("f")
+	fn, ok := obj.(*object.Function)
+	if !ok {
+		t.Fatalf("f is not Function. got=%T (%+v)", obj, obj)
+	}
+
+	names := fn.Env.Names()
+	expected := []string{"big", "x", "y"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Errorf("closure captured wrong names. expected=%v, got=%v", expected, names)
+	}
+
+	if fn.Env.Global() != env {
+		t.Errorf("closure scope is not parented by the global environment")
+	}
+
+	result := Eval(parser.New(lexer.New("f(3)")).ParseProgram(), env)
+	testIntegerObject(t, result, 9)
+
+	makeFn, _ := env.Get("make")
+	if makeFn.(*object.Function).Env != env {
+		t.Errorf("top-level function should keep the global environment")
+	}
+}
+
+// opaqueExpression is an expression type the free variable scanner has no
+// case for.
+type opaqueExpression struct {
+	*ast.Identifier
+}
+
+func TestClosureCaptureFallbacks(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string // names in the closure's scope
+	}{
+		{"compact", `let f = fn(x) { let y = 2; fn() { x } }(1)`, []string{"x"}},
+		{"global value", `let x = 1; let f = fn() { let y = x; fn() { x } }()`, []string{}},
+		{"builtin", `let f = fn() { let y = 1; fn() { len([]) } }()`, []string{}},
+		// The whole defining scope holds g, the closure itself.
+		{"forward reference", `let f = fn() { let g = fn() { later() }; let later = fn() { 1 }; g }()`, []string{"g", "later"}},
+		{"shared scope", `let f = fn() { let x = 1; let g = fn() { x }; x = 2; g }()`, []string{"g", "x"}},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		Eval(parser.New(lexer.New(tt.input)).ParseProgram(), env)
+
+		obj, _ := env.Get("f")
+		fn, ok := obj.(*object.Function)
+		if !ok {
+			t.Fatalf("%s: f is not Function. got=%T (%+v)", tt.name, obj, obj)
+		}
+
+		if names := fn.Env.Names(); fmt.Sprint(names) != fmt.Sprint(tt.expected) {
+			t.Errorf("%s: closure scope has wrong names. expected=%v, got=%v", tt.name, tt.expected, names)
+		}
+	}
+
+	call := object.NewClosedEnv(object.NewEnvironment())
+	call.Set("x", &object.Integer{Value: 1})
+	lit := &ast.FunctionLiteral{Body: &ast.BlockStatement{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: opaqueExpression{&ast.Identifier{Value: "x"}}},
+	}}}
+	if captured, _ := captureEnv(lit, call); captured != call {
+		t.Errorf("a body with an unknown node should keep the whole defining scope")
+	}
+}
+
+func TestClosureCaptureSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let outer = fn() {
+            let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+            fact(5)
+        };
+        outer()`, 120},
+		{`let outer = fn() {
+            let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+            let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+            if (isEven(10)) { 1 } else { 0 }
+        };
+        outer()`, 1},
+		{`let f = fn() { fn() { g() } }; let h = f(); let g = fn() { 7 }; h()`, 7},
+		{`let f = fn(x) { fn() { let x = x + 1; x } }; f(1)()`, 2},
+		{`let f = fn(x) { fn(p) { match (p) { [a, b] => a + b + x; _ => x } } }; f(10)([1, 2])`, 13},
+		{`let f = fn(a) { fn(b) { fn(c) { a + b + c } } }; f(1)(2)(3)`, 6},
+		{`let x = 100; let f = fn() { fn() { x } }; f()()`, 100},
+		{`let x = 1; let g = fn() { x }; let x = 2; g()`, 2},
+		{`let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; f()`, 2},
+		{`let f = fn(x) { let g = fn() { x }; let x = 2; g() }; f(1)`, 2},
+		{`let y = 1; let f = fn() { let g = fn() { y }; let y = 2; g() }; f()`, 2},
+		{`let f = fn() {
+            let i = 0; let g = fn() { 0 };
+            while (i < 3) { let x = i; if (i == 0) { g = fn() { x } }; i++ };
+            g()
+        };
+        f()`, 2},
+		{`let f = fn() { let x = 1; let g = fn() { x }; let x = 2; g() }; let x = 5; f() + x`, 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
 func TestStringLiteral(t *testing.T) {
 	input := `"Hello World!"`
 	evaluated := testEval(input)
@@ -281,6 +825,18 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestBlockStringLiteral(t *testing.T) {
+	input := "let s = \"\"\"\nDear \"Monkey\",\n  ${not} interpolated\\n\n\"\"\";\ns"
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "\nDear \"Monkey\",\n  ${not} interpolated\\n\n" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 	evaluated := testEval(input)
@@ -324,6 +880,32 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestBuiltinIdentity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`len == len`, true},
+		{`puts == puts`, true},
+		{`sum == sum`, true},
+		{`let f = fn() { puts }; f() == puts`, true},
+		{`let p = puts; [p][0] == puts`, true},
+		{`puts != puts`, false},
+		{`puts == str`, false},
+	}
+
+	for _, tt := range tests {
+		testBoolObject(t, testEval(tt.input), tt.expected)
+	}
+
+	env := object.NewEnvironment()
+	testEvalIn(`let p = puts`, env)
+	p, _ := env.Get("p")
+	if other := testEval(`puts`); other == p {
+		t.Errorf("separate environments share a bound puts")
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	evaluated := testEval(input)
@@ -340,25 +922,2438 @@ func TestArrayLiterals(t *testing.T) {
 	testIntegerObject(t, result.Elements[2], 6)
 }
 
-func testEval(input string) object.Object {
-	l := lexer.New(input)
-	p := parser.New(l)
-
-	program := p.ParseProgram()
+func TestTimeBuiltins(t *testing.T) {
+	fixed := time.Date(2024, time.March, 9, 14, 5, 30, 0, time.UTC)
 	env := object.NewEnvironment()
+	SetClock(env, func() time.Time { return fixed })
 
-	return Eval(program, env)
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`year(time_now())`, 2024},
+		{`month(time_now())`, 3},
+		{`day(time_now())`, 9},
+		{`hour(time_now())`, 14},
+		{`minute(time_now())`, 5},
+		{`second(time_now())`, 30},
+		{`weekday(time_now())`, 6},
+		{`year(1)`, "argument to `year` must be TIME, got INTEGER"},
+		{`time_format(1, "YYYY")`, "first argument to `time_format` must be TIME, got INTEGER"},
+		{`time_now(1)`, "wrong number of arguments. got=1, want=0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalIn(tt.input, env)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
 }
 
-func TestArrayIndexExpressions(t *testing.T) {
+func TestTimeFormat(t *testing.T) {
+	fixed := time.Date(2024, time.March, 9, 14, 5, 30, 0, time.UTC)
+	env := object.NewEnvironment()
+	SetClock(env, func() time.Time { return fixed })
+
 	tests := []struct {
 		input    string
-		expected interface{}
+		expected string
 	}{
-		{
-			"[1, 2, 3][0]",
-			1,
-		},
+		{`time_format(time_now(), "YYYY-MM-DD")`, "2024-03-09"},
+		{`time_format(time_now(), "hh:mm:ss")`, "14:05:30"},
+		{`time_format(time_now(), "DD/MM/YY hh:mm")`, "09/03/24 14:05"},
+		{`time_format(time_now(), "Day 1 at hh")`, "Day 1 at 14"},
+		{`time_format(time_now(), "Mon Jan PM 2006 .000 MST")`, "Mon Jan PM 2006 .000 MST"},
+		{`time_format(time_now(), "YYYYY MMM hhh")`, "2024Y 03M 14h"},
+		{`time_now()`, "2024-03-09T14:05:30Z"},
+	}
+
+	if other := testEval(`time_now()`); other.Inspect() == "2024-03-09T14:05:30Z" {
+		t.Errorf("clock set on one environment leaked into another")
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalIn(tt.input, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestMergeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`merge()`, "{}"},
+		{`merge({"a": 1})`, "{a: 1}"},
+		{`merge({"a": 1}, {"b": 2})`, "{a: 1, b: 2}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3})`, "{a: 1, b: 3}"},
+		{`merge({"a": 1}, {"a": 2, "b": 2}, {"b": 3, "c": 3})`, "{a: 2, b: 3, c: 3}"},
+		{`merge({1: "x", true: "y"}, {1: "z"})`, "{true: y, 1: z}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		hash, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if hash.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, hash.Inspect())
+		}
+	}
+
+	input := `let a = {"x": 1}; let b = {"x": 2}; merge(a, b); a["x"]`
+	testIntegerObject(t, testEval(input), 1)
+
+	testErrorObject(t, testEval(`merge({"a": 1}, [1])`),
+		"argument 2 to `merge` must be HASH, got ARRAY")
+}
+
+func TestEntriesBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`entries({})`, "[]"},
+		{`entries({"b": 2, "a": 1})`, "[[a, 1], [b, 2]]"},
+		{`entries({3: "c", 1: "a", 2: "b"})`, "[[1, a], [2, b], [3, c]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		arr, ok := evaluated.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if arr.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, arr.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`entries([1])`), "argument to `entries` must be HASH, got ARRAY")
+}
+
+func TestInOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`3 in [1, 2, 3]`, true},
+		{`4 in [1, 2, 3]`, false},
+		{`1 in []`, false},
+		{`2.0 in [1, 2]`, true},
+		{`"b" in ["a", "b"]`, true},
+		{`"1" in [1, 2]`, false},
+		{`let xs = [1]; xs in [xs]`, true},
+		{`[1] in [[1]]`, false},
+		{`"ll" in "hello"`, true},
+		{`"lo!" in "hello"`, false},
+		{`"" in "abc"`, true},
+		{`"a" in {"a": 1}`, true},
+		{`"b" in {"a": 1}`, false},
+		{`1 in {1: "x"}`, true},
+		{`"1" in {1: "x"}`, false},
+		{`first([]) in {first([]): 1}`, true},
+		{`!(5 in [1, 2])`, true},
+		{`1 + 1 in [2] == true`, true},
+		{`let p = {"__eq__": fn(a, b) { true }}; 7 in [p]`, true},
+		{`let p = {"__eq__": fn(a, b) { missing }}; 1 in [p]`, "identifier not found: missing"},
+		{`[1] in {}`, "unusable as hash key: ARRAY"},
+		{`1 in "123"`, "type mismatch: INTEGER in STRING"},
+		{`1 in 123`, "unknown operator: INTEGER in INTEGER"},
+		{`contains([1, 2], 2)`, true},
+		{`contains("hello", "ell")`, true},
+		{`contains({"k": 0}, "v")`, false},
+		{`contains(5, 1)`, "unknown operator: INTEGER in INTEGER"},
+		{`contains([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBoolObject(t, evaluated, expected)
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestKeysAndValuesBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`keys({})`, "[]"},
+		{`values({})`, "[]"},
+		{`keys({"b": 2, "a": 1, "c": 3})`, "[a, b, c]"},
+		{`values({"b": 2, "a": 1, "c": 3})`, "[1, 2, 3]"},
+		{`keys({3: "c", 1: "a", 2: "b"})`, "[1, 2, 3]"},
+		{`values({3: "c", 1: "a", 2: "b"})`, "[a, b, c]"},
+		{`keys({"x": 1, 2: 2, true: 3})`, "[true, 2, x]"},
+		{`values({"x": 1, 2: 2, true: 3})`, "[3, 2, 1]"},
+		{`let h = {"b": [2], "a": [1]}; let k = keys(h); h[k[1]]`, "[2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`keys([1])`), "argument to `keys` must be HASH, got ARRAY")
+	testErrorObject(t, testEval(`values("a")`), "argument to `values` must be HASH, got STRING")
+	testErrorObject(t, testEval(`keys({}, {})`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestFromEntriesBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`from_entries([])`, "{}"},
+		{`from_entries([["a", 1], ["b", 2]])`, "{a: 1, b: 2}"},
+		{`from_entries([["a", 1], ["a", 2]])`, "{a: 2}"},
+		{`from_entries([[1, "one"], [true, "yes"]])`, "{true: yes, 1: one}"},
+		{`let h = {"x": 1, "y": 2}; from_entries(entries(h))`, "{x: 1, y: 2}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		hash, ok := evaluated.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if hash.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q",
+				tt.input, tt.expected, hash.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`from_entries({})`, "argument to `from_entries` must be ARRAY, got HASH"},
+		{`from_entries([1])`, "entry 0 to `from_entries` must be a [key, value] ARRAY, got 1"},
+		{`from_entries([["a", 1], ["b"]])`, "entry 1 to `from_entries` must be a [key, value] ARRAY, got [b]"},
+		{`from_entries([[[1], 1]])`, "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match ([1, 2]) { [a, b] => a + b; [] => 0; _ => -1 }`, 3},
+		{`match ([]) { [a, b] => a + b; [] => 0; _ => -1 }`, 0},
+		{`match ([1, 2, 3]) { [a, b] => a + b; [] => 0; _ => -1 }`, -1},
+		{`match (5) { [a, b] => a + b; [] => 0; _ => -1 }`, -1},
+		{`match (5) { 4 => 40; 5 => 50; _ => 0 }`, 50},
+		{`match (-1) { -1 => 10; _ => 0 }`, 10},
+		{`match ("b") { "a" => 1; "b" => 2 }`, 2},
+		{`match ([1, [2, 3]]) { [x, [y, z]] => x + y + z }`, 6},
+		{`match ([1, 2]) { [1, x] => x; _ => 0 }`, 2},
+		{`match ([2, 2]) { [1, x] => x; _ => 0 }`, 0},
+		{`match (x) { _ => 0 }`, "identifier not found: x"},
+		{`match (7) { 1 => 1 }`, nil},
+		{`let a = 1; match ([5]) { [a] => a }; a`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchGuards(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match ([3, 1]) { [a, b] if a > b => a; [a, b] => b }`, 3},
+		{`match ([1, 3]) { [a, b] if a > b => a; [a, b] => b }`, 3},
+		{`match ([1, 2]) { [a, b] if a == b => 0; [a, b] if a > b => 1; _ => 2 }`, 2},
+		{`match (4) { n if n < 0 => -1; 0 => 0; n => 1 }`, 1},
+		{`match (4) { n if false => n }`, nil},
+		{`match (4) { n if n + true => n }`, "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestFunctionEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let f = fn() {}; f == f", true},
+		{"let f = fn() {}; f != f", false},
+		{"let f = fn() {}; let g = f; f == g", true},
+		{"fn() {} == fn() {}", false},
+		{"let f = fn(x) { x }; let g = fn(x) { x }; f == g", false},
+		{"let f = fn(x) { x }; let g = fn(x) { x }; f != g", true},
+		{"let mk = fn() { fn() {} }; mk() == mk()", false},
+		{"let f = fn() {}; f == 1", false},
+	}
+
+	for _, tt := range tests {
+		testBoolObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval("fn() {} + fn() {}"), "unknown operator: FUNCTION + FUNCTION")
+}
+
+func TestCaseBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`equals_ignore_case("Hello", "hELLO")`, true},
+		{`equals_ignore_case("Hello", "Help")`, false},
+		{`equals_ignore_case("", "")`, true},
+		{`equals_ignore_case("GÖTEBORG", "göteborg")`, true},
+		{`equals_ignore_case("ΣΑΣ", "σας")`, true},
+		{`equals_ignore_case("a", 1)`, "arguments to `equals_ignore_case` must be STRING, got INTEGER"},
+		{`lower("MiXeD Ö")`, "mixed ö"},
+		{`upper("MiXeD ö")`, "MIXED Ö"},
+		{`lower(1)`, "argument to `lower` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case bool:
+			testBoolObject(t, evaluated, expected)
+		case string:
+			if str, ok := evaluated.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, expected, str.Value)
+				}
+				continue
+			}
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestSplitAndJoinBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`len(split("a,,b,", ","))`, "4"},
+		{`split("abc", ", ")`, "[abc]"},
+		{`len(split("", ","))`, "1"},
+		{`split("héllo", "")`, "[h, é, l, l, o]"},
+		{`split("", "")`, "[]"},
+		{`split("one  two", "  ")`, "[one, two]"},
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join([], "-")`, ""},
+		{`join(["solo"], "-")`, "solo"},
+		{`join(split("a b c", " "), "_")`, "a_b_c"},
+		{`join(split("abc", ""), "-")`, "a-b-c"},
+		{`join(map([1, 2], str), "+")`, "1+2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`split(1, ",")`, "arguments to `split` must be STRING, got INTEGER"},
+		{`split("a", [","])`, "arguments to `split` must be STRING, got ARRAY"},
+		{`split("a")`, "wrong number of arguments. got=1, want=2"},
+		{`join("abc", "")`, "first argument to `join` must be ARRAY, got STRING"},
+		{`join(["a"], 1)`, "second argument to `join` must be STRING, got INTEGER"},
+		{`join(["a", 2, "c"], ",")`, "element 1 to `join` must be STRING, got INTEGER"},
+		{`join(["a"])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLinesAndWordsBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`lines("a\nb\nc")`, "[a, b, c]"},
+		{`lines("a\nb\n")`, "[a, b]"},
+		{`len(lines("a\n\n"))`, "2"},
+		{`lines("a\r\nb\r\n")`, "[a, b]"},
+		{`len(lines("a\r\n\r\nb")[1])`, "0"},
+		{`lines("one\rtwo")[0]`, "one\rtwo"},
+		{`lines("")`, "[]"},
+		{`len(lines("\n"))`, "1"},
+		{`lines("solo")`, "[solo]"},
+		{`words("the  quick\tbrown\n fox")`, "[the, quick, brown, fox]"},
+		{`words("  padded  ")`, "[padded]"},
+		{`words("")`, "[]"},
+		{`words(" \t\n ")`, "[]"},
+		{`map(lines("a b\nc"), words)`, "[[a, b], [c]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`lines(1)`), "argument to `lines` must be STRING, got INTEGER")
+	testErrorObject(t, testEval(`words(["a b"])`), "argument to `words` must be STRING, got ARRAY")
+	testErrorObject(t, testEval(`words("a", "b")`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestIntBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`int(42)`, 42},
+		{`int("42")`, 42},
+		{`int("+42")`, 42},
+		{`int("-42")`, -42},
+		{`int("  7	")`, 7},
+		{`int(" -1_000 ")`, -1000},
+		{`int("1_000_000")`, 1000000},
+		{`int("")`, `could not parse "" as integer`},
+		{`int("-")`, `could not parse "-" as integer`},
+		{`int("abc")`, `could not parse "abc" as integer`},
+		{`int("12a")`, `could not parse "12a" as integer`},
+		{`int("1 000")`, `could not parse "1 000" as integer`},
+		{`int("_1")`, `could not parse "_1" as integer`},
+		{`int("1_")`, `could not parse "1_" as integer`},
+		{`int("1__0")`, `could not parse "1__0" as integer`},
+		{`int("+-1")`, `could not parse "+-1" as integer`},
+		{`int("0xFF")`, 255},
+		{`int("0XfF")`, 255},
+		{`int("-0x10")`, -16},
+		{`int("0b101")`, 5},
+		{`int("0B1_0_1")`, 5},
+		{`int("0o17")`, 15},
+		{`int("017")`, 15},
+		{`int("0")`, 0},
+		{`int("10")`, 10},
+		{`int("0x")`, `could not parse "0x" as integer`},
+		{`int("0b102")`, `could not parse "0b102" as integer`},
+		{`int("0xFG")`, `could not parse "0xFG" as integer`},
+		{`int("089")`, `could not parse "089" as integer`},
+		{`int("99999999999999999999")`, `could not parse "99999999999999999999" as integer`},
+		{`int(2.7)`, 2},
+		{`int(-2.7)`, -2},
+		{`int(0.5)`, 0},
+		{`int(3.0)`, 3},
+		{`int(1000000000000000000.0)`, 1000000000000000000},
+		{`int(10000000000000000000.0)`, "float 10000000000000000000 out of range for integer"},
+		{`int(-10000000000000000000.0)`, "float -10000000000000000000 out of range for integer"},
+		{`int(true)`, "argument to `int` not supported, got BOOLEAN"},
+		{`int("1", "2")`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestToIntBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`to_int(true)`, 1},
+		{`to_int(false)`, 0},
+		{`to_int(1 < 2) + to_int(2 < 1) + to_int(3 > 2)`, 2},
+		{`to_int(7)`, 7},
+		{`to_int(-7)`, -7},
+		{`to_int("42")`, 42},
+		{`to_int(" -0x10 ")`, -16},
+		{`to_int(2.9)`, 2},
+		{`to_int("4x")`, `could not parse "4x" as integer`},
+		{`to_int([1])`, "argument to `to_int` not supported, got ARRAY"},
+		{`to_int(first([]))`, "argument to `to_int` not supported, got NULL"},
+		{`to_int()`, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			testErrorObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestStrBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`str(42)`, "42"},
+		{`str(-1.5)`, "-1.5"},
+		{`str(true)`, "true"},
+		{`str(first([]))`, "null"},
+		{`str("text")`, "text"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str({"a": 1})`, "{a: 1}"},
+		{`str(int("12")) + "px"`, "12px"},
+		{`type(str(1))`, "STRING"},
+		{`len(str(12345))`, "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`str()`), "wrong number of arguments. got=0, want=1")
+	testErrorObject(t, testEval(`str(1, 2)`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestIdivmodBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`idivmod(7, 2)`, "[3, 1]"},
+		{`idivmod(-7, 2)`, "[-3, -1]"},
+		{`idivmod(7, -2)`, "[-3, 1]"},
+		{`idivmod(-7, -2)`, "[3, -1]"},
+		{`idivmod(6, 3)`, "[2, 0]"},
+		{`idivmod(0, -5)`, "[0, 0]"},
+		{`idivmod(1, 10)`, "[0, 1]"},
+		{`let a = -17; let b = 5; let qr = idivmod(a, b); qr[0] * b + qr[1] == a`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`idivmod(1, 0)`, "division by zero"},
+		{`idivmod(0, 0)`, "division by zero"},
+		{`idivmod(1.5, 2)`, "first argument to `idivmod` must be INTEGER, got FLOAT"},
+		{`idivmod(1, "2")`, "second argument to `idivmod` must be INTEGER, got STRING"},
+		{`idivmod(1)`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSaturatingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sat_add(3, 4, 0, 10)`, "7"},
+		{`sat_add(8, 4, 0, 10)`, "10"},
+		{`sat_add(-8, 4, -2, 10)`, "-2"},
+		{`sat_add(5, 5, 0, 10)`, "10"},
+		{`sat_sub(3, 4, -10, 10)`, "-1"},
+		{`sat_sub(3, 40, -10, 10)`, "-10"},
+		{`sat_sub(30, -4, -10, 10)`, "10"},
+		{`sat_mul(3, 4, -100, 100)`, "12"},
+		{`sat_mul(30, 4, -100, 100)`, "100"},
+		{`sat_mul(-30, 4, -100, 100)`, "-100"},
+		{`sat_add(9223372036854775807, 1, 0, 9223372036854775807)`, "9223372036854775807"},
+		{`sat_mul(-9223372036854775807, 4, -9223372036854775807 - 1, 0)`, "-9223372036854775808"},
+		{`sat_add(1, 1, 5, 5)`, "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`sat_add(1, 2, 10, 0)`, "bounds passed to `sat_add` are reversed: 10 > 0"},
+		{`sat_mul(1.5, 2, 0, 10)`, "arguments to `sat_mul` must be INTEGER, got FLOAT"},
+		{`sat_sub(1, 2, 0)`, "wrong number of arguments. got=3, want=4"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRotateBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`rotate([1, 2, 3, 4, 5], 2)`, "[3, 4, 5, 1, 2]"},
+		{`rotate([1, 2, 3, 4, 5], -2)`, "[4, 5, 1, 2, 3]"},
+		{`rotate([1, 2, 3, 4, 5], 0)`, "[1, 2, 3, 4, 5]"},
+		{`rotate([1, 2, 3, 4, 5], 5)`, "[1, 2, 3, 4, 5]"},
+		{`rotate([1, 2, 3, 4, 5], 12)`, "[3, 4, 5, 1, 2]"},
+		{`rotate([1, 2, 3, 4, 5], -12)`, "[4, 5, 1, 2, 3]"},
+		{`rotate([1, 2, 3], -9223372036854775807 - 1)`, "[2, 3, 1]"},
+		{`rotate([], 3)`, "[]"},
+		{`let a = [1, 2]; rotate(a, 1); a`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`rotate("abc", 1)`, "first argument to `rotate` must be ARRAY, got STRING"},
+		{`rotate([1], 1.5)`, "second argument to `rotate` must be INTEGER, got FLOAT"},
+		{`rotate([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSetPrecisionBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`0.1 + 0.2`, "0.30000000000000004"},
+		{`str(1.0 / 3)`, "0.3333333333333333"},
+		{`set_precision(2); 0.1 + 0.2`, "0.30"},
+		{`set_precision(2); [1.005 * 2, 0.5, 1]`, "[2.01, 0.50, 1]"},
+		{`set_precision(3); "${2.0 / 3}"`, "0.667"},
+		{`set_precision(0); 2.5 + 1`, "4"},
+		{`set_precision(1); 0.25 == 0.2`, "false"},
+		{`set_precision(4)`, "-1"},
+		{`set_precision(4); set_precision(-1); 0.1 + 0.2`, "0.30000000000000004"},
+		{`set_precision(4); set_precision(-3)`, "4"},
+		{`set_precision(2); str(1.0 / 3) + "s"`, "0.33s"},
+		{`set_precision(2); format("%s|%5s", 1.0 / 3, [0.5])`, "0.33|[0.50]"},
+		{`set_precision(2); template("{x}", {"x": 2.0})`, "2.00"},
+		{`set_precision(1); to_json(0.25)`, "0.25"},
+		{`set_precision(1); let f = fn() { 1.0 / 3 }; str(f())`, "0.3"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		evaluated := testEvalIn(tt.input, env)
+		got := displayString(evaluated, env)
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	env := object.NewEnvironment()
+	if prev := SetFloatPrecision(env, 2); prev != -1 {
+		t.Errorf("SetFloatPrecision returned wrong previous precision. expected=-1, got=%d", prev)
+	}
+	if got := displayString(testEvalIn("str(0.1 + 0.2)", env), env); got != "0.30" {
+		t.Errorf("precision set by the host not used. got=%q", got)
+	}
+	if got := testEval("str(0.1 + 0.2)").Inspect(); got != "0.30000000000000004" {
+		t.Errorf("precision leaked into another environment. got=%q", got)
+	}
+	if SetFloatPrecision(env, -5); env.Modes().FloatPrecision != -1 {
+		t.Errorf("negative precision not stored as -1. got=%d", env.Modes().FloatPrecision)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`set_precision(1.5)`, "argument to `set_precision` must be INTEGER, got FLOAT"},
+		{`set_precision(101)`, "precision passed to `set_precision` is too large: 101 > 100"},
+		{`set_precision()`, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRegisteredBuiltins(t *testing.T) {
+	newEnv := func() *object.Env {
+		env := object.NewEnvironment()
+		env.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+			n, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `double` must be INTEGER, got %s", args[0].Type())
+			}
+			return &object.Integer{Value: n.Value * 2}
+		})
+		env.RegisterBuiltin("len", func(args ...object.Object) object.Object {
+			return &object.String{Value: "host len"}
+		})
+		return env
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`double(21)`, "42"},
+		{`map([1, 2, 3], double)`, "[2, 4, 6]"},
+		{`let f = fn(x) { let g = fn() { double(x) }; g() }; f(5)`, "10"},
+		{`let apply = fn(h) { fn(x) { h(x) } }; apply(double)(4)`, "8"},
+		{`len([1, 2])`, "host len"},
+		{`let double = fn(x) { x }; double(3)`, "3"},
+		{`first([double(1)])`, "2"},
+		{`double("a")`, "Error: 1:7: argument to `double` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, newEnv())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`double(1)`), "identifier not found: double")
+}
+
+func TestWrapGoFunc(t *testing.T) {
+	wrap := func(fn interface{}) object.BuiltInFns {
+		builtin, err := WrapGoFunc(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return builtin.Fn
+	}
+
+	env := object.NewEnvironment()
+	env.RegisterBuiltin("repeat", wrap(strings.Repeat))
+	env.RegisterBuiltin("atoi", wrap(strconv.Atoi))
+	env.RegisterBuiltin("half", wrap(func(x float64) float64 { return x / 2 }))
+	env.RegisterBuiltin("total", wrap(func(xs ...int64) int64 {
+		var sum int64
+		for _, x := range xs {
+			sum += x
+		}
+		return sum
+	}))
+	env.RegisterBuiltin("byte", wrap(func(b uint8) uint8 { return b }))
+	env.RegisterBuiltin("fields", wrap(strings.Fields))
+	env.RegisterBuiltin("joined", wrap(func(parts [][]string, sep string) string {
+		out := []string{}
+		for _, p := range parts {
+			out = append(out, strings.Join(p, sep))
+		}
+		return strings.Join(out, "|")
+	}))
+	env.RegisterBuiltin("not", wrap(func(b bool) bool { return !b }))
+	env.RegisterBuiltin("kind", wrap(func(obj object.Object) string { return string(obj.Type()) }))
+	env.RegisterBuiltin("nothing", wrap(func() {}))
+	env.RegisterBuiltin("none", wrap(func() object.Object { return nil }))
+	env.RegisterBuiltin("huge", wrap(func() uint64 { return 1 << 63 }))
+	env.RegisterBuiltin("at", wrap(func(a []int, i int) int { return a[i] }))
+	env.RegisterBuiltin("single", wrap(func(x float32) float32 { return x * 2 }))
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`repeat("ab", 3)`, "ababab"},
+		{`atoi("42") + 1`, "43"},
+		{`atoi("x")`, `Error: 1:5: strconv.Atoi: parsing "x": invalid syntax`},
+		{`half(5)`, "2.5"},
+		{`half(1.5)`, "0.75"},
+		{`total()`, "0"},
+		{`total(1, 2, 3)`, "6"},
+		{`byte(255)`, "255"},
+		{`fields(" a b  c ")`, "[a, b, c]"},
+		{`fields("")`, "[]"},
+		{`joined([["a", "b"], [], ["c"]], "-")`, "a-b||c"},
+		{`not(true)`, "false"},
+		{`kind({})`, "HASH"},
+		{`nothing()`, "null"},
+		{`none()`, "null"},
+		{`repeat("a")`, "Error: 1:7: wrong number of arguments. got=1, want=2"},
+		{`repeat(1, 2)`, "Error: 1:7: argument 1 must be STRING, got INTEGER"},
+		{`half("1")`, "Error: 1:5: argument 1 must be FLOAT, got STRING"},
+		{`total(1, true)`, "Error: 1:6: argument 2 must be INTEGER, got BOOLEAN"},
+		{`byte(256)`, "Error: 1:5: argument 1 is out of range for uint8: 256"},
+		{`byte(-1)`, "Error: 1:5: argument 1 is out of range for uint8: -1"},
+		{`joined([["a", 1]], "")`, "Error: 1:7: element 1 of element 0 of argument 1 must be STRING, got INTEGER"},
+		{`joined("a", "")`, "Error: 1:7: argument 1 must be ARRAY, got STRING"},
+		{`huge()`, "Error: 1:5: result is out of range for INTEGER: 9223372036854775808"},
+		{`repeat("ab", -1)`, "Error: 1:7: strings: negative Repeat count"},
+		{`at([1, 2], 1)`, "2"},
+		{`at([1, 2], 5)`, "Error: 1:3: runtime error: index out of range [5] with length 2"},
+		{`single(1.5)`, "3"},
+		{`single(-3)`, "-6"},
+		{`single(100000000000000000000.0 * 10000000000000000000.0)`, "Error: 1:7: argument 1 is out of range for float32: 1e+39"},
+		{`single(-100000000000000000000.0 * 10000000000000000000.0)`, "Error: 1:7: argument 1 is out of range for float32: -1e+39"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%v", tt.input, tt.expected, evaluated)
+		}
+	}
+
+	invalid := []interface{}{
+		42,
+		func(m map[string]int) {},
+		func(c chan int) {},
+		func() (int, int) { return 0, 0 },
+		func() (error, int) { return nil, 0 },
+		func() (int, string, error) { return 0, "", nil },
+	}
+
+	for _, fn := range invalid {
+		if builtin, err := WrapGoFunc(fn); err == nil || builtin != nil {
+			t.Errorf("WrapGoFunc(%T) should fail. got=%v, %v", fn, builtin, err)
+		}
+	}
+}
+
+func TestSliceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], 0, 4)`, "[1, 2, 3, 4]"},
+		{`slice([1, 2, 3, 4], 2, 2)`, "[]"},
+		{`slice([1, 2, 3, 4], 3, 1)`, "[]"},
+		{`slice([1, 2, 3, 4], -5, 2)`, "[1, 2]"},
+		{`slice([1, 2, 3, 4], 2, 10)`, "[3, 4]"},
+		{`slice([], 0, 1)`, "[]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`slice("abc", 0, 1)`), "first argument to `slice` must be ARRAY, got STRING")
+	testErrorObject(t, testEval(`slice([1], "a", 1)`), "bounds to `slice` must be INTEGER, got STRING and INTEGER")
+}
+
+func TestSliceDoesNotShareStorage(t *testing.T) {
+	env := object.NewEnvironment()
+	program := parser.New(lexer.New(`let arr = [1, 2, 3, 4]; let sub = slice(arr, 1, 3);`)).ParseProgram()
+	Eval(program, env)
+
+	arr, _ := env.Get("arr")
+	sub, _ := env.Get("sub")
+
+	subArr := sub.(*object.Array)
+	subArr.Elements[0] = &object.Integer{Value: 99}
+	subArr.Elements = append(subArr.Elements, &object.Integer{Value: 100})
+
+	if arr.Inspect() != "[1, 2, 3, 4]" {
+		t.Errorf("mutating the slice changed the original. got=%s", arr.Inspect())
+	}
+
+	arr.(*object.Array).Elements[2] = &object.Integer{Value: -1}
+
+	if sub.Inspect() != "[99, 3, 100]" {
+		t.Errorf("mutating the original changed the slice. got=%s", sub.Inspect())
+	}
+}
+
+func TestNewErrorMessages(t *testing.T) {
+	left := &object.Integer{Value: 1}
+	right := &object.String{Value: "a"}
+
+	tests := []struct {
+		got      *object.Error
+		expected string
+	}{
+		{newError("identifier not found: x"), "identifier not found: x"},
+		{newError("wrong number of arguments. got=%d, want=%d", 2, 1), "wrong number of arguments. got=2, want=1"},
+		{newInfixError("type mismatch", left, "+", right), fmt.Sprintf("type mismatch: %s %s %s", left.Type(), "+", right.Type())},
+		{newInfixError("unknown operator", left, "-", right), fmt.Sprintf("unknown operator: %s %s %s", left.Type(), "-", right.Type())},
+	}
+
+	for _, tt := range tests {
+		if tt.got.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, tt.got.Message)
+		}
+	}
+}
+
+func BenchmarkNewError(b *testing.B) {
+	left := &object.Integer{Value: 1}
+	right := &object.Boolean{Value: true}
+
+	b.Run("sprintf", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newError("type mismatch: %s %s %s", left.Type(), "+", right.Type())
+		}
+	})
+
+	b.Run("infix", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newInfixError("type mismatch", left, "+", right)
+		}
+	})
+
+	b.Run("constant", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newError("division by zero")
+		}
+	})
+}
+
+func TestToJSONBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`to_json(1)`, `1`},
+		{`to_json(-7)`, `-7`},
+		{`to_json(2.5)`, `2.5`},
+		{`to_json([1.0, -0.25])`, `[1,-0.25]`},
+		{`to_json(true)`, `true`},
+		{`to_json(if (false) { 1 })`, `null`},
+		{`to_json("back\\slash <tag>")`, `"back\\slash \u003ctag\u003e"`},
+		{`to_json("say \"hi\"\n")`, `"say \"hi\"\n"`},
+		{`to_json([1, "two", [false]])`, `[1,"two",[false]]`},
+		{`to_json({"b": 2, "a": [1]})`, `{"a":[1],"b":2}`},
+		{`to_json({2: "two", 10: "ten", -1: "neg"})`, `{"-1":"neg","2":"two","10":"ten"}`},
+		{`to_json({true: 1, false: 0})`, `{"false":0,"true":1}`},
+		{`to_json({1: {true: [1]}})`, `{"1":{"true":[1]}}`},
+		{`to_json({})`, `{}`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong JSON for %q. expected=%s, got=%s", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	testErrorObject(t, testEval(`to_json([fn(x) { x }])`), "cannot convert FUNCTION to JSON")
+	testErrorObject(t, testEval(`to_json({1: "a", "1": "b"})`), `hash keys INTEGER 1 and STRING 1 are both "1" in JSON`)
+	testErrorObject(t, testEval(`to_json([{true: 1, "true": 2}])`), `hash keys BOOLEAN true and STRING true are both "true" in JSON`)
+	testErrorObject(t, testEval(`to_json({"null": 1, first([]): 2})`), `hash keys NULL null and STRING null are both "null" in JSON`)
+	testErrorObject(t, testEval(`to_json()`), "wrong number of arguments. got=0, want=1")
+}
+
+func TestSortByBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sort_by([], fn(x) { x })`, "[]"},
+		{`sort_by([3, 1, 2], fn(x) { x })`, "[1, 2, 3]"},
+		{`sort_by([3, 1, 2], fn(x) { -x })`, "[3, 2, 1]"},
+		{`sort_by(["pear", "fig", "apple"], fn(x) { x })`, "[apple, fig, pear]"},
+		{`sort_by(["pear", "fig", "apple"], len)`, "[fig, pear, apple]"},
+		{
+			`let people = [{"name": "bo", "age": 30}, {"name": "al", "age": 25}, {"name": "cy", "age": 30}, {"name": "di", "age": 25}];
+			let sorted = sort_by(people, fn(p) { p["age"] });
+			[sorted[0]["name"], sorted[1]["name"], sorted[2]["name"], sorted[3]["name"]]`,
+			"[al, di, bo, cy]",
+		},
+		{`let arr = [2, 1]; sort_by(arr, fn(x) { x }); arr`, "[2, 1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`sort_by(1, fn(x) { x })`, "first argument to `sort_by` must be ARRAY, got INTEGER"},
+		{`sort_by([1, "a"], fn(x) { x })`, "keys for `sort_by` must all have the same type, got INTEGER and STRING"},
+		{`sort_by([true], fn(x) { x })`, "keys for `sort_by` must be INTEGER or STRING, got BOOLEAN"},
+		{`sort_by([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`sort_by([1], 1)`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEvalFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5", 2.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 2.5", 3.5},
+		{"2.5 + 1", 3.5},
+		{"10 - 0.5", 9.5},
+		{"1.5 * 4", 6},
+		{"7 / 2.0", 3.5},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 3", 8},
+		{"4 ** 0.5", 2},
+		{"2 ** -1.0", 0.5},
+		{"-(1 + 0.25)", -1.25},
+		{"let half = fn(x) { x / 2.0 }; half(5)", 2.5},
+	}
+
+	for _, tt := range tests {
+		testFloatObject(t, testEval(tt.input), tt.expected)
+	}
+
+	boolTests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"3.0 == 3", true},
+		{"3 != 3.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 == 2.5", true},
+	}
+
+	for _, tt := range boolTests {
+		testBoolObject(t, testEval(tt.input), tt.expected)
+	}
+
+	inspectTests := []struct {
+		input    string
+		expected string
+	}{
+		{"1.5 + 1.5", "3"},
+		{"1 / 4.0", "0.25"},
+		{"[1.0, 2.5]", "[1, 2.5]"},
+	}
+
+	for _, tt := range inspectTests {
+		if got := testEval(tt.input).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	testErrorObject(t, testEval("1.5 / 0"), "division by zero")
+	testErrorObject(t, testEval("1 % 0.0"), "division by zero")
+	testErrorObject(t, testEval("1.5 + true"), "type mismatch: FLOAT + BOOLEAN")
+	testErrorObject(t, testEval(`"a" + 1.5`), "type mismatch: STRING + FLOAT")
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`while (false) { 1 }`, "null"},
+		{`while (if (false) { 1 }) { 1 }`, "null"},
+		{`let f = fn() { while (true) { return 5; } }; f()`, "5"},
+		{`let f = fn(n) { while (n > 0) { return n * 2; } 0 }; [f(3), f(0)]`, "[6, 0]"},
+		{`let f = fn() { while (true) { if (true) { return "out" } } }; f()`, "out"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`while (true) { 1 + true; }`), "type mismatch: INTEGER + BOOLEAN")
+	testErrorObject(t, testEval(`while (missing) { 1 }`), "identifier not found: missing")
+	testErrorObject(t, testEval(`let f = fn() { while (true) { x } }; f()`), "identifier not found: x")
+}
+
+func TestForInStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let out = []; for (x in [1, 2, 3]) { out = push(out, x * 2) }; out`, "[2, 4, 6]"},
+		{`let out = []; for (x in range(10, 0, -1)) { out = push(out, x) }; out`, "[10, 9, 8, 7, 6, 5, 4, 3, 2, 1]"},
+		{`let out = []; for (x in range(10, 0, -3)) { out = push(out, x) }; out`, "[10, 7, 4, 1]"},
+		{`let out = []; for (x in range(0, 10, -1)) { out = push(out, x) }; out`, "[]"},
+		{`let out = []; for (x in range(3, 3, -1)) { out = push(out, x) }; out`, "[]"},
+		{`let out = []; for (x in range(3)) { out = push(out, x) }; out`, "[0, 1, 2]"},
+		{`let out = []; for (c in "héllo") { out = push(out, c) }; out`, "[h, é, l, l, o]"},
+		{`let out = []; for (k in {"b": 1, "a": 2}) { out = push(out, k) }; out`, "[a, b]"},
+		{`for (x in []) { 1 }`, "null"},
+		{`for (x in [1]) { x }`, "null"},
+		{`let n = 0; for (x in range(1000000000000)) { if (x == 5) { break }; n = x }; n`, "4"},
+		{`let n = 0; for (x in range(10, 0, -1)) { if (x % 2 == 0) { continue }; n = n + x }; n`, "25"},
+		{`let f = fn(xs) { for (x in xs) { if (x > 1) { return x } }; 0 }; [f([1, 5, 7]), f([])]`, "[5, 0]"},
+		{`let x = 99; for (x in [1, 2]) { }; x`, "99"},
+		{`let f = fn() { let x = 5; for (x in [1, 2]) { }; x }; f()`, "5"},
+		{`let total = 0; for (x in [1, 2, 3]) { total = total + x }; total`, "6"},
+		{`let n = 0; for (x in [1, 2]) { let n = x }; n`, "0"},
+		{`let xs = [1, 2]; for (x in xs) { xs = push(xs, x) }; xs`, "[1, 2, 1, 2]"},
+		{`let f = fn() { let fs = []; for (i in range(3)) { fs = push(fs, fn() { i }) }; fs }; map(f(), fn(g) { g() })`, "[0, 1, 2]"},
+		{`let range = fn(n) { [n] }; let out = []; for (x in range(3)) { out = push(out, x) }; out`, "[3]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`for (x in range(10, 0, 0)) { x }`), "step for `range` must not be zero")
+	testErrorObject(t, testEval(`for (x in range(0, 10, 0)) { x }`), "step for `range` must not be zero")
+	testErrorObject(t, testEval(`for (x in range("a")) { x }`), "arguments to `range` must be INTEGER, got STRING")
+	testErrorObject(t, testEval(`for (x in range(missing)) { x }`), "identifier not found: missing")
+	testErrorObject(t, testEval(`for (x in 5) { x }`), "cannot iterate over INTEGER")
+	testErrorObject(t, testEval(`for (x in [1]) { x + true }`), "type mismatch: INTEGER + BOOLEAN")
+	testErrorObject(t, testEval(`for (x in [1]) { }; x`), "identifier not found: x")
+	testErrorObject(t, testEval(`for (x in [1]) { let y = x }; y`), "identifier not found: y")
+}
+
+func TestOperatorOverloading(t *testing.T) {
+	point := `
+	let point = fn(x, y) {
+		{
+			"x": x,
+			"y": y,
+			"__add__": fn(a, b) { point(a["x"] + b["x"], a["y"] + b["y"]) },
+			"__eq__": fn(a, b) { a["x"] == b["x"] && a["y"] == b["y"] }
+		}
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let p = point(1, 2) + point(10, 20); [p["x"], p["y"]]`, "[11, 22]"},
+		{`let p = point(1, 1) + point(1, 1) + point(1, 1); p["x"]`, "3"},
+		{`point(1, 2) == point(1, 2)`, "true"},
+		{`point(1, 2) == point(2, 1)`, "false"},
+		{`point(1, 2) != point(2, 1)`, "true"},
+		{`point(1, 2) != point(1, 2)`, "false"},
+		{`point(1, 2) == {"x": 1, "y": 2}`, "true"},
+		{`{"x": 1, "y": 2} == point(1, 2)`, "true"},
+		{`let p = point(0, 0); p == p`, "true"},
+		{`{"a": 1} == {"a": 1}`, "false"},
+		{`let h = {"__add__": fn(a, b) { b * 2 }}; h + 21`, "42"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(point + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(point+`point(1, 2) - point(1, 2)`), "unknown operator: HASH - HASH")
+	testErrorObject(t, testEval(point+`point(1, 2) + 5`), "index operator not supported: INTEGER[STRING]")
+	testErrorObject(t, testEval(`{"__add__": 1} + 2`), "not a function: INTEGER")
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	// tick is a stand-in for mutable state, which Monkey doesn't have yet:
+	// each call returns the next integer.
+	ticks := int64(0)
+	builtins["tick"] = &object.BuiltIn{Fn: func(args ...object.Object) object.Object {
+		ticks++
+		return &object.Integer{Value: ticks}
+	}}
+	defer delete(builtins, "tick")
+
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	SetOutput(env, &out)
+
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`while (true) { break; }`, "null", ""},
+		{`while (true) { let n = tick(); if (n > 3) { break } puts(n) }`, "null", "1\n2\n3\n"},
+		{`while (tick() < 6) { if (tick() % 2 == 0) { continue } puts("odd") }`, "null", ""},
+		{`while (true) { let n = tick(); if (n % 2 == 0) { continue } if (n > 6) { break } puts(n) }`, "null", "1\n3\n5\n"},
+		{`let f = fn() { while (true) { while (true) { break } return "inner loop ended" } }; f()`, "inner loop ended", ""},
+		{`let f = fn() { while (true) { if (tick() == 3) { break } } "done" }; [f(), tick()]`, "[done, 4]", ""},
+	}
+
+	for _, tt := range tests {
+		ticks = 0
+		out.Reset()
+
+		evaluated := testEvalIn(tt.input, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+		if out.String() != tt.output {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.output, out.String())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`break`, "break outside loop"},
+		{`1; continue; 2`, "continue outside loop"},
+		{`if (true) { break }`, "break outside loop"},
+		{`let f = fn() { break }; while (true) { f() }`, "break outside loop"},
+		{`map([1], fn(x) { continue })`, "continue outside loop"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEvalIn(tt.input, env), tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && \"\"", true},
+		{"1 && if (false) { 1 }", false},
+		{"0 || [1]", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false && 1 + true", false},
+		{"true || 1 + true", true},
+		{"!(true && false)", true},
+		{"let x = 5; x > 1 && x < 10", true},
+	}
+
+	for _, tt := range tests {
+		testBoolObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval("true && 1 + true"), "type mismatch: INTEGER + BOOLEAN")
+	testErrorObject(t, testEval("1 + true || true"), "type mismatch: INTEGER + BOOLEAN")
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "Sam"; "hi ${name}!"`, "hi Sam!"},
+		{`"${1 + 2} apples"`, "3 apples"},
+		{`"${[1, "a"]} and ${ {"k": true}["k"] }"`, "[1, a] and true"},
+		{`"price: \${5}"`, "price: ${5}"},
+		{`"brace: ${ {"k": "}"}["k"] }"`, "brace: }"},
+		{`let f = fn(x) { "<${x}>" }; f("a") + f(2.5)`, "<a><2.5>"},
+		{`let g = fn(x) { fn() { "x=${x}" } }; g(7)()`, "x=7"},
+		{`"${"inner ${1 + 1}"}!"`, "inner 2!"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	testErrorObject(t, testEval(`"${missing}"`), "identifier not found: missing")
+}
+
+func TestPutsStringEscapes(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	SetOutput(env, &out)
+
+	testEvalIn(`puts("line1\nline2\t\"end\"")`, env)
+
+	expected := "line1\nline2\t\"end\"\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+
+	var other bytes.Buffer
+	otherEnv := object.NewEnvironment()
+	SetOutput(otherEnv, &other)
+	testEvalIn(`puts("other")`, otherEnv)
+	if out.String() != expected || other.String() != "other\n" {
+		t.Errorf("output of one environment leaked into another. got=%q and %q", out.String(), other.String())
+	}
+}
+
+func TestLogicalOperatorsShortCircuit(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	SetOutput(env, &out)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`false && puts("x")`, ""},
+		{`true || puts("x")`, ""},
+		{`true && puts("x")`, "x\n"},
+		{`false || puts("x")`, "x\n"},
+		{`let f = fn(v) { puts(v); v }; f(false) && f(true); f(true) || f(false)`, "false\ntrue\n"},
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		testEvalIn(tt.input, env)
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestNullBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is_null(first([]))`, "true"},
+		{`is_null(last([]))`, "true"},
+		{`is_null({"a": 1}["b"])`, "true"},
+		{`is_null([1][5])`, "true"},
+		{`is_null(if (false) { 1 })`, "true"},
+		{`is_null(0)`, "false"},
+		{`is_null(false)`, "false"},
+		{`is_null("")`, "false"},
+		{`is_null([])`, "false"},
+		{`default({"a": 1}["b"], 0)`, "0"},
+		{`default({"a": 1}["a"], 0)`, "1"},
+		{`default(first([]), "none")`, "none"},
+		{`default(false, true)`, "false"},
+		{`default(0, 5)`, "0"},
+		{`is_null(default(first([]), first([])))`, "true"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`is_null()`), "wrong number of arguments. got=0, want=1")
+	testErrorObject(t, testEval(`default(1)`), "wrong number of arguments. got=1, want=2")
+}
+
+func TestTypeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type(1.5)`, "FLOAT"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(first([]))`, "NULL"},
+		{`type("a")`, "STRING"},
+		{`type([1, 2])`, "ARRAY"},
+		{`type({"a": 1})`, "HASH"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(time_now())`, "TIME"},
+		{`type(type(1))`, "STRING"},
+		{`let check = fn(x) { if (type(x) == "ARRAY") { len(x) } else { -1 } }; [check([1, 2]), check(5)]`, "[2, -1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	if got := typeFunc(newError("boom")).Inspect(); got != "ERROR" {
+		t.Errorf("type of an error is wrong. expected=%q, got=%q", "ERROR", got)
+	}
+
+	testErrorObject(t, testEval(`type(1/0)`), "division by zero")
+	testErrorObject(t, testEval(`type()`), "wrong number of arguments. got=0, want=1")
+	testErrorObject(t, testEval(`type(1, 2)`), "wrong number of arguments. got=2, want=1")
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "Error: 1:3: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1;\n-true", "Error: 2:1: unknown operator: -BOOLEAN"},
+		{"[1, 2][\"a\"]", "Error: 1:7: index operator not supported: ARRAY[STRING]"},
+		{"let x = 1;\n  y", "Error: 2:3: identifier not found: y"},
+		{"len(1)", "Error: 1:4: argument to `len` not supported, got INTEGER"},
+		{"let f = fn(a) { a };\nf()", "Error: 2:2: wrong number of arguments. got=0, want=1"},
+		{"if (10 > 1) {\n  if (1 + true) { 1 }\n}", "Error: 2:9: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if err.Inspect() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Inspect())
+		}
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+let twice = fn(x) {
+  add(x, x)
+};
+map([1], fn(x) { twice(true) })`
+
+	evaluated := testEval(input)
+	err, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := `Error: 2:5: unknown operator: BOOLEAN + BOOLEAN
+  in add at 5:6
+  in twice at 7:23
+  in map at 7:4`
+	if err.Trace() != expected {
+		t.Errorf("wrong trace. expected=%q, got=%q", expected, err.Trace())
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	root := newError("division by zero")
+
+	wrapped := wrapErrorFunc(&object.String{Value: "computing ratio"}, root)
+	testErrorObject(t, wrapped, "computing ratio: division by zero")
+
+	outer := wrapErrorFunc(&object.String{Value: "report"}, wrapped)
+	testErrorObject(t, outer, "report: computing ratio: division by zero")
+
+	if got := outer.(*object.Error).Cause; got != wrapped {
+		t.Errorf("cause of outer error is wrong. expected=%v, got=%v", wrapped, got)
+	}
+	if got := wrapped.(*object.Error).Cause; got != root {
+		t.Errorf("cause of wrapped error is wrong. expected=%v, got=%v", root, got)
+	}
+	if root.Cause != nil {
+		t.Errorf("unwrapped error has a cause. got=%v", root.Cause)
+	}
+
+	evaluated := testEval(`let check = fn(x) { if (x < 0) { return wrap_error("checking " + str(x), "negative") } x }; check(-1); 5`)
+	testErrorObject(t, evaluated, "checking -1: negative")
+	if cause := evaluated.(*object.Error).Cause; cause == nil || cause.Message != "negative" {
+		t.Errorf("string cause not wrapped as an error. got=%v", cause)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`wrap_error("context", 1 / 0)`, "division by zero"},
+		{`wrap_error(1, "cause")`, "first argument to `wrap_error` must be STRING, got INTEGER"},
+		{`wrap_error("context", 1)`, "second argument to `wrap_error` must be CAUGHT_ERROR or STRING, got INTEGER"},
+		{`wrap_error("context")`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTryAndCause(t *testing.T) {
+	load := `let load = fn() { wrap_error("loading config", "file missing") };`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is_error(try(load))`, "true"},
+		{`str(try(load))`, "Error: 1:29: loading config: file missing"},
+		{`str(cause(try(load)))`, "Error: file missing"},
+		{`is_error(cause(try(load)))`, "true"},
+		{`cause(cause(try(load)))`, "null"},
+		{`let e = try(fn() { 1 / 0 }); str(cause(try(fn() { wrap_error("outer", e) })))`, "Error: 1:87: division by zero"},
+		{`type(try(load))`, "CAUGHT_ERROR"},
+		{`try(fn(x) { x * 2 }, 21)`, "42"},
+		{`is_error(42)`, "false"},
+		{`let e = try(load); 1; "still running"`, "still running"},
+		{`let r = try(fn() { 1 / 0 }); if (is_error(r)) { "fallback" } else { r }`, "fallback"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(load + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`try(1)`, "first argument to `try` must be FUNCTION, got INTEGER"},
+		{`try()`, "wrong number of arguments. got=0, want at least 1"},
+		{`cause("oops")`, "argument to `cause` must be CAUGHT_ERROR, got STRING"},
+		{`cause()`, "wrong number of arguments. got=0, want=1"},
+		{`is_error()`, "wrong number of arguments. got=0, want=1"},
+		{`wrap_error("again", try(fn() { 1 / 0 }))`, "again: division by zero"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFormatBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("plain")`, "plain"},
+		{`format("%d + %d", 1, 2)`, "1 + 2"},
+		{`format("[%5d]", 42)`, "[   42]"},
+		{`format("[%-5d]", 42)`, "[42   ]"},
+		{`format("[%2d]", 12345)`, "[12345]"},
+		{`format("[%5d]", -7)`, "[   -7]"},
+		{`format("%.2f", 3.14159)`, "3.14"},
+		{`format("%f", 2.5)`, "2.500000"},
+		{`format("%.0f", 2.5)`, "2"},
+		{`format("[%8.3f]", 1)`, "[   1.000]"},
+		{`format("[%-8.1f]", -0.25)`, "[-0.2    ]"},
+		{`format("[%6s|%-6s]", "ab", "cd")`, "[    ab|cd    ]"},
+		{`format("%.3s", "monkey")`, "mon"},
+		{`format("%s", [1, true])`, "[1, true]"},
+		{`format("[%4s]", "héé")`, "[ héé]"},
+		{`format("100%%")`, "100%"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("%d", "x")`, "`%d` in `format` needs INTEGER, got STRING"},
+		{`format("%f", true)`, "`%f` in `format` needs FLOAT or INTEGER, got BOOLEAN"},
+		{`format("%d %d", 1)`, "not enough arguments to `format`"},
+		{`format("%d", 1, 2)`, "too many arguments to `format`: 1 unused"},
+		{`format("%x", 1)`, "bad directive in `format`: \"%x\""},
+		{`format("50%")`, "bad directive in `format`: \"%\""},
+		{`format("%9000000000000000000d", 1)`, "width or precision in `format` is too large: \"%9000000000000000000d\", the most is 65536"},
+		{`format("%.99999999999999999999999f", 1.5)`, "width or precision in `format` is too large: \"%.99999999999999999999999f\", the most is 65536"},
+		{`format("%65537s", "a")`, "width or precision in `format` is too large: \"%65537s\", the most is 65536"},
+		{`format(1)`, "first argument to `format` must be STRING, got INTEGER"},
+		{`format()`, "wrong number of arguments. got=0, want at least 1"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestVectorBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`vec_add([1, 2, 3], [10, 20, 30])`, "[11, 22, 33]"},
+		{`vec_add([1, 2], [0.5, 0.25])`, "[1.5, 2.25]"},
+		{`vec_add([], [])`, "[]"},
+		{`vec_scale([1, -2, 3], 2)`, "[2, -4, 6]"},
+		{`vec_scale([1, 2], 0.5)`, "[0.5, 1]"},
+		{`dot([1, 2, 3], [4, 5, 6])`, "32"},
+		{`dot([1, 2], [0.5, 0.5])`, "1.5"},
+		{`dot([], [])`, "0"},
+		{`let a = [1, 2]; vec_add(a, a); a`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`vec_add([1, 2], [1, 2, 3])`, "arrays passed to `vec_add` must have the same length, got 2 and 3"},
+		{`dot([1], [])`, "arrays passed to `dot` must have the same length, got 1 and 0"},
+		{`vec_add([1, "a"], [1, 2])`, "elements of `vec_add` arguments must be INTEGER or FLOAT, got STRING"},
+		{`dot([true], [1])`, "elements of `dot` arguments must be INTEGER or FLOAT, got BOOLEAN"},
+		{`vec_scale(1, 2)`, "arguments to `vec_scale` must be ARRAY, got INTEGER"},
+		{`vec_scale([1], "2")`, "second argument to `vec_scale` must be INTEGER or FLOAT, got STRING"},
+		{`dot([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNumericReducers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sum([1, 2, 3, 4])`, "10"},
+		{`sum([1, 2.5])`, "3.5"},
+		{`sum([])`, "0"},
+		{`product([1, 2, 3, 4])`, "24"},
+		{`product([2, 0.5])`, "1"},
+		{`product([])`, "1"},
+		{`average([1, 2, 3, 4])`, "2.5"},
+		{`average([2, 4])`, "3"},
+		{`type(average([2, 4]))`, "FLOAT"},
+		{`average([])`, "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`sum([1, "2"])`, "elements of `sum` arguments must be INTEGER or FLOAT, got STRING"},
+		{`product([true])`, "elements of `product` arguments must be INTEGER or FLOAT, got BOOLEAN"},
+		{`average([1, first([])])`, "elements of `average` arguments must be INTEGER or FLOAT, got NULL"},
+		{`sum(1)`, "arguments to `sum` must be ARRAY, got INTEGER"},
+		{`average([1], [2])`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMatrixBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`transpose([[1, 2, 3], [4, 5, 6]])`, "[[1, 4], [2, 5], [3, 6]]"},
+		{`transpose([[1, 2]])`, "[[1], [2]]"},
+		{`transpose([["a", true]])`, "[[a], [true]]"},
+		{`transpose([])`, "[]"},
+		{`transpose([[], []])`, "[]"},
+		{`matmul([[1, 2, 3], [4, 5, 6]], [[7, 8], [9, 10], [11, 12]])`, "[[58, 64], [139, 154]]"},
+		{`matmul([[1, 0], [0, 1]], [[0.5, 2], [3, 4]])`, "[[0.5, 2], [3, 4]]"},
+		{`let m = [[1, 2], [3, 4]]; matmul(m, transpose(m))`, "[[5, 11], [11, 25]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`matmul([[1, 2, 3], [4, 5, 6]], [[1, 2], [3, 4]])`,
+			"cannot multiply 2x3 matrix by 2x2 matrix: 3 columns do not match 2 rows",
+		},
+		{
+			`transpose([[1, 2], [3]])`,
+			"matrix passed to `transpose` is not rectangular: row 0 has 2 columns, row 1 has 1",
+		},
+		{`transpose([1, 2])`, "rows of a matrix passed to `transpose` must be ARRAY, got INTEGER"},
+		{`transpose("m")`, "argument to `transpose` must be ARRAY, got STRING"},
+		{`matmul([["a"]], [[1]])`, "elements of a matrix passed to `matmul` must be INTEGER or FLOAT, got STRING"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInvertBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`invert({"a": 1, "b": 2})`, "{1: a, 2: b}"},
+		{`invert({1: true, 2: false})`, "{false: 2, true: 1}"},
+		{`invert(invert({"x": "y", "z": "w"}))`, "{x: y, z: w}"},
+		{`invert({"a": 1, "b": 1, "c": 2, "d": 1})`, "{1: d, 2: c}"},
+		{`invert({})`, "{}"},
+		{`let h = {"a": 1}; invert(h); h`, "{a: 1}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`invert({"a": [1]})`, "unusable as hash key: ARRAY"},
+		{`invert([1, 2])`, "argument to `invert` must be HASH, got ARRAY"},
+		{`invert({}, {})`, "wrong number of arguments. got=2, want=1"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFrequenciesBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`frequencies([])`, "{}"},
+		{`frequencies([3, 1, 3, 2, 3, 1])`, "{1: 2, 2: 1, 3: 3}"},
+		{`frequencies(["b", "a", "b"])`, "{a: 1, b: 2}"},
+		{`frequencies([true, 1, "1", true])`, "{true: 2, 1: 1, 1: 1}"},
+		{`frequencies(["x", "y", "x"])["x"]`, "2"},
+		{
+			`let top = sort_by(entries(frequencies(["a", "b", "b", "c", "b", "a"])), fn(e) { -e[1] });
+			top[0]`,
+			"[b, 3]",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`frequencies([1, [2]])`), "unusable as hash key: ARRAY")
+	testErrorObject(t, testEval(`frequencies("abc")`), "argument to `frequencies` must be ARRAY, got STRING")
+}
+
+func TestTemplateBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`template("Hello, {name}!", {"name": "Sam"})`, "Hello, Sam!"},
+		{`template("{a}+{b}={c}", {"a": 1, "b": 2.5, "c": [3.5]})`, "1+2.5=[3.5]"},
+		{`template("{x}{x}", {"x": "ab"})`, "abab"},
+		{`template("no placeholders", {})`, "no placeholders"},
+		{`template("{{literal}} {v}", {"v": true})`, "{literal} true"},
+		{`template("{{{v}}}", {"v": 1})`, "{1}"},
+		{`template("a } b", {})`, "a } b"},
+		{`template("{1}-{0}", ["x", "y"])`, "y-x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`template("Hi {who}", {"name": "Sam"})`, "no value for placeholder {who} in `template`"},
+		{`template("{2}", ["a"])`, "no value for placeholder {2} in `template`"},
+		{`template("Hi {name", {"name": "Sam"})`, "unclosed placeholder in `template`: \"{name\""},
+		{`template("x", 1)`, "second argument to `template` must be HASH or ARRAY, got INTEGER"},
+		{`template(1, {})`, "first argument to `template` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMapAndFilterBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	SetOutput(env, &out)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "b"], upper)`, "[A, B]"},
+		{`filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })`, "[2, 4]"},
+		{`filter([1, 2], fn(x) { false })`, "[]"},
+		{`let arr = [1, 2]; map(arr, fn(x) { x + 1 }); arr`, "[1, 2]"},
+		{`map({"b": 2, "a": 1}, fn(k, v) { v * 10 })`, "{a: 10, b: 20}"},
+		{`map({"x": 1, "y": 2}, fn(k, v) { k + str_of(v) })`, "{x: x1, y: y2}"},
+		{`map({}, fn(k, v) { v })`, "{}"},
+		{`filter({"a": 1, "b": 2, "c": 3}, fn(k, v) { v != 2 })`, "{a: 1, c: 3}"},
+		{`filter({1: "one", 2: "two"}, fn(k) { k > 1 })`, "{2: two}"},
+		{`let h = {"a": 1}; map(h, fn(k, v) { v + 1 }); h`, "{a: 1}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalIn("let str_of = fn(v) { \"${v}\" }; "+tt.input, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	out.Reset()
+	testEvalIn(`map({"c": 3, "a": 1, "b": 2}, fn(k, v) { puts(k); v })`, env)
+	if out.String() != "a\nb\nc\n" {
+		t.Errorf("hash pairs not visited in key order. got=%q", out.String())
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`map(1, fn(x) { x })`, "first argument to `map` must be ARRAY or HASH, got INTEGER"},
+		{`filter("s", fn(x) { x })`, "first argument to `filter` must be ARRAY or HASH, got STRING"},
+		{`map([1, true], fn(x) { x + 1 })`, "type mismatch: BOOLEAN + INTEGER"},
+		{`filter({"a": 1}, fn(k, v) { v + k })`, "type mismatch: INTEGER + STRING"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments. got=1, want=2"},
+		{`map([1], 5)`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEvalIn(tt.input, env), tt.expected)
+	}
+}
+
+func TestReduceBuiltin(t *testing.T) {
+	var out bytes.Buffer
+	env := object.NewEnvironment()
+	SetOutput(env, &out)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10"},
+		{`reduce([], 42, fn(acc, x) { acc + x })`, "42"},
+		{`reduce(["a", "b", "c"], "", fn(acc, x) { x + acc })`, "cba"},
+		{`reduce([1, 2, 3], [], fn(acc, x) { push(acc, x * x) })`, "[1, 4, 9]"},
+		{`reduce([3, 1, 2], 0, fn(acc, x) { x > acc ? x : acc })`, "3"},
+		{`let add = fn(a, b) { a + b }; reduce(map([1, 2], fn(x) { x * 10 }), 1, add)`, "31"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalIn(tt.input, env)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	out.Reset()
+	evaluated := testEvalIn(`reduce([1, 2, "x", 3], 0, fn(acc, x) { puts(x); acc + x })`, env)
+	testErrorObject(t, evaluated, "type mismatch: INTEGER + STRING")
+	if out.String() != "1\n2\nx\n" {
+		t.Errorf("reduce kept going after an error. got=%q", out.String())
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`reduce({"a": 1}, 0, fn(acc, x) { acc })`, "first argument to `reduce` must be ARRAY, got HASH"},
+		{`reduce([1], 0, 5)`, "third argument to `reduce` must be FUNCTION, got INTEGER"},
+		{`reduce([], 0, 5)`, "third argument to `reduce` must be FUNCTION, got INTEGER"},
+		{`reduce([1], fn(acc, x) { acc })`, "wrong number of arguments. got=2, want=3"},
+		{`reduce([1], 0, fn(acc, x, y) { acc })`, "wrong number of arguments. got=2, want=3"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEvalIn(tt.input, env), tt.expected)
+	}
+}
+
+func TestPartitionBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`partition([1, 2, 3, 4, 5], fn(x) { x % 2 == 1 })`, "[[1, 3, 5], [2, 4]]"},
+		{`partition([2, 4], fn(x) { x > 0 })`, "[[2, 4], []]"},
+		{`partition([2, 4], fn(x) { x > 10 })`, "[[], [2, 4]]"},
+		{`partition([], fn(x) { true })`, "[[], []]"},
+		{`partition([1, first([]), 2], is_null)`, "[[null], [1, 2]]"},
+		{`partition([0, 1, first([]), "x"], fn(x) { x })`, "[[0, 1, x], [null]]"},
+		{`let arr = [1, 2]; partition(arr, fn(x) { x > 1 }); arr`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`partition({"a": 1}, fn(x) { x })`, "first argument to `partition` must be ARRAY, got HASH"},
+		{`partition([1], 1)`, "second argument to `partition` must be FUNCTION, got INTEGER"},
+		{`partition([1, "a"], fn(x) { x > 0 })`, "type mismatch: STRING > INTEGER"},
+		{`partition([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTakeAndDropWhileBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`take_while([1, 2, 3, 1], fn(x) { x < 3 })`, "[1, 2]"},
+		{`drop_while([1, 2, 3, 1], fn(x) { x < 3 })`, "[3, 1]"},
+		{`take_while([5, 1], fn(x) { x < 3 })`, "[]"},
+		{`drop_while([5, 1], fn(x) { x < 3 })`, "[5, 1]"},
+		{`take_while([1, 2], fn(x) { x < 3 })`, "[1, 2]"},
+		{`drop_while([1, 2], fn(x) { x < 3 })`, "[]"},
+		{`take_while([], fn(x) { false })`, "[]"},
+		{`drop_while([], fn(x) { false })`, "[]"},
+		{`take_while([0, 1, first([]), 2], fn(x) { x })`, "[0, 1]"},
+		{`let calls = 0; take_while([1, 5, 1, 1], fn(x) { calls++; x < 3 }); calls`, "2"},
+		{`drop_while([1, 5, "a"], fn(x) { x < 3 })`, `[5, a]`},
+		{`let arr = [1, 2]; let t = take_while(arr, fn(x) { true }); t[0] = 9; arr`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`take_while("ab", fn(x) { true })`, "first argument to `take_while` must be ARRAY, got STRING"},
+		{`drop_while([1], 1)`, "second argument to `drop_while` must be FUNCTION, got INTEGER"},
+		{`take_while([1, "a"], fn(x) { x < 3 })`, "type mismatch: STRING < INTEGER"},
+		{`drop_while([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFlatMapBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`flat_map([1, 2], fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]"},
+		{`flat_map([0, 1, 2, 3], fn(x) { fill(x, x) })`, "[1, 2, 2, 3, 3, 3]"},
+		{`flat_map([1, 2, 3], fn(x) { [] })`, "[]"},
+		{`flat_map([], fn(x) { [x] })`, "[]"},
+		{`flat_map([[1, [2]], [3]], fn(x) { x })`, "[1, [2], 3]"},
+		{`flat_map(["ab", "c"], fn(s) { [s, len(s)] })`, "[ab, 2, c, 1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`flat_map([1, 2], fn(x) { x })`, "function passed to `flat_map` must return ARRAY, got INTEGER"},
+		{`flat_map("ab", fn(x) { [x] })`, "first argument to `flat_map` must be ARRAY, got STRING"},
+		{`flat_map([], "f")`, "second argument to `flat_map` must be FUNCTION, got STRING"},
+		{`flat_map([1], fn(x) { [x + true] })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`flat_map([1])`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRangeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`range(5)`, "[0, 1, 2, 3, 4]"},
+		{`range(0)`, "[]"},
+		{`range(-3)`, "[]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(-2, 1)`, "[-2, -1, 0]"},
+		{`range(5, 2)`, "[]"},
+		{`range(3, 3)`, "[]"},
+		{`range(0, 10, 3)`, "[0, 3, 6, 9]"},
+		{`range(0, 9, 3)`, "[0, 3, 6]"},
+		{`range(5, 0, -1)`, "[5, 4, 3, 2, 1]"},
+		{`range(5, -5, -4)`, "[5, 1, -3]"},
+		{`range(0, 5, -1)`, "[]"},
+		{`range(1, 1, -1)`, "[]"},
+		{`let r = range(10, 0, -3); let out = []; let i = 0; while (i < len(r)) { out = push(out, r[i]); i++ }; out`, "[10, 7, 4, 1]"},
+		{`range(9223372036854775806, 9223372036854775807)`, "[9223372036854775806]"},
+		{`range(-9223372036854775807 - 1, 9223372036854775807, 9223372036854775807)`, "[-9223372036854775808, -1, 9223372036854775806]"},
+		{`map(range(1, 4), fn(x) { x * x })`, "[1, 4, 9]"},
+		{`reduce(range(1, 5), 1, fn(acc, x) { acc * x })`, "24"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`range(0, 5, 0)`, "step for `range` must not be zero"},
+		{`range(9000000000000000000)`, "range is too long: 9000000000000000000 elements > 16777216"},
+		{`range(9223372036854775807, -9223372036854775807 - 1, -1)`, "range is too long: 18446744073709551615 elements > 16777216"},
+		{`range("5")`, "arguments to `range` must be INTEGER, got STRING"},
+		{`range(0, 1.5)`, "arguments to `range` must be INTEGER, got FLOAT"},
+		{`range()`, "wrong number of arguments. got=0, want=1 to 3"},
+		{`range(1, 2, 3, 4)`, "wrong number of arguments. got=4, want=1 to 3"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBsearchBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`bsearch([1, 3, 5, 7, 9], 5)`, "2"},
+		{`bsearch([1, 3, 5, 7, 9], 1)`, "0"},
+		{`bsearch([1, 3, 5, 7, 9], 9)`, "4"},
+		{`bsearch([1, 3, 5, 7, 9], 4)`, "-1"},
+		{`bsearch([1, 3, 5, 7, 9], 0)`, "-1"},
+		{`bsearch([1, 3, 5, 7, 9], 10)`, "-1"},
+		{`bsearch([], 1)`, "-1"},
+		{`bsearch([4], 4)`, "0"},
+		{`bsearch([1, 2, 2, 2, 3], 2)`, "1"},
+		{`bsearch([1, 2.5, 4], 2.5)`, "1"},
+		{`bsearch([1.0, 2.0], 2)`, "1"},
+		{`bsearch(["apple", "kiwi", "pear"], "kiwi")`, "1"},
+		{`bsearch([[1, 2], [1, 3], [2, 0]], [1, 3])`, "1"},
+		{`bsearch(range(0, 1000, 2), 998)`, "499"},
+		{`bsearch(range(0, 1000, 2), 999)`, "-1"},
+		{`bsearch_by(["a", "ccc", "dddd"], 3, len)`, "1"},
+		{`bsearch_by(["a", "ccc", "dddd"], 2, len)`, "-1"},
+		{`bsearch_by([{"id": 1}, {"id": 4}, {"id": 6}], 6, fn(r) { r["id"] })`, "2"},
+		{`bsearch_by([3, 2, 1], -3, fn(x) { -x })`, "0"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`bsearch([1, 2], "a")`, "type mismatch: INTEGER < STRING"},
+		{`bsearch([true], true)`, "unknown operator: BOOLEAN < BOOLEAN"},
+		{`bsearch("abc", "b")`, "first argument to `bsearch` must be ARRAY, got STRING"},
+		{`bsearch([1])`, "wrong number of arguments. got=1, want=2"},
+		{`bsearch_by([1], 1, fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`bsearch_by([1], 1, 1)`, "not a function: INTEGER"},
+		{`bsearch_by({}, 1, len)`, "first argument to `bsearch_by` must be ARRAY, got HASH"},
+		{`bsearch_by([1], 1)`, "wrong number of arguments. got=2, want=3"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFillBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fill(3, 0)`, "[0, 0, 0]"},
+		{`fill(0, 1)`, "[]"},
+		{`fill(2, "ab")`, "[ab, ab]"},
+		{`fill(2, [1, [2]])`, "[[1, [2]], [1, [2]]]"},
+		{`fill_with(3, fn(i) { i * i })`, "[0, 1, 4]"},
+		{`fill_with(0, fn(i) { i })`, "[]"},
+		{`fill_with(2, fn(i) { fill(i, i) })`, "[[], [1]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	arr := testEval(`fill(2, [1])`).(*object.Array)
+	if arr.Elements[0] == arr.Elements[1] {
+		t.Errorf("fill shares array elements instead of copying them")
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fill(-1, 0)`, "count for `fill` must not be negative, got -1"},
+		{`fill(9000000000000000000, 0)`, "count for `fill` is too large: 9000000000000000000 > 16777216"},
+		{`fill_with(16777217, fn(i) { i })`, "count for `fill_with` is too large: 16777217 > 16777216"},
+		{`fill("3", 0)`, "first argument to `fill` must be INTEGER, got STRING"},
+		{`fill_with(2, fn(i) { i + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`fill_with(1, 1)`, "not a function: INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestGetBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`get({"a": 1}, "a", 0)`, "1"},
+		{`get({"a": 1}, "b", 0)`, "0"},
+		{`get({}, 1, "none")`, "none"},
+		{`get({"a": last([])}, "a", 0)`, "null"},
+		{`get_or_else({"a": 1}, "a", fn() { 0 })`, "1"},
+		{`get_or_else({"a": 1}, "b", fn() { 2 * 21 })`, "42"},
+		{`let calls = {"n": 0}; let f = fn() { set(calls, "n", calls["n"] + 1) }; get_or_else({"a": 1}, "a", f); calls["n"]`, "0"},
+		{`let calls = {"n": 0}; let f = fn() { set(calls, "n", calls["n"] + 1) }; get_or_else({"a": 1}, "b", f); calls["n"]`, "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`get({}, [], 0)`, "unusable as hash key: ARRAY"},
+		{`get_or_else({}, {}, fn() { 0 })`, "unusable as hash key: HASH"},
+		{`get([1], 0, 0)`, "first argument to `get` must be HASH, got ARRAY"},
+		{`get_or_else({}, "a", 0)`, "third argument to `get_or_else` must be FUNCTION, got INTEGER"},
+		{`get({}, "a")`, "wrong number of arguments. got=2, want=3"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSetBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let h = {}; set(h, "a", 1); h`, "{a: 1}"},
+		{`let h = {"a": 1}; set(h, "a", 2); h["a"]`, "2"},
+		{`set({}, 1, "one")`, "one"},
+		{`let h = {}; let alias = h; set(alias, true, 0); h`, "{true: 0}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	testErrorObject(t, testEval(`set([], 0, 1)`), "first argument to `set` must be HASH, got ARRAY")
+	testErrorObject(t, testEval(`set({}, [], 1)`), "unusable as hash key: ARRAY")
+
+	cycles := []string{
+		`let h = {}; set(h, "a", h); puts(h)`,
+		`let h = {}; set(h, "a", [1, {"b": h}])`,
+		`let h = {}; let g = {"h": h}; set(h, "g", g)`,
+	}
+	for _, input := range cycles {
+		testErrorObject(t, testEval(input), "value passed to `set` contains the hash it is stored in")
+	}
+
+	nested := testEval(`let h = {}; let g = {}; set(g, "h", h); set(h, "x", 1); g`)
+	if nested.Inspect() != "{h: {x: 1}}" {
+		t.Errorf("nesting a hash in another hash failed. got=%s", nested.Inspect())
+	}
+}
+
+func TestDeleteBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`delete({"a": 1, "b": 2}, "a")`, "{b: 2}"},
+		{`delete({"a": 1, 2: 3, true: 4}, 2)`, "{true: 4, a: 1}"},
+		{`delete({"a": 1}, "z")`, "{a: 1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`delete([1, 2, 3], 0)`, "[2, 3]"},
+		{`delete([1, 2, 3], 1)`, "[1, 3]"},
+		{`delete([1, 2, 3], -1)`, "[1, 2]"},
+		{`delete([1, 2, 3], 3)`, "[1, 2, 3]"},
+		{`delete([], 0)`, "[]"},
+		{`let a = [1, 2]; delete(a, 0); a`, "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`delete({}, [])`, "unusable as hash key: ARRAY"},
+		{`delete([1], "0")`, "index to `delete` must be INTEGER, got STRING"},
+		{`delete("abc", 0)`, "first argument to `delete` must be HASH or ARRAY, got STRING"},
+		{`delete({})`, "wrong number of arguments. got=1, want=2"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNewBuiltin(t *testing.T) {
+	counter := `
+	let Counter = fn(start) {
+		{
+			"count": start,
+			"increment": fn() { set(self, "count", self["count"] + 1) },
+			"add": fn(n) { set(self, "count", self["count"] + n); self }
+		}
+	};
+	`
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let c = new(Counter, 5); c["increment"](); c["increment"](); c["count"]`, "7"},
+		{`let c = new(Counter, 0); c["add"](10)["add"](5)["count"]`, "15"},
+		{`let a = new(Counter, 0); let b = new(Counter, 100); a["increment"](); [a["count"], b["count"]]`, "[1, 100]"},
+		{`let c = new(Counter, 1); let inc = c["increment"]; inc(); c["count"]`, "2"},
+		{`new(fn() { {} })`, "{}"},
+		{`let self = "outer"; let c = new(fn() { {"who": fn() { self["name"] }, "name": "obj"} }); [c["who"](), self]`, "[obj, outer]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(counter + tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`new(fn() { 1 })`, "constructor passed to `new` must return HASH, got INTEGER"},
+		{`new(Counter)`, "wrong number of arguments. got=0, want=1"},
+		{`new()`, "wrong number of arguments. got=0, want at least 1"},
+		{`let c = new(fn() { {"f": fn() { self["missing"] + 1 }} }); c["f"]()`, "type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(counter+tt.input), tt.expected)
+	}
+}
+
+func TestSerializeBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`deserialize(serialize(42))`, "42"},
+		{`deserialize(serialize(-2.75))`, "-2.75"},
+		{`deserialize(serialize("hi"))`, "hi"},
+		{`deserialize(serialize(if (false) { 1 }))`, "null"},
+		{`deserialize(serialize([1, [true, "x"], {"k": [2]}]))`, "[1, [true, x], {k: [2]}]"},
+		{`deserialize(serialize({1: "a", "b": {false: []}}))`, "{1: a, b: {false: []}}"},
+		{`deserialize(serialize(true)) == true`, "true"},
+		{`let s = serialize([1, 2]); deserialize(s)[1] + 1`, "3"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`serialize(fn(x) { x })`, "cannot serialize FUNCTION"},
+		{`serialize({"f": len})`, "cannot serialize BUILTIN"},
+		{`deserialize("nope")`, "not a serialized value"},
+		{`deserialize(1)`, "argument to `deserialize` must be STRING, got INTEGER"},
+		{`serialize()`, "wrong number of arguments. got=0, want=1"},
+	}
+
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testEval(input string) object.Object {
+	return testEvalIn(input, object.NewEnvironment())
+}
+
+// testEvalIn evaluates input in env, for tests that set modes on it first.
+func testEvalIn(input string, env *object.Env) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+
+	return Eval(program, env)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			"[1, 2, 3][0]",
+			1,
+		},
 		{
 			"[1, 2, 3][1]",
 			2,
@@ -393,6 +3388,22 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"let myArray = [1, 2, 3]; myArray[-1] == last(myArray) ? 1 : 0",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
+			nil,
+		},
+		{
+			"[][-1]",
 			nil,
 		},
 	}
@@ -407,6 +3418,100 @@ func TestArrayIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[1]`, "e"},
+		{`"hello"[4]`, "o"},
+		{`let s = "abc"; s[1 + 1]`, "c"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"日本語"[2]`, "語"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-1]`, "o"},
+		{`"hello"[-5]`, "h"},
+		{`"日本語"[-3]`, "日"},
+		{`"hello"[-6]`, nil},
+		{`""[0]`, nil},
+		{`"日本語"[3]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("wrong character for %q. expected=%q, got=%q", tt.input, expected, str.Value)
+		}
+	}
+
+	testErrorObject(t, testEval(`"hello"["a"]`), "index operator not supported: STRING[STRING]")
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[1, 2, 3, 4][1:3]`, "[2, 3]"},
+		{`[1, 2, 3, 4][:2]`, "[1, 2]"},
+		{`[1, 2, 3, 4][2:]`, "[3, 4]"},
+		{`[1, 2, 3, 4][:]`, "[1, 2, 3, 4]"},
+		{`[1, 2, 3][1:100]`, "[2, 3]"},
+		{`[1, 2, 3][5:]`, "[]"},
+		{`[1, 2, 3][2:1]`, "[]"},
+		{`let a = [1, 2, 3]; let n = 1; a[n:n + 1]`, "[2]"},
+		{`"hello"[1:3]`, "el"},
+		{`"hello"[:4]`, "hell"},
+		{`"hello"[3:]`, "lo"},
+		{`"hello"[10:]`, ""},
+		{`"héllo"[1:3]`, "él"},
+		{`[1, 2, 3, 4][-2:]`, "[3, 4]"},
+		{`[1, 2, 3, 4][:-1]`, "[1, 2, 3]"},
+		{`[1, 2, 3, 4][-3:-1]`, "[2, 3]"},
+		{`[1, 2, 3][-10:2]`, "[1, 2]"},
+		{`"héllo"[-3:]`, "llo"},
+		{`"hello"[:-10]`, ""},
+		{`[1][true:]`, "slice bounds must be INTEGER, got BOOLEAN"},
+		{`[1][:"2"]`, "slice bounds must be INTEGER, got STRING"},
+		{`5[1:2]`, "slice operator not supported: INTEGER"},
+		{`[1][:x]`, "identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		got := evaluated.Inspect()
+		switch obj := evaluated.(type) {
+		case *object.String:
+			got = obj.Value
+		case *object.Error:
+			got = obj.Message
+		}
+
+		if got != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	arr := testEval(`let a = [1, 2, 3]; let b = a[:]; [a, b]`).(*object.Array)
+	if &arr.Elements[0].(*object.Array).Elements[0] == &arr.Elements[1].(*object.Array).Elements[0] {
+		t.Errorf("slice shares storage with its source")
+	}
+}
+
 func TestHashLiterals(t *testing.T) {
 	input := `let two = "two";
     {
@@ -475,6 +3580,18 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`let n = first([]); {n: 5}[n]`,
+			5,
+		},
+		{
+			`{first([]): 5}[if (false) { 1 }]`,
+			5,
+		},
+		{
+			`{first([]): 5}[false]`,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -487,6 +3604,42 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestNullHashKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{first([]): 1}`, "{null: 1}"},
+		{`let n = first([]); {n: 1}[last([])]`, "1"},
+		{`len(keys({first([]): 1, false: 2, 0: 3, "": 4}))`, "4"},
+		{`keys({first([]): 1})`, "[null]"},
+		{`to_json({first([]): 1})`, `{"null":1}`},
+		{`deserialize(serialize({first([]): 1}))[first([])]`, "1"},
+		{`delete({first([]): 1, "a": 2}, first([]))`, "{a: 2}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func testFloatObject(t *testing.T, evaluated object.Object, expected float64) bool {
+	res, ok := evaluated.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float, got %T (%+v)", evaluated, evaluated)
+		return false
+	}
+
+	if res.Value != expected {
+		t.Errorf("object has wrong value, expected %g, got %g", expected, res.Value)
+		return false
+	}
+	return true
+}
+
 func testIntegerObject(t *testing.T, evaluated object.Object, expected int64) bool {
 	res, ok := evaluated.(*object.Integer)
 	if !ok {
@@ -522,3 +3675,17 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
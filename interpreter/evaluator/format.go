@@ -0,0 +1,242 @@
+package evaluator
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+// formatSpec is one parsed `%` directive: %[-][width][.precision]verb.
+type formatSpec struct {
+	left      bool
+	width     int
+	precision int // -1 when no precision was given
+	verb      byte
+}
+
+// formatFunc implements `format(fmt, args...)`. It understands a small,
+// fixed set of directives rather than handing the string to Go's fmt, so
+// scripts can't reach verbs Monkey values don't support:
+//
+//	%d  INTEGER
+//	%f  FLOAT or INTEGER, with 6 decimal places unless a precision is given
+//	%s  any value, printed as by puts; a precision truncates it
+//	%%  a literal percent sign
+//
+// Any directive may carry a width, which pads on the left, or on the right
+// when the directive starts with '-': format("[%-4d]", 7) is "[7   ]".
+func formatFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError("wrong number of arguments. got=%d, want at least 1", len(args))
+	}
+
+	if args[0].Type() != object.STRING_OBJ {
+		return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+	}
+
+	layout := args[0].(*object.String).Value
+	values := args[1:]
+
+	var out strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			out.WriteByte(layout[i])
+			continue
+		}
+
+		spec, n, ok := parseFormatSpec(layout[i+1:])
+		if !ok {
+			return newError("bad directive in `format`: %q", layout[i:i+1+n])
+		}
+		if spec.width > maxFormatWidth || spec.precision > maxFormatWidth {
+			return newError("width or precision in `format` is too large: %q, the most is %d", layout[i:i+1+n], maxFormatWidth)
+		}
+		i += n
+
+		if spec.verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if len(values) == 0 {
+			return newError("not enough arguments to `format`")
+		}
+
+		text, err := formatValue(spec, values[0], env)
+		if err != nil {
+			return err
+		}
+		values = values[1:]
+
+		out.WriteString(pad(text, spec))
+	}
+
+	if len(values) > 0 {
+		return newError("too many arguments to `format`: %d unused", len(values))
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// parseFormatSpec parses the directive following a '%' and reports how many
+// bytes of s it used.
+func parseFormatSpec(s string) (formatSpec, int, bool) {
+	spec := formatSpec{precision: -1}
+	i := 0
+
+	if i < len(s) && s[i] == '-' {
+		spec.left = true
+		i++
+	}
+
+	spec.width, i = readFormatNumber(s, i)
+
+	if i < len(s) && s[i] == '.' {
+		i++
+		spec.precision, i = readFormatNumber(s, i)
+	}
+
+	if i >= len(s) {
+		return spec, i, false
+	}
+
+	spec.verb = s[i]
+	i++
+
+	switch spec.verb {
+	case 'd', 'f', 's':
+		return spec, i, true
+	case '%':
+		return spec, i, i == 1
+	default:
+		return spec, i, false
+	}
+}
+
+// maxFormatWidth bounds the width and precision a directive may ask for.
+const maxFormatWidth = 1 << 16
+
+// readFormatNumber reads the digits at s[i:]. A number past maxFormatWidth
+// is read to its end but stops growing, so that it can't overflow.
+func readFormatNumber(s string, i int) (int, int) {
+	n := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		if n <= maxFormatWidth {
+			n = n*10 + int(s[i]-'0')
+		}
+		i++
+	}
+
+	return n, i
+}
+
+func formatValue(spec formatSpec, val object.Object, env *object.Env) (string, *object.Error) {
+	switch spec.verb {
+	case 'd':
+		i, ok := val.(*object.Integer)
+		if !ok {
+			return "", newError("`%%d` in `format` needs INTEGER, got %s", val.Type())
+		}
+		return strconv.FormatInt(i.Value, 10), nil
+
+	case 'f':
+		if !isNumber(val) {
+			return "", newError("`%%f` in `format` needs FLOAT or INTEGER, got %s", val.Type())
+		}
+		precision := spec.precision
+		if precision < 0 {
+			precision = 6
+		}
+		return strconv.FormatFloat(floatValue(val), 'f', precision, 64), nil
+
+	default:
+		text := displayString(val, env)
+		if spec.precision >= 0 && utf8.RuneCountInString(text) > spec.precision {
+			text = string([]rune(text)[:spec.precision])
+		}
+		return text, nil
+	}
+}
+
+// pad widens text to spec.width characters with spaces.
+func pad(text string, spec formatSpec) string {
+	n := spec.width - utf8.RuneCountInString(text)
+	if n <= 0 {
+		return text
+	}
+
+	if spec.left {
+		return text + strings.Repeat(" ", n)
+	}
+
+	return strings.Repeat(" ", n) + text
+}
+
+// templateFunc implements `template(str, values)`, replacing each {name}
+// placeholder in str. With a HASH, names are looked up as string keys; with
+// an ARRAY, placeholders are positions, as in template("{0}-{1}", [a, b]).
+// Strings are inserted as-is and other values as puts prints them. A
+// placeholder with no value is an error. {{ and }} stand for literal braces.
+func templateFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	if args[0].Type() != object.STRING_OBJ {
+		return newError("first argument to `template` must be STRING, got %s", args[0].Type())
+	}
+
+	if args[1].Type() != object.HASH_OBJ && args[1].Type() != object.ARRAY_OBJ {
+		return newError("second argument to `template` must be HASH or ARRAY, got %s", args[1].Type())
+	}
+
+	tmpl := args[0].(*object.String).Value
+
+	var out strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		switch {
+		case strings.HasPrefix(tmpl[i:], "{{"), strings.HasPrefix(tmpl[i:], "}}"):
+			out.WriteByte(tmpl[i])
+			i++
+
+		case tmpl[i] == '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end < 0 {
+				return newError("unclosed placeholder in `template`: %q", tmpl[i:])
+			}
+
+			name := tmpl[i+1 : i+end]
+			val, ok := templateValue(args[1], name)
+			if !ok {
+				return newError("no value for placeholder {%s} in `template`", name)
+			}
+
+			out.WriteString(displayString(val, env))
+			i += end
+
+		default:
+			out.WriteByte(tmpl[i])
+		}
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+func templateValue(values object.Object, name string) (object.Object, bool) {
+	switch values := values.(type) {
+	case *object.Hash:
+		pair, ok := values.Pairs[(&object.String{Value: name}).HashKey()]
+		return pair.Value, ok
+
+	case *object.Array:
+		idx, err := strconv.Atoi(name)
+		if err != nil || idx < 0 || idx >= len(values.Elements) {
+			return nil, false
+		}
+		return values.Elements[idx], true
+	}
+
+	return nil, false
+}
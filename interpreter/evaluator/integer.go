@@ -0,0 +1,38 @@
+package evaluator
+
+import "github.com/connorjbarry/monkey/interpreter/object"
+
+// IntegerWidth is the number of bits integer arithmetic is carried out in.
+type IntegerWidth int
+
+const (
+	Width64 IntegerWidth = 64
+	Width32 IntegerWidth = 32
+)
+
+// SetIntegerWidth selects the width of integer arithmetic for programs
+// evaluated in env, or any scope sharing its global scope, and returns the
+// previous width so callers can restore it. Integers are still stored as
+// int64, but in 32-bit mode integer literals and the results of integer
+// operators wrap around to 32 bits, as int32 arithmetic in Go does:
+// 2147483647 + 1 is -2147483648. Builtins are unaffected, apart from those
+// such as sum that do their arithmetic with the operators.
+func SetIntegerWidth(env *object.Env, w IntegerWidth) IntegerWidth {
+	modes := env.Modes()
+	prev := Width64
+	if modes.Int32 {
+		prev = Width32
+	}
+
+	modes.Int32 = w == Width32
+	return prev
+}
+
+// newInteger makes an integer, wrapping v around to env's width.
+func newInteger(v int64, env *object.Env) *object.Integer {
+	if env.Modes().Int32 {
+		v = int64(int32(v))
+	}
+
+	return &object.Integer{Value: v}
+}
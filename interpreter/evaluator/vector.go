@@ -0,0 +1,265 @@
+package evaluator
+
+import "github.com/connorjbarry/monkey/interpreter/object"
+
+// The vector builtins treat arrays of INTEGER and FLOAT as vectors. The
+// arithmetic goes through the ordinary infix operators, so integers stay
+// integers and any float in the mix promotes the result.
+
+func vecAddFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	a, err := numericArray("vec_add", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := numericArray("vec_add", args[1])
+	if err != nil {
+		return err
+	}
+
+	if len(a) != len(b) {
+		return newError("arrays passed to `vec_add` must have the same length, got %d and %d", len(a), len(b))
+	}
+
+	sum := make([]object.Object, len(a))
+	for i := range a {
+		sum[i] = evalInfixExpression("+", a[i], b[i], env)
+	}
+
+	return &object.Array{Elements: sum}
+}
+
+func vecScaleFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, err := numericArray("vec_scale", args[0])
+	if err != nil {
+		return err
+	}
+
+	if !isNumber(args[1]) {
+		return newError("second argument to `vec_scale` must be INTEGER or FLOAT, got %s", args[1].Type())
+	}
+
+	scaled := make([]object.Object, len(arr))
+	for i, el := range arr {
+		scaled[i] = evalInfixExpression("*", el, args[1], env)
+	}
+
+	return &object.Array{Elements: scaled}
+}
+
+func dotFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	a, err := numericArray("dot", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := numericArray("dot", args[1])
+	if err != nil {
+		return err
+	}
+
+	if len(a) != len(b) {
+		return newError("arrays passed to `dot` must have the same length, got %d and %d", len(a), len(b))
+	}
+
+	return dotProduct(a, b, env)
+}
+
+func dotProduct(a, b []object.Object, env *object.Env) object.Object {
+	var sum object.Object = &object.Integer{Value: 0}
+	for i := range a {
+		sum = evalInfixExpression("+", sum, evalInfixExpression("*", a[i], b[i], env), env)
+	}
+
+	return sum
+}
+
+// sumFunc, productFunc and averageFunc reduce an array of numbers. The sum
+// of no numbers is 0 and their product 1; they have no average, so that is
+// NULL. An average is always a FLOAT.
+
+func sumFunc(env *object.Env, args ...object.Object) object.Object {
+	return foldNumbers("sum", "+", &object.Integer{Value: 0}, args, env)
+}
+
+func productFunc(env *object.Env, args ...object.Object) object.Object {
+	return foldNumbers("product", "*", &object.Integer{Value: 1}, args, env)
+}
+
+func averageFunc(env *object.Env, args ...object.Object) object.Object {
+	sum := foldNumbers("average", "+", &object.Integer{Value: 0}, args, env)
+	if isError(sum) {
+		return sum
+	}
+
+	n := len(args[0].(*object.Array).Elements)
+	if n == 0 {
+		return NULL
+	}
+
+	return &object.Float{Value: floatValue(sum) / float64(n)}
+}
+
+// foldNumbers combines the numbers in args[0] with op, starting from start.
+func foldNumbers(name, op string, start object.Object, args []object.Object, env *object.Env) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	arr, err := numericArray(name, args[0])
+	if err != nil {
+		return err
+	}
+
+	acc := start
+	for _, el := range arr {
+		acc = evalInfixExpression(op, acc, el, env)
+	}
+
+	return acc
+}
+
+// numericArray returns the elements of obj, checking that it is an array
+// holding only numbers.
+func numericArray(name string, obj object.Object) ([]object.Object, *object.Error) {
+	arr, ok := obj.(*object.Array)
+	if !ok {
+		return nil, newError("arguments to `%s` must be ARRAY, got %s", name, obj.Type())
+	}
+
+	for _, el := range arr.Elements {
+		if !isNumber(el) {
+			return nil, newError("elements of `%s` arguments must be INTEGER or FLOAT, got %s", name, el.Type())
+		}
+	}
+
+	return arr.Elements, nil
+}
+
+// Matrices are arrays of equal-length row arrays, so [[1, 2, 3], [4, 5, 6]]
+// is a 2x3 matrix.
+
+func transposeFunc(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	rows, err := matrixRows("transpose", args[0])
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return &object.Array{Elements: []object.Object{}}
+	}
+
+	cols := make([]object.Object, len(rows[0]))
+	for j := range cols {
+		col := make([]object.Object, len(rows))
+		for i, row := range rows {
+			col[i] = row[j]
+		}
+		cols[j] = &object.Array{Elements: col}
+	}
+
+	return &object.Array{Elements: cols}
+}
+
+func matmulFunc(env *object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	a, err := numericMatrix("matmul", args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := numericMatrix("matmul", args[1])
+	if err != nil {
+		return err
+	}
+
+	aRows, aCols := matrixDims(a)
+	bRows, bCols := matrixDims(b)
+	if aCols != bRows {
+		return newError("cannot multiply %dx%d matrix by %dx%d matrix: %d columns do not match %d rows",
+			aRows, aCols, bRows, bCols, aCols, bRows)
+	}
+
+	product := make([]object.Object, aRows)
+	for i, row := range a {
+		out := make([]object.Object, bCols)
+		for j := range out {
+			col := make([]object.Object, bRows)
+			for k := range col {
+				col[k] = b[k][j]
+			}
+			out[j] = dotProduct(row, col, env)
+		}
+		product[i] = &object.Array{Elements: out}
+	}
+
+	return &object.Array{Elements: product}
+}
+
+// matrixRows returns the rows of obj, checking that it is an array of
+// arrays that all have the same length.
+func matrixRows(name string, obj object.Object) ([][]object.Object, *object.Error) {
+	arr, ok := obj.(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, obj.Type())
+	}
+
+	rows := make([][]object.Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		row, ok := el.(*object.Array)
+		if !ok {
+			return nil, newError("rows of a matrix passed to `%s` must be ARRAY, got %s", name, el.Type())
+		}
+		if i > 0 && len(row.Elements) != len(rows[0]) {
+			return nil, newError("matrix passed to `%s` is not rectangular: row 0 has %d columns, row %d has %d",
+				name, len(rows[0]), i, len(row.Elements))
+		}
+		rows[i] = row.Elements
+	}
+
+	return rows, nil
+}
+
+func numericMatrix(name string, obj object.Object) ([][]object.Object, *object.Error) {
+	rows, err := matrixRows(name, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		for _, el := range row {
+			if !isNumber(el) {
+				return nil, newError("elements of a matrix passed to `%s` must be INTEGER or FLOAT, got %s", name, el.Type())
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+func matrixDims(rows [][]object.Object) (int, int) {
+	if len(rows) == 0 {
+		return 0, 0
+	}
+
+	return len(rows), len(rows[0])
+}
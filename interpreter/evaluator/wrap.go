@@ -0,0 +1,273 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// WrapGoFunc turns the Go function fn into a builtin, converting its
+// arguments from Monkey values and its result back, so existing Go code can
+// be handed to object.Env.RegisterBuiltin as it is:
+//
+//	repeat, err := evaluator.WrapGoFunc(strings.Repeat)
+//	if err != nil {
+//		return err
+//	}
+//	env.RegisterBuiltin("repeat", repeat.Fn)
+//
+// Parameters and results may be:
+//
+//   - any integer type, for INTEGER
+//   - float32 or float64, for FLOAT, or an INTEGER, which is converted
+//   - string, for STRING
+//   - bool, for BOOLEAN
+//   - a slice of any of these, for ARRAY
+//   - object.Object, which takes any value as it is
+//
+// fn may return nothing, which gives null, one value, an error, or a value
+// and an error; a non-nil error becomes a Monkey error with its message. A
+// variadic fn takes any number of trailing arguments.
+//
+// Calling the builtin with the wrong number of arguments, an argument of the
+// wrong type or a number too big for its parameter gives a Monkey error
+// rather than a panic, and so does a panic in fn itself. fn is checked when
+// it is wrapped: a value that isn't a function, or has a parameter or result
+// of a type not listed above, gives an error instead of a builtin.
+func WrapGoFunc(fn interface{}) (*object.BuiltIn, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, fmt.Errorf("WrapGoFunc: %T is not a function", fn)
+	}
+	t := v.Type()
+
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if i == t.NumIn()-1 && t.IsVariadic() {
+			in = in.Elem()
+		}
+		if !wrappable(in) {
+			return nil, fmt.Errorf("WrapGoFunc: parameter %d of %s has unsupported type %s", i+1, t, in)
+		}
+	}
+
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && (t.Out(1) != errorType || !wrappable(t.Out(0))),
+		t.NumOut() == 1 && t.Out(0) != errorType && !wrappable(t.Out(0)):
+		return nil, fmt.Errorf("WrapGoFunc: %s has unsupported results", t)
+	}
+
+	return &object.BuiltIn{Fn: func(args ...object.Object) (result object.Object) {
+		in, err := wrappedArgs(t, args)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("%v", r)
+			}
+		}()
+
+		return wrappedResult(v.Call(in))
+	}}, nil
+}
+
+// wrappable reports whether values of type t can be converted to and from
+// Monkey values.
+func wrappable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.String, reflect.Bool:
+		return true
+	case reflect.Slice:
+		return wrappable(t.Elem())
+	case reflect.Interface:
+		return t == objectType
+	}
+
+	return false
+}
+
+func wrappedArgs(t reflect.Type, args []object.Object) ([]reflect.Value, *object.Error) {
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+		if len(args) < fixed {
+			return nil, newError("wrong number of arguments. got=%d, want=%d or more", len(args), fixed)
+		}
+	} else if len(args) != fixed {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), fixed)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		typ := t.In(min(i, t.NumIn()-1))
+		if i >= fixed {
+			typ = typ.Elem()
+		}
+
+		val, err := fromObject(arg, typ, fmt.Sprintf("argument %d", i+1))
+		if err != nil {
+			return nil, err
+		}
+		in[i] = val
+	}
+
+	return in, nil
+}
+
+func wrappedResult(out []reflect.Value) object.Object {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return newError("%s", err.Error())
+		}
+		out = out[:n-1]
+	}
+
+	if len(out) == 0 {
+		return NULL
+	}
+
+	return toObject(out[0])
+}
+
+// fromObject converts obj to a Go value of type t. what names obj in the
+// error given when it can't be.
+func fromObject(obj object.Object, t reflect.Type, what string) (reflect.Value, *object.Error) {
+	val := reflect.New(t).Elem()
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := obj.(*object.Integer)
+		if !ok {
+			break
+		}
+		if val.OverflowInt(n.Value) {
+			return val, newError("%s is out of range for %s: %d", what, t, n.Value)
+		}
+		val.SetInt(n.Value)
+		return val, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := obj.(*object.Integer)
+		if !ok {
+			break
+		}
+		if n.Value < 0 || val.OverflowUint(uint64(n.Value)) {
+			return val, newError("%s is out of range for %s: %d", what, t, n.Value)
+		}
+		val.SetUint(uint64(n.Value))
+		return val, nil
+
+	case reflect.Float32, reflect.Float64:
+		switch obj := obj.(type) {
+		case *object.Float:
+			if val.OverflowFloat(obj.Value) {
+				return val, newError("%s is out of range for %s: %g", what, t, obj.Value)
+			}
+			val.SetFloat(obj.Value)
+			return val, nil
+		case *object.Integer:
+			val.SetFloat(float64(obj.Value))
+			return val, nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			val.SetString(s.Value)
+			return val, nil
+		}
+
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			val.SetBool(b.Value)
+			return val, nil
+		}
+
+	case reflect.Slice:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			break
+		}
+		val = reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+		for i, el := range arr.Elements {
+			elem, err := fromObject(el, t.Elem(), fmt.Sprintf("element %d of %s", i, what))
+			if err != nil {
+				return val, err
+			}
+			val.Index(i).Set(elem)
+		}
+		return val, nil
+
+	case reflect.Interface:
+		val.Set(reflect.ValueOf(obj))
+		return val, nil
+	}
+
+	return val, newError("%s must be %s, got %s", what, monkeyType(t), obj.Type())
+}
+
+// monkeyType names the Monkey type a Go type converts from.
+func monkeyType(t reflect.Type) object.ObjectType {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return object.FLOAT_OBJ
+	case reflect.String:
+		return object.STRING_OBJ
+	case reflect.Bool:
+		return object.BOOLEAN_OBJ
+	case reflect.Slice:
+		return object.ARRAY_OBJ
+	}
+
+	return object.INTEGER_OBJ
+}
+
+func toObject(val reflect.Value) object.Object {
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: val.Int()}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if val.Uint() > math.MaxInt64 {
+			return newError("result is out of range for INTEGER: %d", val.Uint())
+		}
+		return &object.Integer{Value: int64(val.Uint())}
+
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: val.Float()}
+
+	case reflect.String:
+		return &object.String{Value: val.String()}
+
+	case reflect.Bool:
+		return nativeBoolToBooleanObject(val.Bool())
+
+	case reflect.Slice:
+		elements := make([]object.Object, val.Len())
+		for i := range elements {
+			el := toObject(val.Index(i))
+			if isError(el) {
+				return el
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}
+	}
+
+	if obj, ok := val.Interface().(object.Object); ok && obj != nil {
+		return obj
+	}
+
+	return NULL
+}
@@ -1,36 +1,108 @@
 package lexer
 
-import "github.com/connorjbarry/monkey/interpreter/token"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/connorjbarry/monkey/interpreter/token"
+)
 
 type Lexer struct {
 	input   string
 	pos     int  // current position (points to current char)
 	readPos int  // current reading position (after current char)
 	ch      byte // current character
+
+	line int // line of ch
+	col  int // column of ch
+
+	newline bool // a newline came before the last token returned
+
+	hashComments bool
+}
+
+// An Option configures optional syntax when creating a Lexer.
+type Option func(*Lexer)
+
+// WithHashComments makes '#' start a comment running to the end of the
+// line, alongside "//". It is off by default so '#' stays free for other
+// uses.
+func WithHashComments() Option {
+	return func(l *Lexer) {
+		l.hashComments = true
+	}
+}
+
+// WithPosition numbers the input as though it began at the given line and
+// column of a larger source, so that tokens lexed from a fragment carry
+// their position in the whole.
+func WithPosition(line, col int) Option {
+	return func(l *Lexer) {
+		l.line = line
+		l.col = col - 1
+	}
 }
 
-func New(input string) *Lexer {
-	l := &Lexer{input: input}
+func New(input string, opts ...Option) *Lexer {
+	l := &Lexer{input: input, line: 1}
+	for _, opt := range opts {
+		opt(l)
+	}
+
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
-func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+// skipShebang skips a "#!" line at the very start of the input, so scripts
+// can be made executable with `#!/usr/bin/env monkey`. A '#' anywhere else
+// is lexed as usual.
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
 
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+func (l *Lexer) NextToken() token.Token {
+	l.newline = false
 	l.skipWhitespace()
 
+	line, col := l.line, l.col
+
+	tok := l.readToken()
+	tok.Line, tok.Column = line, col
+
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.Token{Type: token.EQ, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' {
+			l.readChar()
+			tok = token.Token{Type: token.INCREMENT, Literal: "++"}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -45,6 +117,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -54,18 +128,77 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' {
+			l.readChar()
+			tok = token.Token{Type: token.DECREMENT, Literal: "--"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '/':
+		if l.peekChar() == '/' {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readComment(2)
+			return tok
+		}
 		tok = newToken(token.SLASH, l.ch)
+	case '#':
+		if l.hashComments {
+			tok.Type = token.COMMENT
+			tok.Literal = l.readComment(1)
+			return tok
+		}
+		tok = newToken(token.ILLEGAL, l.ch)
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POW, Literal: "**"}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.SHL, Literal: "<<"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.LT_EQ, Literal: "<="}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.SHR, Literal: ">>"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.GT_EQ, Literal: ">="}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		if strings.HasPrefix(l.input[l.pos:], `"""`) {
+			tok.Type, tok.Literal = l.readBlockString()
+		} else {
+			tok.Type, tok.Literal = l.readString()
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -75,12 +208,18 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Type = token.EOF
 	default:
 		if isLetter(l.ch) {
+			pos := l.pos
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdentifier(tok.Literal)
+			if strings.Trim(tok.Literal, "_") == "" && isDigit(l.ch) {
+				// `_5`: underscores may only separate digits, not lead them.
+				l.readNumber()
+				tok.Type = token.ILLEGAL
+				tok.Literal = l.input[pos:l.pos]
+			}
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -99,6 +238,12 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
+	l.col++
+
 	if l.readPos >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -124,29 +269,277 @@ func isLetter(ch byte) bool {
 
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+		if l.ch == '\n' {
+			l.newline = true
+		}
 		l.readChar()
 	}
 }
 
-func (l *Lexer) readNumber() string {
+// NewlineBefore reports whether the token last returned by NextToken is the
+// first on its line, with a line break between it and the previous token.
+func (l *Lexer) NewlineBefore() bool {
+	return l.newline
+}
+
+// readNumber reads an INT, or a FLOAT when the digits are followed by a '.'
+// and at least one more digit. A bare trailing '.' is left for the next
+// token.
+//
+// Underscores may separate digits, as in 1_000_000, and are stripped from
+// the literal. One that doesn't sit between two digits (5_, 1__0, 1_.5)
+// makes the whole number ILLEGAL.
+func (l *Lexer) readNumber() (token.TokenType, string) {
 	pos := l.pos
-	for isDigit(l.ch) {
+	l.readDigits()
+
+	var typ token.TokenType = token.INT
+	if l.ch == '.' && isDigit(l.peekChar()) {
 		l.readChar()
+		l.readDigits()
+		typ = token.FLOAT
 	}
-	return l.input[pos:l.pos]
+
+	lit := l.input[pos:l.pos]
+	if !separatorsValid(lit) {
+		return token.ILLEGAL, lit
+	}
+
+	return typ, strings.ReplaceAll(lit, "_", "")
 }
 
-func (l *Lexer) readString() string {
-	pos := l.pos + 1
-	for {
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
 		l.readChar()
+	}
+}
+
+// separatorsValid reports whether every underscore in lit has a digit on
+// both sides.
+func separatorsValid(lit string) bool {
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != '_' {
+			continue
+		}
+		if i == 0 || i == len(lit)-1 || !isDigit(lit[i-1]) || !isDigit(lit[i+1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readComment reads to the end of the line, returning the text after the
+// comment marker, which is n bytes long.
+func (l *Lexer) readComment(n int) string {
+	pos := l.pos + n
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+
+	return strings.TrimSpace(l.input[pos:l.pos])
+}
+
+var escapes = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// readString reads a string literal, interpreting the escapes \n, \t, \r,
+// \", \\ and \$. A literal containing an unescaped ${ is INTERPOLATED and
+// keeps its raw source for the parser to Split. A string containing any
+// other escape is ILLEGAL, with its source text, quotes included, as the
+// token literal.
+func (l *Lexer) readString() (token.TokenType, string) {
+	start := l.pos
+
+	end, interpolated := stringEnd(l.input, start+1)
+	if end < 0 {
+		end = len(l.input)
+	}
+	for l.pos < end {
+		l.readChar()
+	}
+
+	raw := l.input[start+1 : end]
+	source := l.input[start:min(end+1, len(l.input))]
+
+	if interpolated {
+		if _, err := Split(raw); err != nil {
+			return token.ILLEGAL, source
+		}
+		return token.INTERPOLATED, raw
+	}
+
+	text, ok := unescape(raw)
+	if !ok {
+		return token.ILLEGAL, source
+	}
+
+	return token.STRING, text
+}
+
+// readBlockString reads a triple-quoted string. Everything up to the closing
+// """ is kept verbatim: newlines and single quotes need no escaping, and
+// neither escapes nor ${...} are interpreted. An unterminated block string is
+// ILLEGAL, with the rest of the source as the token literal.
+func (l *Lexer) readBlockString() (token.TokenType, string) {
+	start := l.pos
+
+	end := strings.Index(l.input[start+3:], `"""`)
+	if end < 0 {
+		for l.ch != 0 {
+			l.readChar()
+		}
+		return token.ILLEGAL, l.input[start:]
+	}
+	end += start + 3
+
+	for l.pos < end+2 {
+		l.readChar()
+	}
+
+	return token.STRING, l.input[start+3 : end]
+}
+
+// stringEnd returns the index of the quote closing the string literal whose
+// contents start at s[i], or -1 if it is unterminated, and reports whether
+// the literal contains an interpolation. Quotes inside ${...} belong to
+// nested literals rather than closing this one.
+func stringEnd(s string, i int) (int, bool) {
+	interpolated := false
+
+	for i < len(s) {
+		switch {
+		case s[i] == '\\':
+			i += 2
+		case s[i] == '"':
+			return i, interpolated
+		case strings.HasPrefix(s[i:], "${"):
+			interpolated = true
+			end := interpolationEnd(s, i+2)
+			if end < 0 {
+				return -1, interpolated
+			}
+			i = end + 1
+		default:
+			i++
+		}
+	}
+
+	return -1, interpolated
+}
+
+// interpolationEnd returns the index of the brace closing the ${...}
+// expression whose source starts at s[i], or -1 if there is none. Braces
+// must balance, and braces inside nested string literals don't count.
+func interpolationEnd(s string, i int) int {
+	depth := 0
+
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '"':
+			end, _ := stringEnd(s, i+1)
+			if end < 0 {
+				return -1
+			}
+			i = end
+		}
+	}
+
+	return -1
+}
+
+func unescape(raw string) (string, bool) {
+	if !strings.Contains(raw, "\\") {
+		return raw, true
+	}
 
-		if l.ch == '"' || l.ch == 0 {
-			break
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' {
+			out.WriteByte(raw[i])
+			continue
 		}
+
+		i++
+		if i == len(raw) {
+			return "", false
+		}
+		esc, ok := escapes[raw[i]]
+		if !ok {
+			return "", false
+		}
+		out.WriteByte(esc)
+	}
+
+	return out.String(), true
+}
+
+// Segment is one piece of an interpolated string: either literal text, with
+// its escapes interpreted, or the source of a ${...} expression.
+type Segment struct {
+	Text string
+	Expr bool
+	// Offset is where the segment's source starts in the raw string; for
+	// an expression, that is just after the "${".
+	Offset int
+}
+
+// Split breaks the raw source of an INTERPOLATED literal into its literal
+// and expression segments, in order.
+func Split(raw string) ([]Segment, error) {
+	var segments []Segment
+
+	textStart := 0
+	addText := func(end int) error {
+		if end == textStart {
+			return nil
+		}
+		text, ok := unescape(raw[textStart:end])
+		if !ok {
+			return fmt.Errorf("invalid escape sequence in %q", raw[textStart:end])
+		}
+		segments = append(segments, Segment{Text: text, Offset: textStart})
+		return nil
+	}
+
+	for i := 0; i < len(raw); {
+		switch {
+		case raw[i] == '\\':
+			i += 2
+		case strings.HasPrefix(raw[i:], "${"):
+			if err := addText(i); err != nil {
+				return nil, err
+			}
+			end := interpolationEnd(raw, i+2)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated interpolation in %q", raw[i:])
+			}
+			segments = append(segments, Segment{Text: raw[i+2 : end], Expr: true, Offset: i + 2})
+			i = end + 1
+			textStart = i
+		default:
+			i++
+		}
+	}
+
+	if err := addText(len(raw)); err != nil {
+		return nil, err
 	}
 
-	return l.input[pos:l.pos]
+	return segments, nil
 }
 
 func isDigit(ch byte) bool {
@@ -30,6 +30,16 @@ func TestNextToken(t *testing.T) {
     "foo bar"
     [1, 2, 3];
 	{"foo" : "bar"}
+    match (x) { _ => 1 }
+    10 % 3
+    2 ** 10 * 3
+    a && b || c
+    3.14 10.0 7.
+    i++ j--
+    a ? b : c
+    a & b | c ^ d << 2 >> 1 < >
+    1 <= 2 >= 3
+    x in xs
     `
 
 	tests := []struct {
@@ -124,6 +134,62 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.MATCH, "match"},
+		{token.LPAREN, "("},
+		{token.IDENTIFER, "x"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.IDENTIFER, "_"},
+		{token.ARROW, "=>"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.INT, "10"},
+		{token.PERCENT, "%"},
+		{token.INT, "3"},
+		{token.INT, "2"},
+		{token.POW, "**"},
+		{token.INT, "10"},
+		{token.ASTERISK, "*"},
+		{token.INT, "3"},
+		{token.IDENTIFER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFER, "c"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "10.0"},
+		{token.INT, "7"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFER, "i"},
+		{token.INCREMENT, "++"},
+		{token.IDENTIFER, "j"},
+		{token.DECREMENT, "--"},
+		{token.IDENTIFER, "a"},
+		{token.QUESTION, "?"},
+		{token.IDENTIFER, "b"},
+		{token.COLON, ":"},
+		{token.IDENTIFER, "c"},
+		{token.IDENTIFER, "a"},
+		{token.BIT_AND, "&"},
+		{token.IDENTIFER, "b"},
+		{token.BIT_OR, "|"},
+		{token.IDENTIFER, "c"},
+		{token.BIT_XOR, "^"},
+		{token.IDENTIFER, "d"},
+		{token.SHL, "<<"},
+		{token.INT, "2"},
+		{token.SHR, ">>"},
+		{token.INT, "1"},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		{token.INT, "1"},
+		{token.LT_EQ, "<="},
+		{token.INT, "2"},
+		{token.GT_EQ, ">="},
+		{token.INT, "3"},
+		{token.IDENTIFER, "x"},
+		{token.IN, "in"},
+		{token.IDENTIFER, "xs"},
 		{token.EOF, ""},
 	}
 
@@ -140,3 +206,369 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+    let x = 10 / 2; //   trailing
+    //`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "leading comment"},
+		{token.LET, "let"},
+		{token.IDENTIFER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "10"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "trailing"},
+		{token.COMMENT, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype mismatch: expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal mismatch: expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestHashComments(t *testing.T) {
+	input := `# leading
+    let x = 1; #trailing // still the comment
+    // slashes`
+
+	tests := []struct {
+		opts     []Option
+		expected []token.Token
+	}{
+		{[]Option{WithHashComments()}, []token.Token{
+			{Type: token.COMMENT, Literal: "leading"},
+			{Type: token.LET, Literal: "let"},
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.ASSIGN, Literal: "="},
+			{Type: token.INT, Literal: "1"},
+			{Type: token.SEMICOLON, Literal: ";"},
+			{Type: token.COMMENT, Literal: "trailing // still the comment"},
+			{Type: token.COMMENT, Literal: "slashes"},
+			{Type: token.EOF, Literal: ""},
+		}},
+		{nil, []token.Token{
+			{Type: token.ILLEGAL, Literal: "#"},
+			{Type: token.IDENTIFER, Literal: "leading"},
+			{Type: token.LET, Literal: "let"},
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.ASSIGN, Literal: "="},
+			{Type: token.INT, Literal: "1"},
+			{Type: token.SEMICOLON, Literal: ";"},
+			{Type: token.ILLEGAL, Literal: "#"},
+			{Type: token.IDENTIFER, Literal: "trailing"},
+			{Type: token.COMMENT, Literal: "still the comment"},
+			{Type: token.COMMENT, Literal: "slashes"},
+			{Type: token.EOF, Literal: ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(input, tt.opts...)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("hash comments %v: tokens[%d] wrong. expected=%s %q, got=%s %q",
+					tt.opts != nil, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+
+	l := New("#!/usr/bin/env monkey\nx", WithHashComments())
+	if tok := l.NextToken(); tok.Type != token.IDENTIFER {
+		t.Errorf("shebang not skipped with hash comments. got=%s %q", tok.Type, tok.Literal)
+	}
+}
+
+func TestNewlineBefore(t *testing.T) {
+	input := "let a = 1\n\n  a // note\n+ 2 \r\n; b"
+
+	expected := []struct {
+		literal string
+		newline bool
+	}{
+		{"let", false},
+		{"a", false},
+		{"=", false},
+		{"1", false},
+		{"a", true},
+		{"note", false},
+		{"+", true},
+		{"2", false},
+		{";", true},
+		{"b", false},
+		{"", false},
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - wrong literal. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+		if l.NewlineBefore() != tt.newline {
+			t.Errorf("tests[%d] - NewlineBefore for %q wrong. expected=%t, got=%t", i, tt.literal, tt.newline, l.NewlineBefore())
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := "let x = 5;\n  x +\ty\r\n\"a\nb\" // c\n\n}"
+
+	expected := []token.Token{
+		{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		{Type: token.IDENTIFER, Literal: "x", Line: 1, Column: 5},
+		{Type: token.ASSIGN, Literal: "=", Line: 1, Column: 7},
+		{Type: token.INT, Literal: "5", Line: 1, Column: 9},
+		{Type: token.SEMICOLON, Literal: ";", Line: 1, Column: 10},
+		{Type: token.IDENTIFER, Literal: "x", Line: 2, Column: 3},
+		{Type: token.PLUS, Literal: "+", Line: 2, Column: 5},
+		{Type: token.IDENTIFER, Literal: "y", Line: 2, Column: 7},
+		{Type: token.STRING, Literal: "a\nb", Line: 3, Column: 1},
+		{Type: token.COMMENT, Literal: "c", Line: 4, Column: 4},
+		{Type: token.RBRACE, Literal: "}", Line: 6, Column: 1},
+		{Type: token.EOF, Literal: "", Line: 6, Column: 2},
+	}
+
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok != tt {
+			t.Errorf("tests[%d] - wrong token. expected=%+v, got=%+v", i, tt, tok)
+		}
+	}
+
+	l = New("a\n  b", WithPosition(3, 10))
+	for _, tt := range []token.Token{
+		{Type: token.IDENTIFER, Literal: "a", Line: 3, Column: 10},
+		{Type: token.IDENTIFER, Literal: "b", Line: 4, Column: 3},
+	} {
+		if tok := l.NextToken(); tok != tt {
+			t.Errorf("wrong token with WithPosition. expected=%+v, got=%+v", tt, tok)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"#!/usr/bin/env monkey\nlet x = 1;", []token.Token{
+			{Type: token.LET, Literal: "let"},
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.ASSIGN, Literal: "="},
+			{Type: token.INT, Literal: "1"},
+			{Type: token.SEMICOLON, Literal: ";"},
+			{Type: token.EOF, Literal: ""},
+		}},
+		{"#!/usr/bin/env monkey", []token.Token{
+			{Type: token.EOF, Literal: ""},
+		}},
+		{"x\n#!y", []token.Token{
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.ILLEGAL, Literal: "#"},
+			{Type: token.BANG, Literal: "!"},
+			{Type: token.IDENTIFER, Literal: "y"},
+			{Type: token.EOF, Literal: ""},
+		}},
+		{" #!x", []token.Token{
+			{Type: token.ILLEGAL, Literal: "#"},
+			{Type: token.BANG, Literal: "!"},
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.EOF, Literal: ""},
+		}},
+		{"#x", []token.Token{
+			{Type: token.ILLEGAL, Literal: "#"},
+			{Type: token.IDENTIFER, Literal: "x"},
+			{Type: token.EOF, Literal: ""},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Fatalf("%q: tokens[%d] wrong. expected=%s %q, got=%s %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestDigitSeparators(t *testing.T) {
+	input := `1_000_000 1_000.000_1 _ _5 5_ 1__0 1_.5 x`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "1000000"},
+		{token.FLOAT, "1000.0001"},
+		{token.IDENTIFER, "_"},
+		{token.ILLEGAL, "_5"},
+		{token.ILLEGAL, "5_"},
+		{token.ILLEGAL, "1__0"},
+		{token.ILLEGAL, "1_.5"},
+		{token.IDENTIFER, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype mismatch: expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal mismatch: expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	input := `"a\nb" "tab\there" "cr\r" "say \"hi\"" "back\\slash" "" "bad \q escape" "x" "trailing \`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\nb"},
+		{token.STRING, "tab\there"},
+		{token.STRING, "cr\r"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, ""},
+		{token.ILLEGAL, `"bad \q escape"`},
+		{token.STRING, "x"},
+		{token.ILLEGAL, `"trailing \`},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype mismatch: expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal mismatch: expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestBlockStrings(t *testing.T) {
+	input := "let s = \"\"\"first line\n  say \"hi\"\n\\n ${x}\"\"\";\n\"\"\"\"\"\" s \"\"\"never closed\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENTIFER, "s", 1, 5},
+		{token.ASSIGN, "=", 1, 7},
+		{token.STRING, "first line\n  say \"hi\"\n\\n ${x}", 1, 9},
+		{token.SEMICOLON, ";", 3, 11},
+		{token.STRING, "", 4, 1},
+		{token.IDENTIFER, "s", 4, 8},
+		{token.ILLEGAL, "\"\"\"never closed\n", 4, 10},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype mismatch: expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal mismatch: expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Fatalf("tests[%d] - position mismatch: expected %d:%d, got %d:%d", i, tt.line, tt.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	input := `"hi ${name}!" "${ {"k": "}"}["k"] }" "\${x}" "$5" "${x" 1`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERPOLATED, "hi ${name}!"},
+		{token.INTERPOLATED, `${ {"k": "}"}["k"] }`},
+		{token.STRING, "${x}"},
+		{token.STRING, "$5"},
+		{token.ILLEGAL, `"${x" 1`},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype mismatch: expected %q, got %q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal mismatch: expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	segments, err := Split(`a\t${x + 1}\${y}${f("}")}`)
+	if err != nil {
+		t.Fatalf("Split returned error: %s", err)
+	}
+
+	expected := []Segment{
+		{Text: "a\t"},
+		{Text: "x + 1", Expr: true, Offset: 5},
+		{Text: "${y}", Offset: 11},
+		{Text: `f("}")`, Expr: true, Offset: 18},
+	}
+
+	if len(segments) != len(expected) {
+		t.Fatalf("wrong number of segments. expected=%d, got=%d (%+v)", len(expected), len(segments), segments)
+	}
+
+	for i, seg := range expected {
+		if segments[i] != seg {
+			t.Errorf("segments[%d] wrong. expected=%+v, got=%+v", i, seg, segments[i])
+		}
+	}
+
+	if _, err := Split(`\q${x}`); err == nil {
+		t.Errorf("expected error for unknown escape")
+	}
+}
@@ -1,14 +1,35 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"os/user"
+	"path/filepath"
 
+	"github.com/connorjbarry/monkey/interpreter/evaluator"
+	"github.com/connorjbarry/monkey/interpreter/object"
 	"github.com/connorjbarry/monkey/interpreter/repl"
 )
 
 func main() {
+	calc := flag.Bool("calc", false, "print the value of every expression, like a calculator")
+	history := flag.String("history", defaultHistoryFile(), "file to keep REPL history in, or empty for none")
+	precision := flag.Int("precision", -1, "decimal places to print floats with, or -1 for the shortest exact form")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [script]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	setup := func(env *object.Env) {
+		evaluator.SetFloatPrecision(env, *precision)
+	}
+
+	if flag.NArg() > 0 {
+		os.Exit(runScript(flag.Arg(0), setup))
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -17,5 +38,35 @@ func main() {
 	fmt.Printf("Hello %s! This is the Monkey programming language.\n", user.Username)
 	fmt.Printf("Feel free to type in commands, 'exit()' will terminate the repl.\n")
 
-	repl.Start(os.Stdin, os.Stdout)
+	repl.StartWithOptions(os.Stdin, os.Stdout, repl.Options{Calculator: *calc, HistoryFile: *history, Setup: setup})
+}
+
+// runScript runs the program in path, reporting errors to stderr, and returns
+// the exit status.
+func runScript(path string, setup func(env *object.Env)) int {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	env := object.NewEnvironment()
+	setup(env)
+
+	if !repl.Run(string(src), env, os.Stderr) {
+		return 1
+	}
+
+	return 0
+}
+
+// defaultHistoryFile is ~/.monkey_history, or no file if there is no home
+// directory.
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".monkey_history")
 }
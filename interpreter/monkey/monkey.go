@@ -0,0 +1,50 @@
+// Package monkey describes this build of the interpreter, so that embedders
+// and tools can check what it supports before relying on it.
+package monkey
+
+import "slices"
+
+// version is the language version, bumped whenever syntax or builtins are
+// added or changed.
+const version = "0.1.0"
+
+// features names what this build of the language supports. Optional modes
+// are listed whether or not they are switched on: the setters that enable
+// them live in the evaluator, lexer, object and parser packages.
+var features = []string{
+	"asi",                  // parser.SetAutoSemicolons
+	"assignment",           // x = 1, x++, x--
+	"bitwise",              // & | ^ << >>
+	"closures",             // first-class functions
+	"error-wrapping",       // wrap_error, try, is_error and cause
+	"float-precision",      // evaluator.SetFloatPrecision and set_precision
+	"floats",               // FLOAT values
+	"for-in",               // for (x in xs) loops over arrays, strings, hashes and ranges
+	"hash-comments",        // lexer.WithHashComments
+	"host-builtins",        // object.Env.RegisterBuiltin
+	"in",                   // the in operator
+	"int32",                // evaluator.SetIntegerWidth
+	"interpolation",        // "${expr}" in strings
+	"loose-coercion",       // evaluator.SetLooseCoercion
+	"match",                // match expressions
+	"null-keys",            // null as a hash key
+	"numeric-truthiness",   // evaluator.SetTruthiness
+	"operator-overloading", // __add__ and __eq__ on hashes
+	"shebang",              // a leading #! line is ignored
+	"slices",               // a[low:high]
+	"ternary",              // c ? a : b
+	"while",                // while loops with break and continue
+}
+
+// Version returns the language version, such as "0.1.0".
+func Version() string {
+	return version
+}
+
+// Features returns the names of the features this build supports, sorted.
+// The caller may modify the returned slice.
+func Features() []string {
+	out := slices.Clone(features)
+	slices.Sort(out)
+	return out
+}
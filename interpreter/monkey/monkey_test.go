@@ -0,0 +1,31 @@
+package monkey
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	if Version() != "0.1.0" {
+		t.Errorf("wrong version. got=%q", Version())
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	got := Features()
+
+	for _, name := range []string{"closures", "floats", "match", "while", "asi", "int32", "numeric-truthiness"} {
+		if !slices.Contains(got, name) {
+			t.Errorf("feature %q not listed in %v", name, got)
+		}
+	}
+
+	if !slices.IsSorted(got) {
+		t.Errorf("features not sorted: %v", got)
+	}
+
+	got[0] = "changed"
+	if Features()[0] == "changed" {
+		t.Errorf("Features returned its internal slice")
+	}
+}
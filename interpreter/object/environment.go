@@ -1,30 +1,126 @@
 package object
 
-func NewClosedEnv(outer *Env) *Env {
-	env := NewEnvironment()
-	env.outer = outer
+import (
+	"io"
+	"sort"
+	"time"
+)
 
-	return env
+func NewClosedEnv(outer *Env) *Env {
+	s := make(map[string]Object)
+	return &Env{store: s, outer: outer, modes: outer.modes}
 }
 
 func NewEnvironment() *Env {
 	s := make(map[string]Object)
-	return &Env{store: s}
+	return &Env{store: s, modes: &Modes{FloatPrecision: -1}}
 }
 
 type Env struct {
-	store map[string]Object
-	outer *Env
+	store    map[string]Object
+	outer    *Env
+	shared   bool
+	modes    *Modes              // shared with every scope nested in this one
+	builtins map[string]*BuiltIn // kept on the global scope only
+	cached   map[string]*BuiltIn // likewise
+}
+
+// Modes holds the optional evaluation modes of a global scope. Every scope
+// nested in it shares the same Modes, so a mode switched on through any of
+// them applies to the whole program, while separate global scopes, and so
+// separate interpreters, are independent. A new environment starts with every
+// mode off and FloatPrecision at -1; the evaluator's setters describe each.
+type Modes struct {
+	NumericTruthiness bool             // 0 and 0.0 are false in conditions
+	Int32             bool             // integer arithmetic wraps around at 32 bits
+	LooseCoercion     bool             // "3" * 4 reads the string as a number
+	FloatPrecision    int              // decimal places floats print with, or -1 for the shortest form
+	Clock             func() time.Time // what time_now reads, or nil for the system clock
+	Output            io.Writer        // where puts writes, or nil for standard output
 }
 
+// Modes returns the modes programs evaluated in e run with. Changing the
+// result changes them for e's global scope and everything nested in it.
+func (e *Env) Modes() *Modes {
+	return e.modes
+}
+
+// Get looks name up in e and then in each enclosing scope. The walk is a
+// loop rather than recursion so deeply nested scopes can't exhaust the stack.
 func (e *Env) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.store[name]; ok {
+			return obj, true
+		}
+	}
+
+	return nil, false
+}
+
+// Global returns the outermost scope e is nested in.
+func (e *Env) Global() *Env {
+	for e.outer != nil {
+		e = e.outer
+	}
+
+	return e
+}
+
+// Names returns the sorted names bound directly in e, not counting any
+// enclosing scope.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
 
-	if !ok && e.outer != nil {
-		return e.outer.Get(name)
+// RegisterBuiltin makes fn callable as name by programs evaluated in e or
+// any scope nested in it, so a program embedding Monkey can give scripts
+// functions of its own:
+//
+//	env := object.NewEnvironment()
+//	env.RegisterBuiltin("read_file", func(args ...object.Object) object.Object {
+//		...
+//	})
+//
+// Registered builtins are looked up after variables, as the standard ones
+// are, but before the standard ones, so a host can replace a builtin such
+// as puts. Registering a name again replaces the earlier function.
+func (e *Env) RegisterBuiltin(name string, fn BuiltInFns) {
+	global := e.Global()
+	if global.builtins == nil {
+		global.builtins = make(map[string]*BuiltIn)
 	}
 
-	return obj, ok
+	global.builtins[name] = &BuiltIn{Fn: fn}
+}
+
+// Builtin returns the builtin registered as name for e's global scope.
+func (e *Env) Builtin(name string) (*BuiltIn, bool) {
+	builtin, ok := e.Global().builtins[name]
+	return builtin, ok
+}
+
+// CachedBuiltin returns the builtin cached as name on e's global scope,
+// calling create to make it the first time. The evaluator binds builtins
+// that depend on the scope's modes this way, so each stays a single object
+// for the whole program and compares equal to itself.
+func (e *Env) CachedBuiltin(name string, create func() *BuiltIn) *BuiltIn {
+	global := e.Global()
+	if builtin, ok := global.cached[name]; ok {
+		return builtin
+	}
+
+	if global.cached == nil {
+		global.cached = make(map[string]*BuiltIn)
+	}
+	builtin := create()
+	global.cached[name] = builtin
+	return builtin
 }
 
 func (e *Env) Set(name string, val Object) Object {
@@ -32,3 +128,33 @@ func (e *Env) Set(name string, val Object) Object {
 
 	return val
 }
+
+// Assign rebinds name in the nearest scope that already binds it, reporting
+// false if none does. Unlike Set it never introduces a new binding.
+func (e *Env) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+
+	return false
+}
+
+// Share marks e as a scope whose bindings may be reassigned after a closure
+// has read them, so closures must keep e itself rather than copy values out.
+func (e *Env) Share() {
+	e.shared = true
+}
+
+// Shared reports whether e or any scope it is nested in has been shared.
+func (e *Env) Shared() bool {
+	for env := e; env != nil; env = env.outer {
+		if env.shared {
+			return true
+		}
+	}
+
+	return false
+}
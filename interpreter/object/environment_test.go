@@ -0,0 +1,183 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEnvGetDeepScopeChain(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("x", &Integer{Value: 42})
+
+	env := global
+	for i := 0; i < 1_000_000; i++ {
+		env = NewClosedEnv(env)
+	}
+
+	obj, ok := env.Get("x")
+	if !ok {
+		t.Fatalf("x not found through deep scope chain")
+	}
+
+	if obj.(*Integer).Value != 42 {
+		t.Errorf("x has wrong value. got=%d", obj.(*Integer).Value)
+	}
+
+	if _, ok := env.Get("y"); ok {
+		t.Errorf("y should not be found")
+	}
+}
+
+func TestEnvGetShadowing(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+
+	inner := NewClosedEnv(outer)
+	inner.Set("x", &Integer{Value: 2})
+
+	obj, _ := inner.Get("x")
+	if obj.(*Integer).Value != 2 {
+		t.Errorf("inner x has wrong value. got=%d", obj.(*Integer).Value)
+	}
+
+	obj, _ = outer.Get("x")
+	if obj.(*Integer).Value != 1 {
+		t.Errorf("outer x has wrong value. got=%d", obj.(*Integer).Value)
+	}
+}
+
+func TestEnvRegisterBuiltin(t *testing.T) {
+	global := NewEnvironment()
+	inner := NewClosedEnv(global)
+
+	inner.RegisterBuiltin("answer", func(args ...Object) Object { return &Integer{Value: 42} })
+
+	builtin, ok := global.Builtin("answer")
+	if !ok {
+		t.Fatalf("builtin registered in an inner scope not found in the global one")
+	}
+	if got := builtin.Fn().Inspect(); got != "42" {
+		t.Errorf("wrong builtin returned. got=%s", got)
+	}
+
+	if _, ok := NewClosedEnv(inner).Builtin("answer"); !ok {
+		t.Errorf("builtin not found from a nested scope")
+	}
+	if _, ok := NewEnvironment().Builtin("answer"); ok {
+		t.Errorf("builtin leaked into another environment")
+	}
+	if len(global.Names()) != 0 {
+		t.Errorf("registering a builtin bound a variable. got=%v", global.Names())
+	}
+}
+
+func TestEnvModes(t *testing.T) {
+	global := NewEnvironment()
+	inner := NewClosedEnv(NewClosedEnv(global))
+
+	inner.Modes().NumericTruthiness = true
+
+	if !global.Modes().NumericTruthiness {
+		t.Errorf("mode set in an inner scope not seen by the global one")
+	}
+	if !NewClosedEnv(global).Modes().NumericTruthiness {
+		t.Errorf("mode not inherited by a new nested scope")
+	}
+	if NewEnvironment().Modes().NumericTruthiness {
+		t.Errorf("mode leaked into another environment")
+	}
+	if got := NewEnvironment().Modes().FloatPrecision; got != -1 {
+		t.Errorf("new environment has wrong float precision. got=%d", got)
+	}
+}
+
+func TestEnvAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+
+	inner := NewClosedEnv(NewClosedEnv(outer))
+
+	if !inner.Assign("x", &Integer{Value: 2}) {
+		t.Fatalf("Assign did not find x in an enclosing scope")
+	}
+
+	if len(inner.Names()) != 0 {
+		t.Errorf("Assign bound a new name in the inner scope: %v", inner.Names())
+	}
+
+	obj, _ := outer.Get("x")
+	if obj.(*Integer).Value != 2 {
+		t.Errorf("outer x has wrong value. got=%d", obj.(*Integer).Value)
+	}
+
+	if inner.Assign("y", &Integer{Value: 3}) {
+		t.Errorf("Assign reported success for an undeclared name")
+	}
+
+	if _, ok := inner.Get("y"); ok {
+		t.Errorf("y should not be found")
+	}
+}
+
+func TestSaveAndLoadEnv(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("hidden", &Integer{Value: 0})
+
+	env := NewClosedEnv(outer)
+	env.Set("n", &Integer{Value: -12})
+	env.Set("name", &String{Value: "monkey"})
+	env.Set("ok", TRUE)
+	env.Set("nothing", NULL)
+	env.Set("list", &Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{FALSE}}}})
+	env.Set("f", &Function{})
+	env.Set("fns", &Array{Elements: []Object{&BuiltIn{}}})
+
+	var buf bytes.Buffer
+	if err := SaveEnv(env, &buf, false); err == nil || err.Error() != "cannot save f: cannot serialize FUNCTION" {
+		t.Fatalf("wrong error saving a function. got=%v", err)
+	}
+
+	buf.Reset()
+	if err := SaveEnv(env, &buf, true); err != nil {
+		t.Fatalf("SaveEnv returned error: %s", err)
+	}
+
+	loaded, err := LoadEnv(&buf)
+	if err != nil {
+		t.Fatalf("LoadEnv returned error: %s", err)
+	}
+
+	expected := []string{"list", "n", "name", "nothing", "ok"}
+	names := loaded.Names()
+	if len(names) != len(expected) {
+		t.Fatalf("loaded env has wrong bindings. expected=%v, got=%v", expected, names)
+	}
+
+	for i, name := range expected {
+		if names[i] != name {
+			t.Fatalf("loaded env has wrong bindings. expected=%v, got=%v", expected, names)
+		}
+
+		want, _ := env.Get(name)
+		got, _ := loaded.Get(name)
+		if got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+			t.Errorf("binding %s has wrong value. expected=%s, got=%s", name, want.Inspect(), got.Inspect())
+		}
+	}
+
+	if ok, _ := loaded.Get("ok"); ok != TRUE {
+		t.Errorf("loaded boolean is not the canonical TRUE")
+	}
+}
+
+func TestLoadEnvErrors(t *testing.T) {
+	data, _ := Serialize(&Array{Elements: []Object{}})
+	if _, err := LoadEnv(bytes.NewReader(data)); err == nil || err.Error() != "saved environment must be HASH, got ARRAY" {
+		t.Errorf("wrong error loading an array. got=%v", err)
+	}
+
+	if _, err := LoadEnv(strings.NewReader("garbage")); err == nil || err.Error() != "not a serialized value" {
+		t.Errorf("wrong error loading garbage. got=%v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// ToNative converts obj to the Go value it stands for, so a host program can
+// read a result without switching on object types:
+//
+//	INTEGER  int64
+//	FLOAT    float64
+//	STRING   string
+//	BOOLEAN  bool
+//	NULL     nil
+//	TIME     time.Time, in UTC
+//	ARRAY    []interface{}
+//	HASH     map[string]interface{}
+//
+// A hash's string keys are used as they are and other keys in their Inspect
+// form, as to_json writes them, so {1: "a"} becomes map[string]interface{}{
+// "1": "a"}. Should two keys come out the same, as 1 and "1" do, the one
+// that sorts last wins.
+//
+// Values with no Go counterpart, such as functions, closures and errors,
+// are returned unconverted, as opaque handles that FromNative gives back as
+// they were.
+func ToNative(obj Object) interface{} {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value
+	case *Float:
+		return obj.Value
+	case *String:
+		return obj.Value
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return nil
+	case *Time:
+		return time.Unix(obj.Value, 0).UTC()
+	case *Array:
+		out := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			out[i] = ToNative(el)
+		}
+		return out
+	case *Hash:
+		out := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.SortedPairs() {
+			key := pair.Key.Inspect()
+			if s, ok := pair.Key.(*String); ok {
+				key = s.Value
+			}
+			out[key] = ToNative(pair.Value)
+		}
+		return out
+	}
+
+	return obj
+}
+
+// FromNative converts a Go value to a Monkey one, the inverse of ToNative.
+// Besides what ToNative gives, it takes any integer or float type, slices
+// and arrays of any element type, maps whose keys convert to hashable
+// values, and errors, which become Monkey errors with the same message. An
+// Object is returned as it is.
+//
+// A value that can't be converted, such as a channel or an unsigned integer
+// too big for INTEGER, gives an *Error saying so.
+func FromNative(v interface{}) Object {
+	switch v := v.(type) {
+	case nil:
+		return NULL
+	case Object:
+		return v
+	case time.Time:
+		return &Time{Value: v.Unix()}
+	case error:
+		return &Error{Message: v.Error()}
+	}
+
+	val := reflect.ValueOf(v)
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: val.Int()}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if val.Uint() > math.MaxInt64 {
+			return &Error{Message: fmt.Sprintf("cannot convert %d to INTEGER: out of range", val.Uint())}
+		}
+		return &Integer{Value: int64(val.Uint())}
+
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: val.Float()}
+
+	case reflect.String:
+		return &String{Value: val.String()}
+
+	case reflect.Bool:
+		return nativeBool(val.Bool())
+
+	case reflect.Slice, reflect.Array:
+		if val.Kind() == reflect.Slice && val.IsNil() {
+			return &Array{Elements: []Object{}}
+		}
+		elements := make([]Object, val.Len())
+		for i := range elements {
+			el := FromNative(val.Index(i).Interface())
+			if el.Type() == ERROR_OBJ {
+				return el
+			}
+			elements[i] = el
+		}
+		return &Array{Elements: elements}
+
+	case reflect.Map:
+		pairs := make(map[HashKey]HashPair, val.Len())
+		iter := val.MapRange()
+		for iter.Next() {
+			key := FromNative(iter.Key().Interface())
+			if key.Type() == ERROR_OBJ {
+				return key
+			}
+			hashKey, ok := AsHashKey(key)
+			if !ok {
+				return &Error{Message: fmt.Sprintf("cannot convert %T to HASH: unusable key type %s", v, key.Type())}
+			}
+
+			value := FromNative(iter.Value().Interface())
+			if value.Type() == ERROR_OBJ {
+				return value
+			}
+			pairs[hashKey] = HashPair{Key: key, Value: value}
+		}
+		return &Hash{Pairs: pairs}
+
+	case reflect.Pointer, reflect.Interface:
+		if val.IsNil() {
+			return NULL
+		}
+		return FromNative(val.Elem().Interface())
+	}
+
+	return &Error{Message: fmt.Sprintf("cannot convert %T to a Monkey value", v)}
+}
+
+func nativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
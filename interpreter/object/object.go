@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/connorjbarry/monkey/interpreter/ast"
 )
@@ -13,20 +16,37 @@ type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
+	CAUGHT_OBJ       = "CAUGHT_ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+	TIME_OBJ         = "TIME"
+)
+
+// The canonical boolean and null objects. The evaluator compares these by
+// identity, so code that builds objects outside of Eval should reuse them.
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
 )
 
 type Object interface {
 	Type() ObjectType
 	Inspect() string
+	// Truthy reports whether the object counts as true in a condition.
+	// Only false and null are falsy; every other value is truthy. These
+	// are the default rules, which the evaluator can be told to tighten.
+	Truthy() bool
 }
 
 type Integer struct {
@@ -34,18 +54,61 @@ type Integer struct {
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
+func (i *Integer) Truthy() bool     { return true }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+func (f *Float) Truthy() bool     { return true }
+
+// Inspect prints the shortest decimal that reads back as the same value, so
+// whole floats drop their fraction: 3.0 prints as 3 and 2.5 as 2.5.
+func (f *Float) Inspect() string { return strconv.FormatFloat(f.Value, 'f', -1, 64) }
+
+// InspectPrecision is obj's Inspect form with every float in it, including
+// those inside arrays and hashes, printed with precision decimal places,
+// rounding as needed. A negative precision gives Inspect's shortest form.
+func InspectPrecision(obj Object, precision int) string {
+	switch obj := obj.(type) {
+	case *Float:
+		return strconv.FormatFloat(obj.Value, 'f', max(precision, -1), 64)
+
+	case *Array:
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, InspectPrecision(e, precision))
+		}
+
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.SortedPairs() {
+			pairs = append(pairs, fmt.Sprintf("%s: %s",
+				InspectPrecision(pair.Key, precision), InspectPrecision(pair.Value, precision)))
+		}
+
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+
+	return obj.Inspect()
+}
+
 type Boolean struct {
 	Value bool
 }
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
+func (b *Boolean) Truthy() bool     { return b.Value }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
+func (n *Null) Truthy() bool     { return false }
 func (n *Null) Inspect() string  { return "null" }
 
 type ReturnValue struct {
@@ -53,22 +116,111 @@ type ReturnValue struct {
 }
 
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
-func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+func (rv *ReturnValue) Truthy() bool     { return rv.Value != nil && rv.Value.Truthy() }
+
+// Inspect marks the value as a pending return; a ReturnValue is normally
+// unwrapped before it is printed, so seeing this points at a leak.
+func (rv *ReturnValue) Inspect() string {
+	if rv.Value == nil {
+		return "return"
+	}
+
+	return "return " + rv.Value.Inspect()
+}
+
+// Break and Continue signal a `break` or `continue` statement. Like a
+// ReturnValue, they unwind enclosing blocks until a loop consumes them.
+type Break struct{}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Truthy() bool     { return true }
+func (b *Break) Inspect() string  { return "break" }
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Truthy() bool     { return true }
+func (c *Continue) Inspect() string  { return "continue" }
 
 type Error struct {
 	Message string
+	// Cause is the error this one wraps, or nil. Its message is already
+	// part of Message.
+	Cause *Error
+	// Line and Column locate the expression that failed, or are zero when
+	// it isn't known.
+	Line, Column int
+	// Stack holds the calls the error passed out of, innermost first.
+	Stack []Frame
+}
+
+// Frame is a call active when an error occurred: the name of the function
+// called and the position of the call.
+type Frame struct {
+	Name         string
+	Line, Column int
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "Error: " + e.Message }
+func (e *Error) Truthy() bool     { return true }
+func (e *Error) Inspect() string {
+	if e.Line == 0 {
+		return "Error: " + e.Message
+	}
+	return fmt.Sprintf("Error: %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Trace is Inspect followed by the stack, one call per line:
+//
+//	Error: 2:12: type mismatch: INTEGER + STRING
+//	  in add at 4:4
+//	  in twice at 6:6
+func (e *Error) Trace() string {
+	var out strings.Builder
+	out.WriteString(e.Inspect())
+	for _, f := range e.Stack {
+		fmt.Fprintf(&out, "\n  in %s at %d:%d", f.Name, f.Line, f.Column)
+	}
+	return out.String()
+}
+
+// WrapError returns an error adding context to cause, in the manner of Go's
+// fmt.Errorf with %w: the message reads "msg: <cause's message>".
+func WrapError(msg string, cause *Error) *Error {
+	return &Error{Message: msg + ": " + cause.Message, Cause: cause}
+}
 
+// Caught is an error stopped by the try builtin. Unlike an Error, which ends
+// evaluation wherever it appears, a Caught is an ordinary value a program can
+// store, pass around and look into.
+type Caught struct {
+	Err *Error
+}
+
+func (c *Caught) Type() ObjectType { return CAUGHT_OBJ }
+func (c *Caught) Truthy() bool     { return true }
+func (c *Caught) Inspect() string  { return c.Err.Inspect() }
+
+// Function is a closure, and Env the scope its body runs in. A function
+// defined at the top level keeps the global environment. One defined inside a
+// call usually gets a compact scope, parented by the global environment,
+// holding copies of just the free variables its body reads. It keeps the
+// whole defining scope instead when a copy could go stale or miss a name:
+// when a free variable isn't bound yet, as with a forward reference to a
+// function defined later in the same call, and when the defining scope is
+// shared because a function reassigning variables made it (see Reassigns).
 type Function struct {
 	Params []*ast.Identifier
 	Body   *ast.BlockStatement
 	Env    *Env
+	// Reassigns is set when the body, nested functions included, contains
+	// an assignment or rebinds a name with let, so the scope of each call
+	// must be shared.
+	Reassigns bool
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Truthy() bool     { return true }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
@@ -81,7 +233,9 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	if f.Body != nil {
+		out.WriteString(f.Body.String())
+	}
 	out.WriteString("\n}")
 
 	return out.String()
@@ -92,35 +246,43 @@ type String struct {
 }
 
 func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Truthy() bool     { return true }
 func (s *String) Inspect() string  { return s.Value }
 
 type BuiltInFns func(args ...Object) Object
 
 type BuiltIn struct {
 	Fn BuiltInFns
+	// Pure marks a builtin whose result depends only on its arguments and
+	// which changes nothing, so calling it keeps a function pure. Builtins
+	// a host registers are never marked.
+	Pure bool
+	// Callback marks a builtin, such as map, that calls the function passed
+	// at position CallbackArg, and is pure whenever that function is.
+	Callback    bool
+	CallbackArg int
 }
 
 func (b *BuiltIn) Type() ObjectType { return BUILTIN_OBJ }
-func (b *BuiltIn) Inspect() string  { return "BuiltIn Fn" }
+func (b *BuiltIn) Truthy() bool     { return true }
+func (b *BuiltIn) Inspect() string  { return "builtin function" }
 
 type Array struct {
 	Elements []Object
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
+func (a *Array) Truthy() bool     { return true }
+func (a *Array) Inspect() string  { return InspectPrecision(a, -1) }
 
-	elements := []string{}
-	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
-	}
-
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
+type Time struct {
+	Value int64 // seconds since the Unix epoch
+}
 
-	return out.String()
+func (t *Time) Type() ObjectType { return TIME_OBJ }
+func (t *Time) Truthy() bool     { return true }
+func (t *Time) Inspect() string {
+	return time.Unix(t.Value, 0).UTC().Format(time.RFC3339)
 }
 
 type HashKey struct {
@@ -150,6 +312,12 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// HashKey lets null be used as a hash key. There is only one null, so every
+// null key lands in the same slot.
+func (n *Null) HashKey() HashKey {
+	return HashKey{Type: n.Type()}
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
@@ -160,23 +328,59 @@ type Hash struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-
-	pairs := []string{}
-
+func (h *Hash) Truthy() bool     { return true }
+func (h *Hash) Inspect() string  { return InspectPrecision(h, -1) }
+
+// SortedPairs returns the hash's pairs in a deterministic order: keys are
+// grouped by type and then ordered by value within each type. Builtins that
+// walk a hash use this so their results don't depend on Go's map order.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, pair)
 	}
 
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
 
-	return out.String()
+	return pairs
+}
+
+func keyLess(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return a.Inspect() < b.Inspect()
+	}
 }
 
 type Hashable interface {
 	HashKey() HashKey
 }
+
+// AsHashKey returns the key obj is stored under in a hash, or false if obj
+// is not Hashable.
+func AsHashKey(obj Object) (HashKey, bool) {
+	hashable, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, false
+	}
+
+	return hashable.HashKey(), true
+}
+
+// IsHashable reports whether obj can be used as a hash key.
+func IsHashable(obj Object) bool {
+	_, ok := obj.(Hashable)
+	return ok
+}
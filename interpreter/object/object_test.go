@@ -1,6 +1,13 @@
 package object
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/connorjbarry/monkey/interpreter/ast"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -28,3 +35,345 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("booleans with same value have different hash keys")
 	}
 }
+
+func TestAsHashKey(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		hashable bool
+	}{
+		{&Integer{Value: 1}, true},
+		{&String{Value: "a"}, true},
+		{TRUE, true},
+		{&Float{Value: 1.5}, false},
+		{NULL, true},
+		{&Array{}, false},
+		{&Hash{Pairs: map[HashKey]HashPair{}}, false},
+		{&Function{}, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsHashable(tt.obj); got != tt.hashable {
+			t.Errorf("IsHashable(%s) = %t, expected %t", tt.obj.Type(), got, tt.hashable)
+		}
+
+		key, ok := AsHashKey(tt.obj)
+		if ok != tt.hashable {
+			t.Errorf("AsHashKey(%s) ok = %t, expected %t", tt.obj.Type(), ok, tt.hashable)
+			continue
+		}
+
+		if ok && key != tt.obj.(Hashable).HashKey() {
+			t.Errorf("AsHashKey(%s) = %v, expected %v", tt.obj.Type(), key, tt.obj.(Hashable).HashKey())
+		}
+	}
+}
+
+func TestHashSortedPairs(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	keys := []Object{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		&String{Value: "a"},
+		&Boolean{Value: true},
+		&Integer{Value: -1},
+		&Boolean{Value: false},
+	}
+	for _, key := range keys {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: key}
+	}
+
+	expected := []string{"false", "true", "-1", "10", "a", "b"}
+	pairs := hash.SortedPairs()
+	if len(pairs) != len(expected) {
+		t.Fatalf("wrong number of pairs. got=%d", len(pairs))
+	}
+
+	for i, pair := range pairs {
+		if pair.Key.Inspect() != expected[i] {
+			t.Errorf("pairs[%d] has wrong key. expected=%q, got=%q", i, expected[i], pair.Key.Inspect())
+		}
+	}
+}
+
+func TestObjectsInspectAndType(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expType  ObjectType
+		expected string
+	}{
+		{&Integer{Value: 5}, INTEGER_OBJ, "5"},
+		{&Float{Value: 2.5}, FLOAT_OBJ, "2.5"},
+		{&Float{Value: 3.0}, FLOAT_OBJ, "3"},
+		{&Float{Value: -0.125}, FLOAT_OBJ, "-0.125"},
+		{&Float{Value: 1e21}, FLOAT_OBJ, "1000000000000000000000"},
+		{&Boolean{Value: true}, BOOLEAN_OBJ, "true"},
+		{&Null{}, NULL_OBJ, "null"},
+		{&ReturnValue{Value: &Integer{Value: 5}}, RETURN_VALUE_OBJ, "return 5"},
+		{&ReturnValue{}, RETURN_VALUE_OBJ, "return"},
+		{&Break{}, BREAK_OBJ, "break"},
+		{&Continue{}, CONTINUE_OBJ, "continue"},
+		{&Error{Message: "boom"}, ERROR_OBJ, "Error: boom"},
+		{&Error{Message: "boom", Line: 2, Column: 5}, ERROR_OBJ, "Error: 2:5: boom"},
+		{&Function{Params: []*ast.Identifier{{Value: "x"}}, Body: &ast.BlockStatement{}}, FUNCTION_OBJ, "fn(x) {\n\n}"},
+		{&Function{}, FUNCTION_OBJ, "fn() {\n\n}"},
+		{&String{Value: "hi"}, STRING_OBJ, "hi"},
+		{&BuiltIn{}, BUILTIN_OBJ, "builtin function"},
+		{&Array{Elements: []Object{&Integer{Value: 1}}}, ARRAY_OBJ, "[1]"},
+		{&Hash{Pairs: map[HashKey]HashPair{}}, HASH_OBJ, "{}"},
+		{&Time{Value: 0}, TIME_OBJ, "1970-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Type() != tt.expType {
+			t.Errorf("%T has wrong type. expected=%s, got=%s", tt.obj, tt.expType, tt.obj.Type())
+		}
+
+		if tt.obj.Inspect() == "" {
+			t.Errorf("%T has empty Inspect()", tt.obj)
+		}
+
+		if tt.obj.Inspect() != tt.expected {
+			t.Errorf("%T has wrong Inspect(). expected=%q, got=%q", tt.obj, tt.expected, tt.obj.Inspect())
+		}
+	}
+}
+
+func TestInspectPrecision(t *testing.T) {
+	tests := []struct {
+		obj       Object
+		precision int
+		expected  string
+	}{
+		{&Float{Value: 0.30000000000000004}, -1, "0.30000000000000004"},
+		{&Float{Value: 0.5}, -1, "0.5"},
+		{&Float{Value: 0.30000000000000004}, 2, "0.30"},
+		{&Float{Value: 2.0 / 3}, 3, "0.667"},
+		{&Float{Value: -1.25}, 1, "-1.2"},
+		{&Float{Value: 3}, 0, "3"},
+		{&Float{Value: 2.5}, 0, "2"},
+		{&Float{Value: 1.5}, -7, "1.5"},
+		{&Integer{Value: 7}, 2, "7"},
+		{&String{Value: "0.125"}, 1, "0.125"},
+		{&Array{Elements: []Object{&Float{Value: 0.125}, &Integer{Value: 1}}}, 2, "[0.12, 1]"},
+		{&Hash{Pairs: map[HashKey]HashPair{
+			(&String{Value: "x"}).HashKey(): {Key: &String{Value: "x"}, Value: &Array{Elements: []Object{&Float{Value: 1}}}},
+		}}, 1, "{x: [1.0]}"},
+	}
+
+	for _, tt := range tests {
+		if got := InspectPrecision(tt.obj, tt.precision); got != tt.expected {
+			t.Errorf("%s at precision %d printed wrong. expected=%q, got=%q", tt.obj.Inspect(), tt.precision, tt.expected, got)
+		}
+	}
+
+	if got := (&Float{Value: 0.30000000000000004}).Inspect(); got != "0.30000000000000004" {
+		t.Errorf("Inspect is not the shortest form. got=%q", got)
+	}
+}
+
+func TestObjectsTruthy(t *testing.T) {
+	tests := []struct {
+		obj      Object
+		expected bool
+	}{
+		{&Integer{Value: 0}, true},
+		{&Integer{Value: 5}, true},
+		{&Float{Value: 0}, true},
+		{&Boolean{Value: true}, true},
+		{&Boolean{Value: false}, false},
+		{&Null{}, false},
+		{&ReturnValue{Value: &Boolean{Value: false}}, false},
+		{&ReturnValue{Value: &Integer{Value: 1}}, true},
+		{&Break{}, true},
+		{&Continue{}, true},
+		{&Error{Message: "boom"}, true},
+		{&Function{}, true},
+		{&String{Value: ""}, true},
+		{&BuiltIn{}, true},
+		{&Array{}, true},
+		{&Hash{Pairs: map[HashKey]HashPair{}}, true},
+		{&Time{Value: 0}, true},
+	}
+
+	for _, tt := range tests {
+		if tt.obj.Truthy() != tt.expected {
+			t.Errorf("%T(%s).Truthy() wrong. expected=%t, got=%t",
+				tt.obj, tt.obj.Inspect(), tt.expected, tt.obj.Truthy())
+		}
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	nested := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, pair := range []HashPair{
+		{Key: &String{Value: "list"}, Value: &Array{Elements: []Object{&Integer{Value: -1}, &String{Value: ""}, NULL}}},
+		{Key: &Integer{Value: 1 << 40}, Value: &Hash{Pairs: map[HashKey]HashPair{}}},
+		{Key: TRUE, Value: &String{Value: "héllo\x00"}},
+	} {
+		nested.Pairs[pair.Key.(Hashable).HashKey()] = pair
+	}
+
+	tests := []Object{
+		NULL,
+		TRUE,
+		FALSE,
+		&Integer{Value: 0},
+		&Integer{Value: -9223372036854775808},
+		&Float{Value: 3.25},
+		&Float{Value: -1e-300},
+		&String{Value: "monkey"},
+		&Array{Elements: []Object{}},
+		&Array{Elements: []Object{&Array{Elements: []Object{FALSE}}}},
+		nested,
+	}
+
+	for _, obj := range tests {
+		data, err := Serialize(obj)
+		if err != nil {
+			t.Fatalf("Serialize(%s) returned error: %s", obj.Inspect(), err)
+		}
+
+		got, err := Deserialize(data)
+		if err != nil {
+			t.Fatalf("Deserialize(%s) returned error: %s", obj.Inspect(), err)
+		}
+
+		if got.Type() != obj.Type() || got.Inspect() != obj.Inspect() {
+			t.Errorf("round trip mismatch. expected=%s (%s), got=%s (%s)",
+				obj.Inspect(), obj.Type(), got.Inspect(), got.Type())
+		}
+	}
+
+	if got, _ := Deserialize([]byte(serialVersion + "t")); got != TRUE {
+		t.Errorf("deserialized true is not the canonical TRUE. got=%p", got)
+	}
+}
+
+func TestToNative(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, pair := range []HashPair{
+		{Key: &String{Value: "name"}, Value: &String{Value: "monkey"}},
+		{Key: &Integer{Value: 1}, Value: &Array{Elements: []Object{TRUE, NULL}}},
+		{Key: FALSE, Value: &Float{Value: 0.5}},
+	} {
+		hash.Pairs[pair.Key.(Hashable).HashKey()] = pair
+	}
+
+	fn := &Function{}
+
+	tests := []struct {
+		obj      Object
+		expected interface{}
+	}{
+		{&Integer{Value: -7}, int64(-7)},
+		{&Float{Value: 2.5}, 2.5},
+		{&String{Value: "hi"}, "hi"},
+		{TRUE, true},
+		{NULL, nil},
+		{&Time{Value: 86400}, time.Date(1970, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{&Array{Elements: []Object{}}, []interface{}{}},
+		{&Array{Elements: []Object{&Integer{Value: 1}, &Array{Elements: []Object{&String{Value: "x"}}}}}, []interface{}{int64(1), []interface{}{"x"}}},
+		{hash, map[string]interface{}{"name": "monkey", "1": []interface{}{true, nil}, "false": 0.5}},
+		{fn, fn},
+	}
+
+	for _, tt := range tests {
+		got := ToNative(tt.obj)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ToNative(%s) wrong. expected=%#v, got=%#v", tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestFromNative(t *testing.T) {
+	fn := &Function{}
+	seven := 7
+
+	tests := []struct {
+		value    interface{}
+		expected string
+		typ      ObjectType
+	}{
+		{int64(-7), "-7", INTEGER_OBJ},
+		{uint8(200), "200", INTEGER_OBJ},
+		{float32(0.5), "0.5", FLOAT_OBJ},
+		{"hi", "hi", STRING_OBJ},
+		{false, "false", BOOLEAN_OBJ},
+		{nil, "null", NULL_OBJ},
+		{&seven, "7", INTEGER_OBJ},
+		{(*int)(nil), "null", NULL_OBJ},
+		{time.Unix(60, 0), "1970-01-01T00:01:00Z", TIME_OBJ},
+		{[]string(nil), "[]", ARRAY_OBJ},
+		{[2]int{1, 2}, "[1, 2]", ARRAY_OBJ},
+		{[]interface{}{1, "a", nil, []int{2}}, "[1, a, null, [2]]", ARRAY_OBJ},
+		{map[string]interface{}{"b": 2, "a": []interface{}{true}}, "{a: [true], b: 2}", HASH_OBJ},
+		{map[int]bool{2: true, 1: false}, "{1: false, 2: true}", HASH_OBJ},
+		{errors.New("boom"), "Error: boom", ERROR_OBJ},
+		{fn, fn.Inspect(), FUNCTION_OBJ},
+		{uint64(1) << 63, "Error: cannot convert 9223372036854775808 to INTEGER: out of range", ERROR_OBJ},
+		{[]interface{}{1, make(chan int)}, "Error: cannot convert chan int to a Monkey value", ERROR_OBJ},
+		{map[float64]int{1.5: 1}, "Error: cannot convert map[float64]int to HASH: unusable key type FLOAT", ERROR_OBJ},
+		{struct{}{}, "Error: cannot convert struct {} to a Monkey value", ERROR_OBJ},
+	}
+
+	for _, tt := range tests {
+		got := FromNative(tt.value)
+		if got.Type() != tt.typ || got.Inspect() != tt.expected {
+			t.Errorf("FromNative(%#v) wrong. expected=%s (%s), got=%s (%s)", tt.value, tt.expected, tt.typ, got.Inspect(), got.Type())
+		}
+	}
+
+	if FromNative(fn) != fn {
+		t.Errorf("FromNative did not give back the function it was handed")
+	}
+	if FromNative(true) != TRUE {
+		t.Errorf("FromNative(true) is not the canonical TRUE")
+	}
+
+	orig := []interface{}{int64(1), "a", map[string]interface{}{"k": []interface{}{2.5, nil}}}
+	if back := ToNative(FromNative(orig)); !reflect.DeepEqual(back, orig) {
+		t.Errorf("round trip mismatch. expected=%#v, got=%#v", orig, back)
+	}
+}
+
+func TestSerializeErrors(t *testing.T) {
+	if _, err := Serialize(&Array{Elements: []Object{&Function{}}}); err == nil || err.Error() != "cannot serialize FUNCTION" {
+		t.Errorf("wrong error serializing a function. got=%v", err)
+	}
+
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{"", "not a serialized value"},
+		{"JSON{}", "not a serialized value"},
+		{serialVersion, "truncated serialized value"},
+		{serialVersion + "s\x05ab", "truncated serialized value"},
+		{serialVersion + "d\x00\x01", "truncated serialized value"},
+		{serialVersion + "a\x02i\x02", "truncated serialized value"},
+		{serialVersion + "nn", "trailing data after serialized value"},
+		{serialVersion + "x", `unknown serialized tag 'x'`},
+		{serialVersion + "h\x01a\x00n", "unusable as hash key: ARRAY"},
+	}
+
+	for _, tt := range tests {
+		_, err := Deserialize([]byte(tt.data))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.data, tt.expected, err)
+		}
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	root := &Error{Message: "not found"}
+	wrapped := WrapError("loading config", root)
+	outer := WrapError("starting", wrapped)
+
+	if outer.Inspect() != "Error: starting: loading config: not found" {
+		t.Errorf("wrong Inspect. got=%q", outer.Inspect())
+	}
+
+	if outer.Cause != wrapped || wrapped.Cause != root || root.Cause != nil {
+		t.Errorf("wrong cause chain: %v -> %v -> %v", outer.Cause, wrapped.Cause, root.Cause)
+	}
+}
@@ -0,0 +1,278 @@
+package object
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// serialVersion prefixes every serialized value so the format can evolve.
+const serialVersion = "MKY1"
+
+// Serialized values are a tag byte followed by a tag-specific payload:
+//
+//	'n'              null
+//	't' / 'f'        true / false
+//	'i' varint       integer
+//	'd' 8 bytes      float, IEEE 754 bits in big-endian order
+//	's' uvarint len  string bytes
+//	'a' uvarint n    n serialized elements
+//	'h' uvarint n    n serialized key/value pairs
+//
+// Functions, builtins and other runtime-only objects can't be serialized.
+const (
+	tagNull    = 'n'
+	tagTrue    = 't'
+	tagFalse   = 'f'
+	tagInteger = 'i'
+	tagFloat   = 'd'
+	tagString  = 's'
+	tagArray   = 'a'
+	tagHash    = 'h'
+)
+
+// Serialize encodes obj in a portable binary format that Deserialize reads.
+func Serialize(obj Object) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(serialVersion)
+
+	if err := encode(&buf, obj); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, obj Object) error {
+	switch obj := obj.(type) {
+	case *Null:
+		buf.WriteByte(tagNull)
+
+	case *Boolean:
+		if obj.Value {
+			buf.WriteByte(tagTrue)
+		} else {
+			buf.WriteByte(tagFalse)
+		}
+
+	case *Integer:
+		buf.WriteByte(tagInteger)
+		buf.Write(binary.AppendVarint(nil, obj.Value))
+
+	case *Float:
+		buf.WriteByte(tagFloat)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(obj.Value)))
+
+	case *String:
+		buf.WriteByte(tagString)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(obj.Value))))
+		buf.WriteString(obj.Value)
+
+	case *Array:
+		buf.WriteByte(tagArray)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(obj.Elements))))
+		for _, el := range obj.Elements {
+			if err := encode(buf, el); err != nil {
+				return err
+			}
+		}
+
+	case *Hash:
+		buf.WriteByte(tagHash)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(obj.Pairs))))
+		for _, pair := range obj.SortedPairs() {
+			if err := encode(buf, pair.Key); err != nil {
+				return err
+			}
+			if err := encode(buf, pair.Value); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cannot serialize %s", obj.Type())
+	}
+
+	return nil
+}
+
+// Deserialize decodes a value produced by Serialize. Booleans and null come
+// back as the canonical TRUE, FALSE and NULL objects.
+func Deserialize(data []byte) (Object, error) {
+	if !bytes.HasPrefix(data, []byte(serialVersion)) {
+		return nil, errors.New("not a serialized value")
+	}
+
+	r := bytes.NewReader(data[len(serialVersion):])
+
+	obj, err := decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after serialized value")
+	}
+
+	return obj, nil
+}
+
+var errTruncated = errors.New("truncated serialized value")
+
+func decode(r *bytes.Reader) (Object, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, errTruncated
+	}
+
+	switch tag {
+	case tagNull:
+		return NULL, nil
+
+	case tagTrue:
+		return TRUE, nil
+
+	case tagFalse:
+		return FALSE, nil
+
+	case tagInteger:
+		val, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, errTruncated
+		}
+		return &Integer{Value: val}, nil
+
+	case tagFloat:
+		var bits [8]byte
+		if _, err := io.ReadFull(r, bits[:]); err != nil {
+			return nil, errTruncated
+		}
+		return &Float{Value: math.Float64frombits(binary.BigEndian.Uint64(bits[:]))}, nil
+
+	case tagString:
+		n, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+		str := make([]byte, n)
+		if _, err := r.Read(str); err != nil && n > 0 {
+			return nil, errTruncated
+		}
+		return &String{Value: string(str)}, nil
+
+	case tagArray:
+		n, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+		els := make([]Object, n)
+		for i := range els {
+			if els[i], err = decode(r); err != nil {
+				return nil, err
+			}
+		}
+		return &Array{Elements: els}, nil
+
+	case tagHash:
+		n, err := readLength(r)
+		if err != nil {
+			return nil, err
+		}
+		pairs := make(map[HashKey]HashPair, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := decode(r)
+			if err != nil {
+				return nil, err
+			}
+			hk, ok := AsHashKey(key)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			val, err := decode(r)
+			if err != nil {
+				return nil, err
+			}
+			pairs[hk] = HashPair{Key: key, Value: val}
+		}
+		return &Hash{Pairs: pairs}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown serialized tag %q", tag)
+	}
+}
+
+// readLength reads a uvarint length, rejecting lengths that can't possibly
+// fit in the remaining input so corrupt data can't force huge allocations.
+func readLength(r *bytes.Reader) (uint64, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, errTruncated
+	}
+
+	if n > uint64(r.Len()) {
+		return 0, errTruncated
+	}
+
+	return n, nil
+}
+
+// SaveEnv writes the bindings made directly in env to w, as a serialized
+// hash from name to value. Bindings from enclosing scopes aren't saved.
+// A binding that can't be serialized, such as a function, is an error
+// unless skipUnserializable is set, in which case it is left out.
+func SaveEnv(env *Env, w io.Writer, skipUnserializable bool) error {
+	bindings := &Hash{Pairs: make(map[HashKey]HashPair)}
+
+	for _, name := range env.Names() {
+		val := env.store[name]
+		if err := encode(new(bytes.Buffer), val); err != nil {
+			if skipUnserializable {
+				continue
+			}
+			return fmt.Errorf("cannot save %s: %w", name, err)
+		}
+
+		key := &String{Value: name}
+		bindings.Pairs[key.HashKey()] = HashPair{Key: key, Value: val}
+	}
+
+	data, err := Serialize(bindings)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// LoadEnv reads bindings written by SaveEnv into a new environment.
+func LoadEnv(r io.Reader) (*Env, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := Deserialize(data)
+	if err != nil {
+		return nil, err
+	}
+
+	bindings, ok := obj.(*Hash)
+	if !ok {
+		return nil, fmt.Errorf("saved environment must be HASH, got %s", obj.Type())
+	}
+
+	env := NewEnvironment()
+	for _, pair := range bindings.Pairs {
+		name, ok := pair.Key.(*String)
+		if !ok {
+			return nil, fmt.Errorf("saved binding names must be STRING, got %s", pair.Key.Type())
+		}
+		env.Set(name.Value, pair.Value)
+	}
+
+	return env, nil
+}
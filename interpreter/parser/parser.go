@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -14,28 +15,49 @@ import (
 const (
 	_ int = iota
 	LOWEST
-	EQUALS      // ==
-	LESSGREATER // >, <
-	SUM         // +
-	PRODUCT     // *
+	TERNARY     // ? :
+	OR          // ||
+	AND         // &&
+	EQUALS      // ==, in
+	LESSGREATER // >, <, >=, <=
+	SUM         // +, |, ^
+	PRODUCT     // *, &, <<, >>
 	PREFIX      // -X, !X
+	POWER       // **
 	CALL        // func()
 	INDEX       // []
 )
 
 var precedences = map[token.TokenType]int{
+	token.QUESTION: TERNARY,
+	token.OR:       OR,
+	token.AND:      AND,
 	token.EQ:       EQUALS,
 	token.NEQ:      EQUALS,
+	token.IN:       EQUALS,
 	token.LT:       LESSGREATER,
 	token.GT:       LESSGREATER,
+	token.LT_EQ:    LESSGREATER,
+	token.GT_EQ:    LESSGREATER,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+	token.BIT_OR:   SUM,
+	token.BIT_XOR:  SUM,
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.BIT_AND:  PRODUCT,
+	token.SHL:      PRODUCT,
+	token.SHR:      PRODUCT,
+	token.POW:      POWER,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 }
 
+// DefaultMaxDepth is how deeply expressions may nest before the parser gives
+// up, so pathological input can't exhaust the stack.
+const DefaultMaxDepth = 1000
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
@@ -47,22 +69,52 @@ type Parser struct {
 	currT token.Token
 	peekT token.Token
 
-	errors []string
+	// peekNewline is set when a line break came before peekT.
+	peekNewline bool
+
+	// comments collected immediately before currT and peekT
+	currDoc string
+	peekDoc string
+
+	// ahead holds tokens read past peekT, to decide how to read a ++ or
+	// --, or left over from splitting one.
+	ahead []lexed
+
+	errors []Error
+	// synced is how many errors had been reported when the parser last
+	// synchronized; those have been dealt with.
+	synced int
+
+	depth    int
+	maxDepth int
+	halted   bool
+
+	// autoSemicolons ends a statement at a line break; see
+	// SetAutoSemicolons. groups records, for each bracket open around
+	// currT, whether line breaks inside it are ignored.
+	autoSemicolons bool
+	groups         []bool
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+// lexed is a token read from the lexer, with the comments before it and
+// whether a line break came first.
+type lexed struct {
+	tok     token.Token
+	doc     string
+	newline bool
+}
 
-	// read two tokens, sets currT and peekT
-	p.nextToken()
-	p.nextToken()
+func New(l *lexer.Lexer) *Parser {
+	p := &Parser{l: l, errors: []Error{}, maxDepth: DefaultMaxDepth}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix((token.IDENTIFER), p.parseIdentifier)
 	p.registerPrefix((token.INT), p.parseIntegerLiteral)
+	p.registerPrefix((token.FLOAT), p.parseFloatLiteral)
+	p.registerPrefix((token.ILLEGAL), p.parseIllegal)
 	p.registerPrefix((token.BANG), p.parsePrefixExpression)
 	p.registerPrefix((token.MINUS), p.parsePrefixExpression)
 	p.registerPrefix((token.TRUE), p.parseBoolean)
@@ -71,27 +123,160 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix((token.IF), p.parseIfExpression)
 	p.registerPrefix((token.FUNCTION), p.parseFunctionLiteral)
 	p.registerPrefix((token.STRING), p.parseStringLiteral)
+	p.registerPrefix((token.INTERPOLATED), p.parseInterpolatedString)
 	p.registerPrefix((token.LBRACKET), p.parseArrayLiteral)
 	p.registerPrefix((token.LBRACE), p.parseHashLiteral)
+	p.registerPrefix((token.MATCH), p.parseMatchExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix((token.PLUS), p.parseInfixExpression)
 	p.registerInfix((token.MINUS), p.parseInfixExpression)
 	p.registerInfix((token.ASTERISK), p.parseInfixExpression)
 	p.registerInfix((token.SLASH), p.parseInfixExpression)
+	p.registerInfix((token.PERCENT), p.parseInfixExpression)
+	p.registerInfix((token.POW), p.parseInfixExpression)
+	p.registerInfix((token.BIT_AND), p.parseInfixExpression)
+	p.registerInfix((token.BIT_OR), p.parseInfixExpression)
+	p.registerInfix((token.BIT_XOR), p.parseInfixExpression)
+	p.registerInfix((token.SHL), p.parseInfixExpression)
+	p.registerInfix((token.SHR), p.parseInfixExpression)
+	p.registerInfix((token.AND), p.parseInfixExpression)
+	p.registerInfix((token.OR), p.parseInfixExpression)
 	p.registerInfix((token.EQ), p.parseInfixExpression)
 	p.registerInfix((token.NEQ), p.parseInfixExpression)
+	p.registerInfix((token.IN), p.parseInfixExpression)
 	p.registerInfix((token.LT), p.parseInfixExpression)
 	p.registerInfix((token.GT), p.parseInfixExpression)
+	p.registerInfix((token.LT_EQ), p.parseInfixExpression)
+	p.registerInfix((token.GT_EQ), p.parseInfixExpression)
+	p.registerInfix((token.QUESTION), p.parseTernaryExpression)
 	p.registerInfix((token.LPAREN), p.parseCallExpression)
 	p.registerInfix((token.LBRACKET), p.parseIndexExpression)
 
+	// read two tokens, sets currT and peekT; this comes after registering
+	// the parse functions, which splitStep consults
+	p.nextToken()
+	p.nextToken()
+
 	return p
 }
 
+// SetMaxDepth changes how deeply expressions may nest; see DefaultMaxDepth.
+func (p *Parser) SetMaxDepth(depth int) {
+	p.maxDepth = depth
+}
+
+// SetAutoSemicolons turns automatic semicolon insertion on or off. With it
+// on, a line break ends a statement that is complete so far if the next
+// line starts with something that could begin a new one, so
+//
+//	let a = f
+//	(1)
+//
+// is two statements rather than the call f(1). An expression can still be
+// continued on the next line by ending the line with its operator, or by
+// starting the next one with an operator that can't begin an expression,
+// such as + or &&. Inside parentheses, brackets and hash literals line
+// breaks are ignored; in blocks they end statements as at the top level.
+func (p *Parser) SetAutoSemicolons(on bool) {
+	p.autoSemicolons = on
+}
+
 func (p *Parser) nextToken() {
 	p.currT = p.peekT
-	p.peekT = p.l.NextToken()
+	p.currDoc = p.peekDoc
+	p.trackGroups()
+
+	next := p.read()
+	if next.tok.Type == token.INCREMENT || next.tok.Type == token.DECREMENT {
+		next = p.splitStep(next)
+	}
+
+	p.peekT, p.peekDoc, p.peekNewline = next.tok, next.doc, next.newline
+}
+
+// read returns the next token, taking it from ahead if any are waiting
+// there.
+func (p *Parser) read() lexed {
+	if len(p.ahead) > 0 {
+		next := p.ahead[0]
+		p.ahead = p.ahead[1:]
+		return next
+	}
+
+	next := lexed{tok: p.l.NextToken()}
+	for next.tok.Type == token.COMMENT {
+		if next.doc != "" {
+			next.doc += "\n"
+		}
+		next.doc += next.tok.Literal
+		next.tok = p.l.NextToken()
+	}
+	next.newline = p.l.NewlineBefore()
+
+	return next
+}
+
+// splitStep decides how to read a ++ or -- token that follows currT. It
+// stays one token only where it could end an `x++` or `x--` statement:
+// straight after a name and, for --, where reading it as a minus and a
+// negation, as in 5--3, couldn't carry on with the next token anyway.
+// Elsewhere it is split into two + or - tokens, so 5--3 is 5 - -3 and
+// --x is -(-x).
+func (p *Parser) splitStep(step lexed) lexed {
+	if p.currT.Type == token.IDENTIFER && !step.newline {
+		if step.tok.Type == token.INCREMENT {
+			return step
+		}
+
+		after := p.read()
+		p.ahead = append([]lexed{after}, p.ahead...)
+		if p.prefixParseFns[after.tok.Type] == nil || (after.newline && p.autoSemicolons) {
+			return step
+		}
+	}
+
+	op := token.Token{Type: token.PLUS, Literal: "+", Line: step.tok.Line, Column: step.tok.Column}
+	if step.tok.Type == token.DECREMENT {
+		op.Type, op.Literal = token.MINUS, "-"
+	}
+
+	second := op
+	if second.Column > 0 {
+		second.Column++
+	}
+	p.ahead = append([]lexed{{tok: second}}, p.ahead...)
+
+	return lexed{tok: op, doc: step.doc, newline: step.newline}
+}
+
+// trackGroups updates groups as currT opens or closes a bracket. A brace
+// is taken to open a block; parseHashLiteral corrects that for hashes.
+func (p *Parser) trackGroups() {
+	switch p.currT.Type {
+	case token.LPAREN, token.LBRACKET:
+		p.groups = append(p.groups, true)
+	case token.LBRACE:
+		p.groups = append(p.groups, false)
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		if len(p.groups) > 0 {
+			p.groups = p.groups[:len(p.groups)-1]
+		}
+	}
+}
+
+// statementEnds reports whether automatic semicolon insertion ends the
+// statement before peekT.
+func (p *Parser) statementEnds() bool {
+	if !p.autoSemicolons || !p.peekNewline {
+		return false
+	}
+
+	if len(p.groups) > 0 && p.groups[len(p.groups)-1] {
+		return false
+	}
+
+	return p.prefixParseFns[p.peekT.Type] != nil
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -118,19 +303,100 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// parseStatment parses one statement. If that reports an error, the rest of
+// the statement is skipped with synchronize and nil is returned, so parsing
+// can carry on and find any further errors.
 func (p *Parser) parseStatment() ast.Statement {
+	errs := len(p.errors)
+
+	stmt := p.parseStatementKind()
+
+	if len(p.errors) > max(errs, p.synced) {
+		p.synchronize()
+		return nil
+	}
+
+	return stmt
+}
+
+// statementKeywords start statements, so after an error the parser can
+// resume at one of them.
+var statementKeywords = map[token.TokenType]bool{
+	token.LET:      true,
+	token.RETURN:   true,
+	token.WHILE:    true,
+	token.FOR:      true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+}
+
+// synchronize skips past the statement in which an error was found. It
+// stops on the semicolon ending it, or before a statement keyword, a line
+// break if semicolons are inserted automatically, or the brace closing the
+// enclosing block, whichever comes first outside any brackets opened while
+// skipping.
+func (p *Parser) synchronize() {
+	p.synced = len(p.errors)
+	depth := 0
+
+	for !p.currTIs(token.EOF) {
+		switch p.currT.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth = max(depth-1, 0)
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		if depth == 0 {
+			if statementKeywords[p.peekT.Type] || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+				return
+			}
+			if p.autoSemicolons && p.peekNewline {
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseStatementKind() ast.Statement {
 	switch p.currT.Type {
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForInStatement()
+	case token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.currT}
+		p.skipSemicolon()
+		return stmt
+	case token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.currT}
+		p.skipSemicolon()
+		return stmt
+	case token.IDENTIFER:
+		if p.peekTokenIs(token.ASSIGN) {
+			return p.parseAssignStatement()
+		}
+		if p.peekTokenIs(token.INCREMENT) || p.peekTokenIs(token.DECREMENT) {
+			return p.parseIncDecStatement()
+		}
+		return p.parseExpressionStatment()
 	default:
 		return p.parseExpressionStatment()
 	}
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.currT}
+	stmt := &ast.LetStatement{Token: p.currT, Doc: p.currDoc}
 
 	if !p.expectPeek(token.IDENTIFER) {
 		return nil
@@ -146,13 +412,43 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.currTIs(token.SEMICOLON) {
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Doc = stmt.Doc
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+func (p *Parser) parseAssignStatement() *ast.AssignStatement {
+	stmt := &ast.AssignStatement{Token: p.currT}
+	stmt.Name = &ast.Identifier{Token: p.currT, Value: p.currT.Literal}
+
+	p.nextToken()
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseIncDecStatement() *ast.IncDecStatement {
+	name := &ast.Identifier{Token: p.currT, Value: p.currT.Literal}
+
+	p.nextToken()
+
+	stmt := &ast.IncDecStatement{Token: p.currT, Name: name, Operator: p.currT.Literal}
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.currT}
 
@@ -160,13 +456,79 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.currTIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+// skipSemicolon consumes the optional semicolon ending a statement.
+func (p *Parser) skipSemicolon() {
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.currT}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
+func (p *Parser) parseForInStatement() ast.Statement {
+	stmt := &ast.ForInStatement{Token: p.currT}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENTIFER) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.currT, Value: p.currT.Literal}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	p.skipSemicolon()
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatment() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currT}
 
@@ -180,6 +542,14 @@ func (p *Parser) parseExpressionStatment() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.depth > p.maxDepth {
+		p.tooDeepError()
+		return nil
+	}
+
 	prefix := p.prefixParseFns[p.currT.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.currT.Type)
@@ -188,7 +558,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	leftExp := prefix()
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecendence() {
+	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecendence() && !p.statementEnds() {
 		infix := p.infixParseFns[p.peekT.Type]
 		if infix == nil {
 			return leftExp
@@ -205,14 +575,21 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	return &ast.Identifier{Token: p.currT, Value: p.currT.Literal}
 }
 
+// parseIntegerLiteral parses an INT token with Go's literal rules, the same
+// ones the `int` builtin uses: a leading zero makes the literal octal, so
+// 0123 is 83 and 089 is an error.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.currT}
 
 	val, err := strconv.ParseInt(p.currT.Literal, 0, 64)
 
+	if errors.Is(err, strconv.ErrRange) {
+		p.errorAt(p.currT, fmt.Sprintf("integer literal out of range for 64-bit: %s", p.currT.Literal))
+		return nil
+	}
+
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.currT.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currT, fmt.Sprintf("could not parse %q as integer", p.currT.Literal))
 		return nil
 	}
 
@@ -220,6 +597,30 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.currT}
+
+	val, err := strconv.ParseFloat(p.currT.Literal, 64)
+
+	if err != nil {
+		p.errorAt(p.currT, fmt.Sprintf("could not parse %q as float", p.currT.Literal))
+		return nil
+	}
+
+	lit.Value = val
+	return lit
+}
+
+// parseIllegal reports a token the lexer couldn't make sense of, quoting
+// its source text rather than just the ILLEGAL type.
+func (p *Parser) parseIllegal() ast.Expression {
+	if !p.halted {
+		p.errorAt(p.currT, fmt.Sprintf("illegal token: %s", p.currT.Literal))
+	}
+
+	return nil
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.currT, Value: p.currTIs(token.TRUE)}
 }
@@ -244,6 +645,11 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	prec := p.currPrecendence()
+	// ** is right-associative: parsing the right operand one level lower
+	// lets a following ** bind to it, so 2 ** 3 ** 2 is 2 ** (3 ** 2).
+	if p.currTIs(token.POW) {
+		prec--
+	}
 	p.nextToken()
 
 	exp.Right = p.parseExpression(prec)
@@ -251,6 +657,26 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return exp
 }
 
+// parseTernaryExpression parses `cond ? a : b`. Both branches are parsed at
+// the lowest precedence, so the ternary is right-associative and the
+// alternative takes in the rest of the expression: `c ? 1 : 2 + 3` is
+// `c ? 1 : (2 + 3)`.
+func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression {
+	exp := &ast.TernaryExpression{Token: p.currT, Condition: condition}
+
+	p.nextToken()
+	exp.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Alternative = p.parseExpression(LOWEST)
+
+	return exp
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	p.nextToken()
 
@@ -365,34 +791,68 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	return exp
 }
 
-// Deprecated: use parseExpressionList instead
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.currT, Value: p.currT.Literal}
+}
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return args
+// parseInterpolatedString splits an INTERPOLATED token into its text and
+// ${...} segments, parsing each expression segment with a parser of its own
+// that shares this one's nesting limit.
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currT}
+
+	segments, err := lexer.Split(p.currT.Literal)
+	if err != nil {
+		p.errorAt(p.currT, err.Error())
+		return nil
 	}
 
-	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	for _, seg := range segments {
+		if !seg.Expr {
+			tok := token.Token{Type: token.STRING, Literal: seg.Text}
+			str.Parts = append(str.Parts, &ast.StringLiteral{Token: tok, Value: seg.Text})
+			continue
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
+		// The raw text starts just after the opening quote.
+		line, col := advancePosition(p.currT.Line, p.currT.Column+1, p.currT.Literal[:seg.Offset])
+		sub := New(lexer.New(seg.Text, lexer.WithPosition(line, col)))
+		sub.depth = p.depth
+		sub.maxDepth = p.maxDepth
 
-		args = append(args, p.parseExpression(LOWEST))
-	}
+		if sub.currTIs(token.EOF) {
+			p.errorAt(sub.currT, "empty interpolation ${}")
+			return nil
+		}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		exp := sub.parseExpression(LOWEST)
+		if !sub.peekTokenIs(token.EOF) && len(sub.errors) == 0 {
+			sub.errorAt(sub.peekT, fmt.Sprintf("unexpected %s in interpolation ${%s}", sub.peekT.Literal, seg.Text))
+		}
+		if len(sub.errors) > 0 {
+			p.errors = append(p.errors, sub.errors...)
+			return nil
+		}
+
+		str.Parts = append(str.Parts, exp)
 	}
 
-	return args
+	return str
 }
 
-func (p *Parser) parseStringLiteral() ast.Expression {
-	return &ast.StringLiteral{Token: p.currT, Value: p.currT.Literal}
+// advancePosition returns the position reached by reading text from line
+// and col.
+func advancePosition(line, col int, text string) (int, int) {
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+
+	return line, col
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
@@ -405,6 +865,9 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currT}
+	if len(p.groups) > 0 {
+		p.groups[len(p.groups)-1] = true
+	}
 
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
@@ -434,6 +897,94 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: p.currT}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return exp
+}
+
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	start := p.currT
+	arm := &ast.MatchArm{Pattern: p.parseExpression(LOWEST)}
+
+	if !p.validPattern(arm.Pattern, start) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+
+	p.nextToken()
+	arm.Body = p.parseExpression(LOWEST)
+
+	return arm
+}
+
+// validPattern reports whether pattern can be matched against, recording an
+// error at start, where the pattern begins, if not.
+func (p *Parser) validPattern(pattern ast.Expression, start token.Token) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		if _, ok := pattern.Right.(*ast.IntegerLiteral); ok && pattern.Operator == "-" {
+			return true
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range pattern.Elements {
+			if !p.validPattern(el, start) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return false
+	}
+
+	p.errorAt(start, fmt.Sprintf("invalid match pattern: %s", pattern.String()))
+	return false
+}
+
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	list := []ast.Expression{}
 
@@ -459,12 +1010,42 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 	return list
 }
 
+// parseIndexExpression parses `left[index]`, or a slice `left[low:high]`
+// when a colon follows the index or directly follows the bracket.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currT, Left: left}
+	tok := p.currT
 
 	p.nextToken()
 
-	exp.Index = p.parseExpression(LOWEST)
+	if p.currTIs(token.COLON) {
+		return p.parseSliceExpression(tok, left, nil)
+	}
+
+	index := p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+// parseSliceExpression parses the rest of a slice, from the colon on.
+func (p *Parser) parseSliceExpression(tok token.Token, left, low ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Low: low}
+
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		return exp
+	}
+
+	p.nextToken()
+	exp.High = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
@@ -507,16 +1088,61 @@ func (p *Parser) currPrecendence() int {
 	return LOWEST
 }
 
+// Error is a syntax error and the position of the token it was found at.
+type Error struct {
+	Line, Column int
+	Message      string
+}
+
+// Errors returns the messages of the errors found, in order.
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// ErrorList returns the errors found, in order, with their positions.
+func (p *Parser) ErrorList() []Error {
 	return p.errors
 }
 
+func (p *Parser) errorAt(tok token.Token, msg string) {
+	p.errors = append(p.errors, Error{Line: tok.Line, Column: tok.Column, Message: msg})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
+	if p.halted {
+		return
+	}
+
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekT.Type)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.peekT, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
+	if p.halted {
+		return
+	}
+
 	msg := fmt.Sprintf("no prefix parse function found for %s", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.currT, msg)
+}
+
+// tooDeepError records that the nesting limit was hit and skips the rest of
+// the input. Errors the unwinding parse functions would report are a side
+// effect of bailing out, so they are suppressed.
+func (p *Parser) tooDeepError() {
+	if p.halted {
+		return
+	}
+
+	msg := fmt.Sprintf("expression too deeply nested (max depth %d)", p.maxDepth)
+	p.errorAt(p.currT, msg)
+	p.halted = true
+
+	for !p.peekTokenIs(token.EOF) {
+		p.nextToken()
+	}
 }
@@ -2,9 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/connorjbarry/monkey/interpreter/lexer"
+	"github.com/connorjbarry/monkey/interpreter/token"
 
 	"github.com/connorjbarry/monkey/interpreter/ast"
 )
@@ -158,6 +161,164 @@ func TestIntegerLiteralExpression(t *testing.T) {
 
 }
 
+func TestStatementsWithoutTrailingSemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5", "let x = 5;"},
+		{"return x", "return x;"},
+		{"let x = 1 + 2\nreturn x", "let x = (1 + 2);return x;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestInterpolatedStringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"hi ${name}!"`, "hi ${name}!", 3},
+		{`"${a + b * c}"`, "${(a + (b * c))}", 1},
+		{`"${x}${y}"`, "${x}${y}", 2},
+		{`"n = ${ {"a": 1}["a"] }."`, "n = ${({a: 1}[a])}.", 3},
+		{`"outer ${"inner ${x}"}"`, "outer ${inner ${x}}", 2},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("stmt.Expression not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+		if str.String() != tt.expected {
+			t.Errorf("wrong String() for %q. expected=%q, got=%q", tt.input, tt.expected, str.String())
+		}
+		if len(str.Parts) != tt.parts {
+			t.Errorf("wrong number of parts for %q. expected=%d, got=%d", tt.input, tt.parts, len(str.Parts))
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${}"`, "empty interpolation ${}"},
+		{`"${1 2}"`, "unexpected 2 in interpolation ${1 2}"},
+		{`"${)}"`, "no prefix parse function found for )"},
+	}
+
+	for _, tt := range errTests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2.5;", 2.5},
+		{"0.125", 0.125},
+		{"3.0", 3},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		float, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if float.Value != tt.expected {
+			t.Errorf("wrong value for %q. expected=%g, got=%g", tt.input, tt.expected, float.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"10", 10},
+		{"0123", 83},
+		{"007", 7},
+		{"9223372036854775807", 9223372036854775807},
+		{"1_000_000", 1000000},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		integer, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if integer.Value != tt.expected {
+			t.Errorf("wrong value for %q. expected=%d, got=%d", tt.input, tt.expected, integer.Value)
+		}
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "integer literal out of range for 64-bit: 9223372036854775808"},
+		{"let x = 100000000000000000000000;", "integer literal out of range for 64-bit: 100000000000000000000000"},
+		{"089", `could not parse "089" as integer`},
+		{"1__000", "illegal token: 1__000"},
+		{"let x = 5_;", "illegal token: 5_"},
+		{`puts("a\qb")`, `illegal token: "a\qb"`},
+		{"let s = \"\"\"open\nblock", "illegal token: \"\"\"open\nblock"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -214,6 +375,10 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 - 5;", 5, "-", 5},
 		{"5 * 5;", 5, "*", 5},
 		{"5 / 5;", 5, "/", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"true && false;", true, "&&", false},
+		{"true || false;", true, "||", false},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
@@ -277,6 +442,18 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 > 5 == false",
 			"((3 > 5) == false)",
 		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == 1 && b < 2 || !c",
+			"(((a == 1) && (b < 2)) || (!c))",
+		},
 		{
 			"3 < 5 == true",
 			"((3 < 5) == true)",
@@ -313,6 +490,34 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"1.5 + 2 * -0.5",
+			"(1.5 + (2 * (-0.5)))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** -b * c",
+			"((a ** (-b)) * c)",
+		},
+		{
+			"a ** b[0]",
+			"(a ** (b[0]))",
+		},
 		{
 			"3 + 4; -5 * 5",
 			"(3 + 4)((-5) * 5)",
@@ -373,6 +578,58 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"x + 1 in xs == !found",
+			"(((x + 1) in xs) == (!found))",
+		},
+		{
+			"a in b && c in d",
+			"((a in b) && (c in d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"1 << 4 == 16",
+			"((1 << 4) == 16)",
+		},
+		{
+			"a | b & c ^ d",
+			"((a | (b & c)) ^ d)",
+		},
+		{
+			"a + b << 2 < c >> 1",
+			"((a + (b << 2)) < (c >> 1))",
+		},
+		{
+			"a & b == c | d",
+			"((a & b) == (c | d))",
+		},
+		{
+			"true ? 1 : 2 + 3",
+			"(true ? 1 : (2 + 3))",
+		},
+		{
+			"a < b || c ? x + 1 : y * 2",
+			"(((a < b) || c) ? (x + 1) : (y * 2))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"1 + (a ? 2 : 3) * 4",
+			"(1 + ((a ? 2 : 3) * 4))",
+		},
+		{
+			"f(a ? b : c, d)",
+			"f((a ? b : c), d)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -454,21 +711,273 @@ func TestIfExpression(t *testing.T) {
 		return
 	}
 
-	if len(exp.Consequence.Statements) != 1 {
-		t.Fatalf("exp.Consequence.Statements not 1. got=%d", len(exp.Consequence.Statements))
+	if len(exp.Consequence.Statements) != 1 {
+		t.Fatalf("exp.Consequence.Statements not 1. got=%d", len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("exp.Consequence.Statements[0] not *ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if exp.Alternative != nil {
+		t.Fatalf("exp.Alternative not nil. got=%T", exp.Alternative)
+	}
+}
+
+func TestTernaryExpression(t *testing.T) {
+	input := `x < y ? x : y`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TernaryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.TernaryExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	if !testIdentifier(t, exp.Consequence, "x") || !testIdentifier(t, exp.Alternative, "y") {
+		return
+	}
+
+	for _, input := range []string{"a ? b", "a ? b c", "a ? : c", "a ? b :"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x; y }`
+
+	l := lexer.New(input)
+	p := New(l)
+
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("ParseProgram() returned program with %d statements, expected 1", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("stmt.Body.Statements not 2. got=%d", len(stmt.Body.Statements))
+	}
+
+	if stmt.String() != "while(x < y) xy" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	p = New(lexer.New("while (x) { x }; y"))
+	program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Errorf("trailing semicolon not skipped. got %d statements", len(program.Statements))
+	}
+
+	for _, input := range []string{"while x { 1 }", "while (x) 1"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	input := `for (x in range(10, 0, -1)) { x; y }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("ParseProgram() returned program with %d statements, expected 1", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Name, "x") {
+		return
+	}
+
+	if stmt.Iterable.String() != "range(10, 0, (-1))" {
+		t.Errorf("stmt.Iterable wrong. got=%q", stmt.Iterable.String())
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("stmt.Body.Statements not 2. got=%d", len(stmt.Body.Statements))
+	}
+
+	if stmt.String() != "for (x in range(10, 0, (-1))) xy" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	for _, input := range []string{"for x in xs { 1 }", "for (1 in xs) { 1 }", "for (x of xs) { 1 }", "for (x in xs) 1"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestAssignStatements(t *testing.T) {
+	input := `x = 5; y = x * 2
+	z == 1;`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("Statements[0] not *ast.AssignStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "x" || !testLiteralExpression(t, stmt.Value, 5) {
+		return
+	}
+
+	stmt, ok = program.Statements[1].(*ast.AssignStatement)
+	if !ok {
+		t.Fatalf("Statements[1] not *ast.AssignStatement. got=%T", program.Statements[1])
+	}
+	if !testInfixExpression(t, stmt.Value, "x", "*", 2) {
+		return
+	}
+
+	if _, ok := program.Statements[2].(*ast.ExpressionStatement); !ok {
+		t.Errorf("Statements[2] not *ast.ExpressionStatement. got=%T", program.Statements[2])
+	}
+
+	if program.String() != "x = 5;y = (x * 2);(z == 1)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+}
+
+func TestIncDecStatements(t *testing.T) {
+	input := `i++; j--;
+	k + 1`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	tests := []struct {
+		name     string
+		operator string
+	}{
+		{"i", "++"},
+		{"j", "--"},
+	}
+
+	for i, tt := range tests {
+		stmt, ok := program.Statements[i].(*ast.IncDecStatement)
+		if !ok {
+			t.Fatalf("Statements[%d] not *ast.IncDecStatement. got=%T", i, program.Statements[i])
+		}
+		if stmt.Name.Value != tt.name || stmt.Operator != tt.operator {
+			t.Errorf("Statements[%d] wrong. expected %s%s, got %s%s", i, tt.name, tt.operator, stmt.Name.Value, stmt.Operator)
+		}
+	}
+
+	if program.String() != "i++;j--;(k + 1)" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
+	}
+
+	steps := []struct {
+		input    string
+		expected string
+	}{
+		{"5--3", "(5 - (-3))"},
+		{"--i", "(-(-i))"},
+		{"i---j", "(i - (-(-j)))"},
+		{"i--\n-1", "(i - (-(-1)))"},
+		{"i--\nf()", "(i - (-f()))"},
+		{"i -- j", "(i - (-j))"},
+		{"f(i--1)", "f((i - (-1)))"},
+		{"i-- // done", "i--;"},
+		{"i--\nlet j = 1;", "i--;let j = 1;"},
+	}
+
+	for _, tt := range steps {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.Statements[0].String() != tt.expected && program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	asi := New(lexer.New("let a = 1;\ni--\n-1"))
+	asi.SetAutoSemicolons(true)
+	if program := asi.ParseProgram(); program.String() != "let a = 1;i--;(-1)" {
+		t.Errorf("wrong parse with automatic semicolons. got=%q", program.String())
+	}
+
+	for _, input := range []string{"5++", "i++ + 1", "f(i++)"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
+func TestBreakAndContinueStatements(t *testing.T) {
+	input := `while (true) { break; continue }`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.WhileStatement)
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("stmt.Body.Statements not 2. got=%d", len(stmt.Body.Statements))
 	}
 
-	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("exp.Consequence.Statements[0] not *ast.ExpressionStatement. got=%T", exp.Consequence.Statements[0])
+	if _, ok := stmt.Body.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[0] not *ast.BreakStatement. got=%T", stmt.Body.Statements[0])
 	}
 
-	if !testIdentifier(t, consequence.Expression, "x") {
-		return
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("Statements[1] not *ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
 	}
 
-	if exp.Alternative != nil {
-		t.Fatalf("exp.Alternative not nil. got=%T", exp.Alternative)
+	if program.String() != "whiletrue break;continue;" {
+		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
 
@@ -631,6 +1140,46 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Args[2], 4, "+", 5)
 }
 
+func TestCallExpressionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"add()", []string{}},
+		{"add(1)", []string{"1"}},
+		{"add(1, 2 * 3, 4 + 5)", []string{"1", "(2 * 3)", "(4 + 5)"}},
+		{"add(f(x, y), [1, 2], {})", []string{"f(x, y)", "[1, 2]", "{}"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+		if !ok {
+			t.Fatalf("expression is not *ast.CallExpression for %q", tt.input)
+		}
+
+		args := make([]string, len(exp.Args))
+		for i, arg := range exp.Args {
+			args[i] = arg.String()
+		}
+
+		if fmt.Sprint(args) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong arguments for %q. expected=%v, got=%v", tt.input, tt.expected, args)
+		}
+	}
+
+	for _, input := range []string{"add(1,", "add(1 2)", "add(,)"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 	l := lexer.New(input)
@@ -691,6 +1240,51 @@ func TestParsingIndexExpressions(t *testing.T) {
 
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a[1:3]", "(a[1:3])"},
+		{"a[:2]", "(a[:2])"},
+		{"a[1:]", "(a[1:])"},
+		{"a[:]", "(a[:])"},
+		{"a[i + 1:len(a) - 1]", "(a[(i + 1):(len(a) - 1)])"},
+		{"a[c ? 1 : 2]", "(a[(c ? 1 : 2)])"},
+		{"a[1:2][0]", "((a[1:2])[0])"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("a[1:3]"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.SliceExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.SliceExpression. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if !testIdentifier(t, exp.Left, "a") || !testIntegerLiteral(t, exp.Low, 1) || !testIntegerLiteral(t, exp.High, 3) {
+		return
+	}
+
+	for _, input := range []string{"a[1:2:3]", "a[1:2", "a[:"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", input)
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	l := lexer.New(input)
@@ -776,6 +1370,348 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 	}
 }
 
+func TestMatchExpressionParsing(t *testing.T) {
+	input := `match (x) { [a, b] => a + b; [] => 0; "s" => 1, -1 => 2; _ => -1 }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression not *ast.MatchExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Subject, "x") {
+		return
+	}
+
+	expected := []string{"[a, b] => (a + b)", "[] => 0", "s => 1", "(-1) => 2", "_ => (-1)"}
+	if len(exp.Arms) != len(expected) {
+		t.Fatalf("exp.Arms has wrong length. want %d, got=%d", len(expected), len(exp.Arms))
+	}
+
+	for i, arm := range exp.Arms {
+		if arm.String() != expected[i] {
+			t.Errorf("arm %d wrong. expected=%q, got=%q", i, expected[i], arm.String())
+		}
+	}
+}
+
+func TestMatchExpressionGuardParsing(t *testing.T) {
+	input := `match (x) { [a, b] if a > b => a; [a, b] => b }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	exp, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("expression not *ast.MatchExpression. got=%T", program.Statements[0])
+	}
+
+	if len(exp.Arms) != 2 {
+		t.Fatalf("exp.Arms has wrong length. want 2, got=%d", len(exp.Arms))
+	}
+
+	if !testInfixExpression(t, exp.Arms[0].Guard, "a", ">", "b") {
+		return
+	}
+
+	if exp.Arms[1].Guard != nil {
+		t.Errorf("exp.Arms[1].Guard not nil. got=%s", exp.Arms[1].Guard.String())
+	}
+}
+
+func TestMatchExpressionInvalidPattern(t *testing.T) {
+	l := lexer.New(`match (x) { a + b => 1 }`)
+	p := New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if p.Errors()[0] != "invalid match pattern: (a + b)" {
+		t.Errorf("wrong error message. got=%q", p.Errors()[0])
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	input := `
+    // add sums its arguments.
+    // It only works on integers.
+    let add = fn(x, y) {
+        // not a doc comment
+        x + y; // trailing
+    };
+
+    let five = 5;
+
+    // five doubled
+    let ten = add(five, five);
+    `
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	tests := []struct {
+		expectedName string
+		expectedDoc  string
+	}{
+		{"add", "add sums its arguments.\nIt only works on integers."},
+		{"five", ""},
+		{"ten", "five doubled"},
+	}
+
+	for i, tt := range tests {
+		stmt := program.Statements[i].(*ast.LetStatement)
+		if stmt.Name.Value != tt.expectedName {
+			t.Errorf("statement %d has wrong name. expected=%q, got=%q", i, tt.expectedName, stmt.Name.Value)
+		}
+		if stmt.Doc != tt.expectedDoc {
+			t.Errorf("statement %d has wrong doc. expected=%q, got=%q", i, tt.expectedDoc, stmt.Doc)
+		}
+	}
+
+	fn, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("add is not *ast.FunctionLiteral. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+	}
+
+	if fn.Doc != tests[0].expectedDoc {
+		t.Errorf("function literal has wrong doc. got=%q", fn.Doc)
+	}
+
+	if fn.Body.String() != "(x + y)" {
+		t.Errorf("function body wrong. got=%q", fn.Body.String())
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x 5;\nlet y = 10;\nlet = 3;", []string{
+			"expected next token to be =, got INT instead",
+			"expected next token to be IDENTIFER, got = instead",
+		}},
+		{"let x = (1 + 2;\nlet y = 3;\nlet z = ;\nputs(y);", []string{
+			"expected next token to be ), got ; instead",
+			"no prefix parse function found for ;",
+		}},
+		{"let f = fn() { let = 1; 2 }; let a 1;", []string{
+			"expected next token to be IDENTIFER, got = instead",
+			"expected next token to be =, got INT instead",
+		}},
+		{"let a = f(x, [1, 2)) let b = 2; return ]", []string{
+			"expected next token to be ], got ) instead",
+			"no prefix parse function found for ]",
+		}},
+		{"while (x { 1 } let y = 2; while (true) {}", []string{
+			"expected next token to be ), got { instead",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if strings.Join(p.Errors(), "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	input := "let a = 1 +\nlet b = 2\nlet c = * 3\nb"
+	p := New(lexer.New(input))
+	p.SetAutoSemicolons(true)
+	program := p.ParseProgram()
+
+	expected := []string{
+		"no prefix parse function found for LET",
+		"no prefix parse function found for *",
+	}
+	if strings.Join(p.Errors(), "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong errors with automatic semicolons.\nexpected=%q\ngot=%q", expected, p.Errors())
+	}
+
+	if len(program.Statements) != 1 || program.Statements[0].String() != "b" {
+		t.Errorf("statements after errors not parsed. got=%q", program.String())
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []Error
+	}{
+		{"let x = 5;\nlet y = x +;", []Error{{2, 12, "no prefix parse function found for ;"}}},
+		{"let x 5;", []Error{{1, 7, "expected next token to be =, got INT instead"}}},
+		{"let n = 99999999999999999999;", []Error{{1, 9, "integer literal out of range for 64-bit: 99999999999999999999"}}},
+		{"match (x) { 1 + 2 => 3 }", []Error{{1, 13, "invalid match pattern: (1 + 2)"}, {1, 24, "no prefix parse function found for }"}}},
+		{`let s = "a ${1 2}";`, []Error{{1, 16, "unexpected 2 in interpolation ${1 2}"}}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		if !slices.Equal(p.ErrorList(), tt.expected) {
+			t.Errorf("wrong errors for %q.\nexpected=%v\ngot=%v", tt.input, tt.expected, p.ErrorList())
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		input string
+	}{
+		{strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000)},
+		{strings.Repeat("[", 100000) + strings.Repeat("]", 100000)},
+		{"let x = " + strings.Repeat("-", 100000) + "1;"},
+		{strings.Repeat("(", 100000)},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected exactly 1 error, got %d: %v", len(errors), errors[:min(len(errors), 3)])
+		}
+
+		expected := fmt.Sprintf("expression too deeply nested (max depth %d)", DefaultMaxDepth)
+		if errors[0] != expected {
+			t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+		}
+	}
+}
+
+func TestSetMaxDepth(t *testing.T) {
+	input := "((((1))))"
+
+	p := New(lexer.New(input))
+	p.SetMaxDepth(5)
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	p = New(lexer.New(input))
+	p.SetMaxDepth(4)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 1 || p.Errors()[0] != "expression too deeply nested (max depth 4)" {
+		t.Errorf("wrong errors. got=%v", p.Errors())
+	}
+}
+
+func TestInterpolationPositions(t *testing.T) {
+	input := "let s = \"ab ${x + yy}\";\nlet t = \"a\n  ${z}\";"
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	first := program.Statements[0].(*ast.LetStatement).Value.(*ast.InterpolatedString)
+	sum := first.Parts[1].(*ast.InfixExpression)
+	second := program.Statements[1].(*ast.LetStatement).Value.(*ast.InterpolatedString)
+
+	tests := []struct {
+		tok  token.Token
+		line int
+		col  int
+	}{
+		{first.Token, 1, 9},
+		{sum.Left.(*ast.Identifier).Token, 1, 15},
+		{sum.Token, 1, 17},
+		{sum.Right.(*ast.Identifier).Token, 1, 19},
+		{second.Parts[1].(*ast.Identifier).Token, 3, 5},
+	}
+
+	for _, tt := range tests {
+		if tt.tok.Line != tt.line || tt.tok.Column != tt.col {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d", tt.tok.Literal, tt.line, tt.col, tt.tok.Line, tt.tok.Column)
+		}
+	}
+}
+
+func TestAutoSemicolons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let a = 1\nlet b = a\n(b)\n[1, 2][0]\n-a", []string{
+			"let a = 1;", "let b = a;", "b", "([1, 2][0])", "(-a)",
+		}},
+		{"a = f\n(1)\nx++\nreturn x", []string{
+			"a = f;", "1", "x++;", "return x;",
+		}},
+		{"let total = 1 +\n  2 *\n  3\nlet ok = total\n  == 7\n  && true", []string{
+			"let total = (1 + (2 * 3));", "let ok = ((total == 7) && true);",
+		}},
+		{"let r = add(\n  1,\n  -2\n)\n[r]", []string{
+			"let r = add(1, (-2));", "[r]",
+		}},
+		{"let v = (a\n  - b)\nlet w = [a\n  (b)]", []string{
+			"let v = (a - b);", "let w = [a(b)];",
+		}},
+		{"let h = {\n  \"a\": 1\n  - 2\n}\nh", []string{
+			"let h = {a: (1 - 2)};", "h",
+		}},
+		{"let f = fn(x) {\n  let y = x\n  -y\n}\n(f)", []string{
+			"let f = fn(x)let y = x;(-y);", "f",
+		}},
+		{"map(xs, fn(x) {\n  x\n  (1)\n})", []string{
+			"map(xs, fn(x)x1)",
+		}},
+		{"let a = 1 // one\n// two\n-a", []string{
+			"let a = 1;", "(-a)",
+		}},
+		{"if (a) { b }\nelse { c }\n(d)", []string{
+			"ifa belse c", "d",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.SetAutoSemicolons(true)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var got []string
+		for _, stmt := range program.Statements {
+			got = append(got, stmt.String())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong statements for %q.\nexpected=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New("let a = f\n(1)\n-a"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 || program.Statements[0].String() != "let a = (f(1) - a);" {
+		t.Errorf("line breaks should be ignored by default. got=%q", program.String())
+	}
+}
+
 func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
 	opExp, ok := exp.(*ast.InfixExpression)
 
@@ -901,7 +1837,7 @@ func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 }
 
 func checkParserErrors(t *testing.T, p *Parser) {
-	errors := p.errors
+	errors := p.Errors()
 
 	if len(errors) == 0 {
 		return
@@ -915,3 +1851,131 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.FailNow()
 }
+
+func TestFormat(t *testing.T) {
+	input := `// double returns twice x.
+let double = fn(x) { x * 2 };
+let config = {"name": "monkey", "debug": false, "level": 3, "tags": ["a", "b"]};
+let classify = fn(n) { if (n < 0) { "negative" } else { if (n == 0) { "zero" } else { "positive" } } };
+let point = {"x": 1, "y": 2};
+puts(double(21), classify(-1));
+let handlers = {"add": fn(a, b) { a + b }};
+let i = 0;
+while (i < 3) { i++; if (i == 2) { continue; } }
+match (point["x"]) { 1 if true => "one", [a, _] => a, _ => "other" }`
+
+	expected := `// double returns twice x.
+let double = fn(x) {
+	x * 2;
+};
+
+let config = {
+	"name": "monkey",
+	"debug": false,
+	"level": 3,
+	"tags": ["a", "b"],
+};
+
+let classify = fn(n) {
+	if (n < 0) {
+		"negative";
+	} else {
+		if (n == 0) {
+			"zero";
+		} else {
+			"positive";
+		}
+	}
+};
+
+let point = {"x": 1, "y": 2};
+puts(double(21), classify(-1));
+
+let handlers = {
+	"add": fn(a, b) {
+		a + b;
+	},
+};
+
+let i = 0;
+
+while (i < 3) {
+	i++;
+	if (i == 2) {
+		continue;
+	}
+}
+
+match (point["x"]) {
+	1 if true => "one",
+	[a, _] => a,
+	_ => "other",
+}
+`
+
+	program := New(lexer.New(input)).ParseProgram()
+	got := ast.Format(program)
+	if got != expected {
+		t.Errorf("wrong format.\nexpected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	p := New(lexer.New(got))
+	reparsed := p.ParseProgram()
+	checkParserErrors(t, p)
+	if ast.Format(reparsed) != got {
+		t.Errorf("formatting is not stable. got:\n%s", ast.Format(reparsed))
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b * c", "a + b * c;\n"},
+		{"(a + b) * c", "(a + b) * c;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"2 ** 3 ** 2", "2 ** 3 ** 2;\n"},
+		{"(2 ** 3) ** 2", "(2 ** 3) ** 2;\n"},
+		{"(-2) ** 2", "(-2) ** 2;\n"},
+		{"-(2 ** 2)", "-2 ** 2;\n"},
+		{"-(-x)", "-(-x);\n"},
+		{"!(a && b) || c", "!(a && b) || c;\n"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e;\n"},
+		{"a ? b : (c ? d : e)", "a ? b : c ? d : e;\n"},
+		{"x + (c ? 1 : 2)", "x + (c ? 1 : 2);\n"},
+		{"(f(x))[0]", "f(x)[0];\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"arr[1:]", "arr[1:];\n"},
+		{"arr[:-1]", "arr[:-1];\n"},
+		{"1 in [1, 2]", "1 in [1, 2];\n"},
+		{`"tab\there \"q\" \${x}"`, `"tab\there \"q\" \${x}";` + "\n"},
+		{`"hi ${name}, ${1 + 2}!"`, `"hi ${name}, ${1 + 2}!";` + "\n"},
+		{"\"\"\"two\nlines\"\"\"", `"two\nlines";` + "\n"},
+		{"1_000 + 2.5", "1000 + 2.5;\n"},
+		{"let x = 1; x = x + 1; x--", "let x = 1;\nx = x + 1;\nx--;\n"},
+		{"fn() {}", "fn() {};\n"},
+		{"if (a) { 1 };\n-1", "if (a) {\n\t1;\n};\n\n-1;\n"},
+		{"{}", "{};\n"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		got := ast.Format(program)
+		if got != tt.expected {
+			t.Errorf("wrong format for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+			continue
+		}
+
+		p = New(lexer.New(got))
+		reparsed := p.ParseProgram()
+		checkParserErrors(t, p)
+		if reparsed.String() != program.String() {
+			t.Errorf("formatting %q changed its meaning. expected=%q, got=%q", tt.input, program.String(), reparsed.String())
+		}
+	}
+}
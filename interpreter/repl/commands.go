@@ -0,0 +1,226 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/connorjbarry/monkey/interpreter/ast"
+	"github.com/connorjbarry/monkey/interpreter/evaluator"
+	"github.com/connorjbarry/monkey/interpreter/lexer"
+	"github.com/connorjbarry/monkey/interpreter/object"
+	"github.com/connorjbarry/monkey/interpreter/parser"
+	"github.com/connorjbarry/monkey/interpreter/token"
+)
+
+// runCommand runs a line starting with ':' as a command to the REPL itself
+// rather than as Monkey code:
+//
+//	:env          print every binding in the session
+//	:clear        start again with no bindings, keeping the session's modes
+//	:load <file>  evaluate the Monkey source in file into the session
+//	:save <file>  write the session's bindings to file as let statements
+//	:quit         end the session
+//
+// It returns the environment the session continues with and whether it
+// should end.
+func runCommand(line string, env *object.Env, out io.Writer) (*object.Env, bool) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line[1:]), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "env":
+		for _, name := range env.Names() {
+			val, _ := env.Get(name)
+			fmt.Fprintf(out, "%s = %s\n", name, object.InspectPrecision(val, env.Modes().FloatPrecision))
+		}
+
+	case "clear":
+		fresh := object.NewEnvironment()
+		*fresh.Modes() = *env.Modes()
+		return fresh, false
+
+	case "load":
+		if arg == "" {
+			io.WriteString(out, "usage: :load <file>\n")
+			break
+		}
+		loadFile(arg, env, out)
+
+	case "save":
+		if arg == "" {
+			io.WriteString(out, "usage: :save <file>\n")
+			break
+		}
+		saveFile(arg, env, out)
+
+	case "quit":
+		return env, true
+
+	default:
+		fmt.Fprintf(out, "unknown command :%s (try :env, :clear, :load <file>, :save <file> or :quit)\n", name)
+	}
+
+	return env, false
+}
+
+// loadFile evaluates the program in path into env, reporting any error to
+// out.
+func loadFile(path string, env *object.Env, out io.Writer) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, "could not load %s: %v\n", path, err)
+		return
+	}
+
+	Run(string(src), env, out)
+}
+
+// load parses src and evaluates it into env. Bindings made before a runtime
+// error stay in env; a program that doesn't parse isn't run at all.
+func load(src string, env *object.Env) error {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return errors.New(formatParserErrors(src, p.ErrorList()))
+	}
+
+	if err, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		return errors.New(formatError(src, err))
+	}
+
+	return nil
+}
+
+// saveFile writes the bindings in env to path as source that :load reads
+// back, reporting what it did to out.
+func saveFile(path string, env *object.Env, out io.Writer) {
+	var src strings.Builder
+	skipped := save(&src, env)
+
+	if err := os.WriteFile(path, []byte(src.String()), 0o644); err != nil {
+		fmt.Fprintf(out, "could not save %s: %v\n", path, err)
+		return
+	}
+
+	fmt.Fprintf(out, "saved %d bindings to %s\n", len(env.Names())-len(skipped), path)
+	if len(skipped) > 0 {
+		fmt.Fprintf(out, "not saved, having no source form: %s\n", strings.Join(skipped, ", "))
+	}
+}
+
+// save writes the bindings made directly in env to w as let statements,
+// formatted by ast.Format, and returns the names it had to leave out. The
+// values that can be saved are those that serialize, written as literals,
+// and functions defined at the top level of env, written as their source.
+// A closure is left out, since the values it captured would be lost, as are
+// builtins and floats that are NaN or infinite.
+func save(w io.Writer, env *object.Env) []string {
+	program := &ast.Program{}
+	var skipped []string
+
+	for _, name := range env.Names() {
+		val, _ := env.Get(name)
+		exp, ok := sourceOf(val, env)
+		if !ok {
+			skipped = append(skipped, name)
+			continue
+		}
+
+		program.Statements = append(program.Statements, &ast.LetStatement{
+			Name:  &ast.Identifier{Value: name},
+			Value: exp,
+		})
+	}
+
+	io.WriteString(w, ast.Format(program))
+
+	return skipped
+}
+
+// sourceOf returns an expression that evaluates to a copy of val, if there
+// is one.
+func sourceOf(val object.Object, env *object.Env) (ast.Expression, bool) {
+	switch val := val.(type) {
+	case *object.Null:
+		return &ast.IfExpression{Condition: &ast.Boolean{Value: false}}, true
+
+	case *object.Boolean:
+		return &ast.Boolean{Token: token.Token{Type: token.LookupIdentifier(val.Inspect()), Literal: val.Inspect()}, Value: val.Value}, true
+
+	case *object.Integer:
+		if val.Value == math.MinInt64 {
+			// The literal for its magnitude would be out of range.
+			return &ast.InfixExpression{
+				Left:     negate(&ast.IntegerLiteral{Value: math.MaxInt64}),
+				Operator: "-",
+				Right:    &ast.IntegerLiteral{Value: 1},
+			}, true
+		}
+		if val.Value < 0 {
+			return negate(&ast.IntegerLiteral{Value: -val.Value}), true
+		}
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: val.Inspect()}, Value: val.Value}, true
+
+	case *object.Float:
+		if math.IsNaN(val.Value) || math.IsInf(val.Value, 0) {
+			return nil, false
+		}
+		lit := strconv.FormatFloat(math.Abs(val.Value), 'f', -1, 64)
+		if !strings.Contains(lit, ".") {
+			lit += ".0"
+		}
+		exp := &ast.FloatLiteral{Token: token.Token{Type: token.FLOAT, Literal: lit}}
+		if math.Signbit(val.Value) {
+			return negate(exp), true
+		}
+		return exp, true
+
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: val.Value}, Value: val.Value}, true
+
+	case *object.Array:
+		arr := &ast.ArrayLiteral{Elements: make([]ast.Expression, len(val.Elements))}
+		for i, el := range val.Elements {
+			exp, ok := sourceOf(el, env)
+			if !ok {
+				return nil, false
+			}
+			arr.Elements[i] = exp
+		}
+		return arr, true
+
+	case *object.Hash:
+		// The keys carry token literals, as parsed ones would, so that
+		// Format writes the pairs sorted by key rather than in map order.
+		hash := &ast.HashLiteral{Pairs: make(map[ast.Expression]ast.Expression, len(val.Pairs))}
+		for _, pair := range val.Pairs {
+			key, ok := sourceOf(pair.Key, env)
+			if !ok {
+				return nil, false
+			}
+			value, ok := sourceOf(pair.Value, env)
+			if !ok {
+				return nil, false
+			}
+			hash.Pairs[key] = value
+		}
+		return hash, true
+
+	case *object.Function:
+		if val.Env != env {
+			return nil, false
+		}
+		return &ast.FunctionLiteral{Params: val.Params, Body: val.Body}, true
+	}
+
+	return nil, false
+}
+
+func negate(exp ast.Expression) ast.Expression {
+	return &ast.PrefixExpression{Operator: "-", Right: exp}
+}
@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// DefaultHistoryLimit is how many lines a History keeps when no limit is
+// given.
+const DefaultHistoryLimit = 1000
+
+// History is the lines entered at the REPL, oldest first. It is loaded from
+// a file when a session starts and written back as lines are added, so
+// earlier sessions' input can be recalled.
+type History struct {
+	path    string
+	limit   int
+	entries []string
+}
+
+// LoadHistory reads the history kept at path, keeping at most limit lines,
+// or DefaultHistoryLimit if limit isn't positive. A file that is missing or
+// can't be read gives an empty history rather than an error: history is a
+// convenience, and the REPL works without it.
+func LoadHistory(path string, limit int) *History {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+
+	h := &History{path: path, limit: limit}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.add(scanner.Text())
+	}
+
+	return h
+}
+
+// Entries returns the lines in the history, oldest first.
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add appends line to the history and saves it. Blank lines and repeats of
+// the line before are left out.
+func (h *History) Add(line string) error {
+	if !h.add(line) {
+		return nil
+	}
+
+	return h.Save()
+}
+
+func (h *History) add(line string) bool {
+	if strings.TrimSpace(line) == "" {
+		return false
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return false
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+
+	return true
+}
+
+// Save writes the history to its file, replacing what was there.
+func (h *History) Save() error {
+	var out strings.Builder
+	for _, line := range h.entries {
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+
+	return os.WriteFile(h.path, []byte(out.String()), 0o600)
+}
@@ -0,0 +1,203 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// lineReader reads the REPL's input a line at a time, showing prompt first.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scanReader reads lines from any io.Reader, with no editing of its own.
+type scanReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scanReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// terminalReader edits lines with a lineEditor, putting the terminal into
+// raw mode only while a line is being read so that programs run with the
+// terminal as they would find it.
+type terminalReader struct {
+	fd     int
+	editor *lineEditor
+}
+
+// newLineReader returns a line editor when in is a terminal and a plain
+// scanReader otherwise.
+func newLineReader(in io.Reader, out io.Writer, history *History) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		return &terminalReader{
+			fd:     int(f.Fd()),
+			editor: &lineEditor{in: bufio.NewReader(f), out: out, history: history},
+		}
+	}
+
+	return &scanReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+func (r *terminalReader) ReadLine(prompt string) (string, error) {
+	restore, ok := makeRaw(r.fd)
+	if !ok {
+		fmt.Fprint(r.editor.out, prompt)
+		line, err := r.editor.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	return r.editor.ReadLine(prompt)
+}
+
+// Keys the line editor understands, besides printable characters.
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyEnter     = '\r'
+	keyNewline   = '\n'
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// lineEditor edits a line on a terminal in raw mode, where it has to echo
+// what is typed itself. Left and right move the cursor; up and down step
+// through the history, with whatever was being typed kept as the newest
+// entry.
+type lineEditor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+}
+
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	var entries []string
+	if e.history != nil {
+		entries = e.history.Entries()
+	}
+
+	// lines holds the history followed by the line being typed; edits to a
+	// recalled line last until it is entered, as in most shells.
+	lines := append(append([]string{}, entries...), "")
+	current := len(lines) - 1
+
+	buf := []rune{}
+	cursor := 0
+
+	recall := func(i int) {
+		lines[current] = string(buf)
+		current = i
+		buf = []rune(lines[current])
+		cursor = len(buf)
+	}
+
+	for {
+		e.redraw(prompt, buf, cursor)
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyNewline:
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			buf, cursor = buf[:0], 0
+
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+
+		case keyBackspace, keyDelete:
+			if cursor > 0 {
+				buf = append(buf[:cursor-1], buf[cursor:]...)
+				cursor--
+			}
+
+		case keyCtrlA:
+			cursor = 0
+
+		case keyCtrlE:
+			cursor = len(buf)
+
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				if current > 0 {
+					recall(current - 1)
+				}
+			case 'B':
+				if current < len(lines)-1 {
+					recall(current + 1)
+				}
+			case 'C':
+				cursor = min(cursor+1, len(buf))
+			case 'D':
+				cursor = max(cursor-1, 0)
+			}
+
+		default:
+			if unicode.IsPrint(r) {
+				buf = append(buf[:cursor], append([]rune{r}, buf[cursor:]...)...)
+				cursor++
+			}
+		}
+	}
+}
+
+// readEscape reads the rest of an ESC [ x sequence and returns x, or 0 for
+// anything else.
+func (e *lineEditor) readEscape() rune {
+	if r, _, err := e.in.ReadRune(); err != nil || r != '[' {
+		return 0
+	}
+
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+
+	return r
+}
+
+// redraw rewrites the current terminal line and puts the cursor in place.
+func (e *lineEditor) redraw(prompt string, buf []rune, cursor int) {
+	var out strings.Builder
+
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(buf))
+	out.WriteString("\x1b[K")
+	if back := len(buf) - cursor; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+
+	io.WriteString(e.out, out.String())
+}
@@ -1,12 +1,14 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"strings"
 
+	"github.com/connorjbarry/monkey/interpreter/errors"
 	"github.com/connorjbarry/monkey/interpreter/lexer"
 	"github.com/connorjbarry/monkey/interpreter/parser"
+	"github.com/connorjbarry/monkey/interpreter/token"
 
 	"github.com/connorjbarry/monkey/interpreter/object"
 
@@ -15,44 +17,205 @@ import (
 
 const PROMPT = ">> "
 
+// CONTINUE_PROMPT asks for more of an input that isn't complete yet.
+const CONTINUE_PROMPT = "... "
+
+// Options configures a REPL session.
+type Options struct {
+	// Calculator prints the value of every bare expression on a line, as
+	// `1 + 2; 3 * 4` printing both 3 and 12, instead of only the last
+	// value. Output from puts goes to the REPL's writer as well.
+	Calculator bool
+	// HistoryFile is where lines entered are saved, to be recalled with
+	// the arrow keys in this session and later ones. Empty keeps no
+	// history.
+	HistoryFile string
+	// HistoryLimit caps the lines kept in HistoryFile; zero means
+	// DefaultHistoryLimit.
+	HistoryLimit int
+	// Setup, if set, is called with the session's environment before the
+	// first line is read, so the host can set modes on it such as the
+	// float precision.
+	Setup func(env *object.Env)
+}
+
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	StartWithOptions(in, out, Options{})
+}
+
+func StartWithOptions(in io.Reader, out io.Writer, opts Options) {
 	env := object.NewEnvironment()
+	if opts.Calculator {
+		evaluator.SetOutput(env, out)
+	}
+	if opts.Setup != nil {
+		opts.Setup(env)
+	}
 
-	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+	var history *History
+	if opts.HistoryFile != "" {
+		history = LoadHistory(opts.HistoryFile, opts.HistoryLimit)
+	}
+	reader := newLineReader(in, out, history)
+
+	// A history that can't be saved is reported once; the session carries
+	// on with it held in memory.
+	warned := false
+	remember := func(line string) {
+		if history == nil {
 			return
 		}
+		if err := history.Add(line); err != nil && !warned {
+			fmt.Fprintf(out, "could not save history: %v\n", err)
+			warned = true
+		}
+	}
 
-		line := scanner.Text()
+	for {
+		line, ok := readInput(reader, remember)
+		if !ok {
+			return
+		}
 
 		if line == "exit()" {
 			break
 		}
 
+		if strings.HasPrefix(line, ":") {
+			var quit bool
+			if env, quit = runCommand(line, env, out); quit {
+				break
+			}
+			continue
+		}
+
 		l := lexer.New(line)
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			io.WriteString(out, formatParserErrors(line, p.ErrorList()))
+			io.WriteString(out, "\n")
+			continue
+		}
+
+		if opts.Calculator {
+			evaluated := evaluator.EvalCalculator(program, env)
+			if err, ok := evaluated.(*object.Error); ok {
+				io.WriteString(out, formatError(line, err))
+				io.WriteString(out, "\n")
+			}
 			continue
 		}
 
 		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
+		if err, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, formatError(line, err))
+			io.WriteString(out, "\n")
+		} else if evaluated != nil {
+			io.WriteString(out, object.InspectPrecision(evaluated, env.Modes().FloatPrecision))
 			io.WriteString(out, "\n")
 		}
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// readInput reads one input, which carries on over further lines, each
+// prompted with CONTINUE_PROMPT, for as long as it is incomplete. A command
+// is always a single line. An empty
+// line ends the input early, leaving the parser to report what is missing.
+// Each line read is passed to remember.
+func readInput(r lineReader, remember func(string)) (string, bool) {
+	line, err := r.ReadLine(PROMPT)
+	if err != nil {
+		return "", false
+	}
+	remember(line)
+
+	if strings.HasPrefix(line, ":") {
+		return line, true
 	}
+
+	lines := []string{line}
+	for incomplete(strings.Join(lines, "\n")) {
+		line, err := r.ReadLine(CONTINUE_PROMPT)
+		if err != nil || line == "" {
+			break
+		}
+		remember(line)
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n"), true
+}
+
+// incomplete reports whether src leaves a bracket or a triple-quoted string
+// open. It goes by the lexer's tokens, so brackets inside strings and
+// comments don't count.
+func incomplete(src string) bool {
+	depth := 0
+
+	l := lexer.New(src)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		case token.ILLEGAL:
+			if strings.HasPrefix(tok.Literal, `"""`) {
+				return true
+			}
+		}
+	}
+
+	return depth > 0
+}
+
+// Run parses src and evaluates it in env as one program, the way a script is
+// run: nothing is printed but what the program itself writes, and an error
+// is written to out with the line of src it occurred on and a caret under
+// its position. It reports whether src ran without error.
+func Run(src string, env *object.Env, out io.Writer) bool {
+	if err := load(src, env); err != nil {
+		fmt.Fprintln(out, err)
+		return false
+	}
+
+	return true
+}
+
+// formatParserErrors lists errs, each with the line of src it was found on.
+func formatParserErrors(src string, errs []parser.Error) string {
+	var out strings.Builder
+
+	out.WriteString(" parser errors:")
+	for _, err := range errs {
+		msg := errors.Format(src, err.Line, err.Column, err.Message)
+		out.WriteString("\n\t")
+		out.WriteString(strings.ReplaceAll(msg, "\n", "\n\t"))
+	}
+
+	return out.String()
+}
+
+// formatError renders err, raised running src, as its trace followed by the
+// line of src it occurred on with a caret under the position. An error that
+// passed out of a call may have occurred in a function defined in an earlier
+// input, so then the caret points at the call src made instead.
+func formatError(src string, err *object.Error) string {
+	if err.Line == 0 {
+		return err.Trace()
+	}
+
+	if len(err.Stack) == 0 {
+		return "Error: " + errors.Format(src, err.Line, err.Column, err.Message)
+	}
+
+	outer := err.Stack[len(err.Stack)-1]
+	if context := errors.Context(src, outer.Line, outer.Column); context != "" {
+		return err.Trace() + "\n" + context
+	}
+
+	return err.Trace()
 }
@@ -0,0 +1,359 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/connorjbarry/monkey/interpreter/object"
+)
+
+func TestCalculatorMode(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3\n"},
+		{"let x = 5", ""},
+		{"let x = 5\nx * 2", "10\n"},
+		{"1; 2 * 3", "1\n6\n"},
+		{"let y = 1; y + 1; let z = 3", "2\n"},
+		{`puts("hi")`, "hi\n"},
+		{"if (false) { 1 }", ""},
+		{"1 + true", "Error: 1:3: type mismatch: INTEGER + BOOLEAN\n  1 | 1 + true\n    |   ^\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		StartWithOptions(strings.NewReader(tt.input), &out, Options{Calculator: true})
+
+		got := strings.ReplaceAll(out.String(), PROMPT, "")
+		if got != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDefaultModePrintsLastValue(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("1; 2 * 3"), &out)
+
+	got := strings.ReplaceAll(out.String(), PROMPT, "")
+	if got != "6\n" {
+		t.Errorf("wrong output. expected=%q, got=%q", "6\n", got)
+	}
+}
+
+func TestSetupSetsModes(t *testing.T) {
+	var out bytes.Buffer
+	setup := func(env *object.Env) { env.Modes().FloatPrecision = 2 }
+	StartWithOptions(strings.NewReader("let x = 0.1 + 0.2\nx\n:env\n:clear\n1.0 / 3"), &out, Options{Setup: setup})
+
+	expected := "0.30\nx = 0.30\n0.33\n"
+	got := strings.ReplaceAll(out.String(), PROMPT, "")
+	if got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestMultilineInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let f = fn(x) {\n  x * 2\n}\nf(21)",
+			">> ... ... >> 42\n>> ",
+		},
+		{
+			"[1,\n2,\n3][1]",
+			">> ... ... 2\n>> ",
+		},
+		{
+			`"{" + "(" + "[" + "}"`,
+			">> {([}\n>> ",
+		},
+		{
+			"\"\"\"a\nb\"\"\"",
+			">> ... a\nb\n>> ",
+		},
+		{
+			"let s = \"\"\"{\n\"\"\"; len(s)",
+			">> ... 2\n>> ",
+		},
+		{
+			"[1,\n\n1",
+			">> ...  parser errors:\n\t1:4: no prefix parse function found for EOF\n\t  1 | [1,\n\t    |    ^\n" +
+				"\t1:5: expected next token to be ], got EOF instead\n\t  1 | [1,\n\t    |    ^\n>> 1\n>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := LoadHistory(path, 3)
+	if len(h.Entries()) != 0 {
+		t.Fatalf("history from a missing file is not empty. got=%q", h.Entries())
+	}
+
+	for _, line := range []string{"a", "b", "b", "  ", "c", "d"} {
+		if err := h.Add(line); err != nil {
+			t.Fatalf("Add(%q) failed: %v", line, err)
+		}
+	}
+
+	expected := []string{"b", "c", "d"}
+	if strings.Join(h.Entries(), ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong entries. expected=%q, got=%q", expected, h.Entries())
+	}
+
+	reloaded := LoadHistory(path, 2)
+	if strings.Join(reloaded.Entries(), ",") != "c,d" {
+		t.Errorf("wrong entries after reload. expected=%q, got=%q", []string{"c", "d"}, reloaded.Entries())
+	}
+}
+
+func TestHistoryAcrossSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	var out bytes.Buffer
+	StartWithOptions(strings.NewReader("let x = [\n1]\nx"), &out, Options{HistoryFile: path})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("history file not written: %v", err)
+	}
+	if string(data) != "let x = [\n1]\nx\n" {
+		t.Errorf("wrong history file. got=%q", data)
+	}
+
+	unwritable := filepath.Join(t.TempDir(), "missing", "history")
+	out.Reset()
+	StartWithOptions(strings.NewReader("1\n2"), &out, Options{HistoryFile: unwritable})
+
+	got := strings.ReplaceAll(out.String(), PROMPT, "")
+	if !strings.HasPrefix(got, "could not save history: ") || strings.Count(got, "could not save") != 1 || !strings.HasSuffix(got, "1\n2\n") {
+		t.Errorf("wrong output with an unwritable history. got=%q", got)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	h := LoadHistory(filepath.Join(t.TempDir(), "history"), 0)
+	h.Add("first")
+	h.Add("second")
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abd\x7fc\r", "abc"},
+		{"ac\x1b[Db\r", "abc"},
+		{"bc\x01a\x05d\r", "abcd"},
+		{"\x1b[A\r", "second"},
+		{"\x1b[A\x1b[A\x1b[A\r", "first"},
+		{"new\x1b[A\x1b[B\r", "new"},
+		{"\x1b[A!\x1b[A\x1b[B\r", "second!"},
+		{"oops\x03ok\n", "ok"},
+	}
+
+	for _, tt := range tests {
+		e := &lineEditor{in: bufio.NewReader(strings.NewReader(tt.keys)), out: io.Discard, history: h}
+
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Errorf("ReadLine failed for %q: %v", tt.keys, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("wrong line for %q. expected=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+
+	e := &lineEditor{in: bufio.NewReader(strings.NewReader("\x04")), out: io.Discard}
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line should be io.EOF. got=%v", err)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.monkey")
+	if err := os.WriteFile(script, []byte("let double = fn(x) {\n  x * 2\n};\nlet answer = double(21);\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken.monkey")
+	if err := os.WriteFile(broken, []byte("let ok = 1;\nlet bad = ok + true;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let b = 2\nlet a = [1]\n:env", "a = [1]\nb = 2\n"},
+		{"let a = 1\n:clear\n:env\na", "Error: 1:1: identifier not found: a\n  1 | a\n    | ^\n"},
+		{":load " + script + "\nanswer", "42\n"},
+		{":load " + broken + "\n:env", "Error: 2:14: type mismatch: INTEGER + BOOLEAN\n  2 | let bad = ok + true;\n    |              ^\nok = 1\n"},
+		{":load", "usage: :load <file>\n"},
+		{":load " + filepath.Join(dir, "missing"), "could not load " + filepath.Join(dir, "missing") + ": open " + filepath.Join(dir, "missing") + ": no such file or directory\n"},
+		{"1\n:quit\n2", "1\n"},
+		{":nope", "unknown command :nope (try :env, :clear, :load <file>, :save <file> or :quit)\n"},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		got := strings.ReplaceAll(out.String(), PROMPT, "")
+		if got != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	src := `let n = -5;
+let min = -9223372036854775807 - 1;
+let f = 3.0;
+let g = -0.25;
+let s = "say \"hi\"\n";
+let nothing = first([]);
+let list = [1, [true, "x"], {"k": first([])}];
+let h = {"a": [1.5], "b": 2};
+let square = fn(x) { x * x };
+let sumSquares = fn(a, b) { square(a) + square(b) };
+let adder = fn(n) { fn(x) { x + n } };
+let addTwo = adder(2);
+let size = len;`
+
+	env := object.NewEnvironment()
+	if err := load(src, env); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	var out strings.Builder
+	skipped := save(&out, env)
+
+	if strings.Join(skipped, ",") != "addTwo,size" {
+		t.Errorf("wrong bindings skipped. expected=%q, got=%q", []string{"addTwo", "size"}, skipped)
+	}
+
+	expected := `let adder = fn(n) {
+	fn(x) {
+		x + n;
+	};
+};
+
+let f = 3.0;
+let g = -0.25;
+let h = {"a": [1.5], "b": 2};
+let list = [1, [true, "x"], {"k": if (false) {}}];
+let min = -9223372036854775807 - 1;
+let n = -5;
+let nothing = if (false) {};
+let s = "say \"hi\"\n";
+
+let square = fn(x) {
+	x * x;
+};
+
+let sumSquares = fn(a, b) {
+	square(a) + square(b);
+};
+`
+	if out.String() != expected {
+		t.Errorf("wrong saved source.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	reloaded := object.NewEnvironment()
+	if err := load(out.String(), reloaded); err != nil {
+		t.Fatalf("loading saved source failed: %v", err)
+	}
+
+	for _, name := range []string{"f", "g", "h", "list", "min", "n", "nothing", "s"} {
+		want, _ := env.Get(name)
+		got, _ := reloaded.Get(name)
+		if got == nil || got.Type() != want.Type() || got.Inspect() != want.Inspect() {
+			t.Errorf("%s did not survive saving. expected=%v, got=%v", name, want, got)
+		}
+	}
+
+	if err := load("sumSquares(3, 4)", reloaded); err != nil {
+		t.Errorf("saved function failed: %v", err)
+	}
+	if err := load("let x = ;", reloaded); err == nil || !strings.Contains(err.Error(), "parser errors") {
+		t.Errorf("expected parser errors. got=%v", err)
+	}
+	if err := load("1 + true", reloaded); err == nil || err.Error() != "Error: 1:3: type mismatch: INTEGER + BOOLEAN\n  1 | 1 + true\n    |   ^" {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+}
+
+func TestSaveCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.monkey")
+
+	var out bytes.Buffer
+	Start(strings.NewReader("let a = 1\nlet p = puts\n:save "+path+"\n:clear\n:load "+path+"\na"), &out)
+
+	got := strings.ReplaceAll(out.String(), PROMPT, "")
+	expected := "saved 1 bindings to " + path + "\nnot saved, having no source form: p\n1\n"
+	if got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		src      string
+		ok       bool
+		expected string
+	}{
+		{"let x = 1;\nlet y = x + 1;", true, ""},
+		{
+			"let x = 1;\nlet y = x +;",
+			false,
+			" parser errors:\n\t2:12: no prefix parse function found for ;\n\t  2 | let y = x +;\n\t    |            ^\n",
+		},
+		{
+			"let f = fn(x) {\n  x + true\n};\nf(2);",
+			false,
+			"Error: 2:5: type mismatch: INTEGER + BOOLEAN\n  in f at 4:2\n  4 | f(2);\n    |  ^\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if ok := Run(tt.src, object.NewEnvironment(), &out); ok != tt.ok {
+			t.Errorf("wrong result for %q. expected=%t, got=%t", tt.src, tt.ok, ok)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.src, tt.expected, out.String())
+		}
+	}
+}
+
+func TestErrorInEarlierInputPointsAtCall(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let f = fn(x) { x + true }\nlet y = 0; f(1)"), &out)
+
+	expected := "Error: 1:19: type mismatch: INTEGER + BOOLEAN\n  in f at 1:13\n  1 | let y = 0; f(1)\n    |             ^\n"
+	got := strings.ReplaceAll(out.String(), PROMPT, "")
+	if got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
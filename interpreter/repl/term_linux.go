@@ -0,0 +1,45 @@
+//go:build linux
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd int, t *syscall.Termios) bool {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(t)))
+	return errno == 0
+}
+
+func setTermios(fd int, t *syscall.Termios) bool {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+	return errno == 0
+}
+
+func isTerminal(fd int) bool {
+	var t syscall.Termios
+	return getTermios(fd, &t)
+}
+
+// makeRaw stops the terminal fd from echoing, buffering lines and turning
+// keys like Ctrl-C into signals, so the line editor sees each key as it is
+// pressed. It returns a function restoring the previous settings, or false
+// if the terminal couldn't be changed.
+func makeRaw(fd int) (func(), bool) {
+	var old syscall.Termios
+	if !getTermios(fd, &old) {
+		return nil, false
+	}
+
+	raw := old
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if !setTermios(fd, &raw) {
+		return nil, false
+	}
+
+	return func() { setTermios(fd, &old) }, true
+}
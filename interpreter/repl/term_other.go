@@ -0,0 +1,14 @@
+//go:build !linux
+
+package repl
+
+// Line editing is only supported on Linux; elsewhere the REPL reads plain
+// lines, and history is saved but can't be recalled with the arrow keys.
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), bool) {
+	return nil, false
+}
@@ -5,16 +5,27 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+
+	// Line and Column locate the token's first byte in the source. Both
+	// are 1-based and Column counts bytes; they are zero for tokens that
+	// weren't read from source.
+	Line   int
+	Column int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
 	IDENTIFER = "IDENTIFER"
 	INT       = "INT"
+	FLOAT     = "FLOAT"
 	STRING    = "STRING"
+	// INTERPOLATED is a string literal containing ${...} expressions. Its
+	// literal is the raw source between the quotes; see lexer.Split.
+	INTERPOLATED = "INTERPOLATED"
 
 	// Operators
 	PLUS     = "+"
@@ -22,14 +33,33 @@ const (
 	MINUS    = "-"
 	BANG     = "!"
 	ASTERISK = "*"
+	POW      = "**"
 	SLASH    = "/"
+	PERCENT  = "%"
+
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	SHL     = "<<"
+	SHR     = ">>"
+
+	INCREMENT = "++"
+	DECREMENT = "--"
 
-	LT = "<"
-	GT = ">"
+	LT    = "<"
+	GT    = ">"
+	LT_EQ = "<="
+	GT_EQ = ">="
 
 	EQ  = "=="
 	NEQ = "!="
 
+	AND = "&&"
+	OR  = "||"
+
+	ARROW    = "=>"
+	QUESTION = "?"
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -49,16 +79,28 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MATCH    = "MATCH"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
+	IN       = "IN"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"match":    MATCH,
+	"while":    WHILE,
+	"for":      FOR,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"in":       IN,
 }
 
 func LookupIdentifier(ident string) TokenType {